@@ -11,10 +11,7 @@ import (
 
 func lesheetToHtml(this js.Value, args []js.Value) any {
 	inputStr := args[0].String() // Convert JS string to Go string
-	song, err := internal.ParseSongFromString(inputStr)
-	if err != nil {
-		return js.ValueOf(string(internal.RenderError(err)))
-	}
+	song, parseErr := internal.ParseSongFromString(inputStr)
 	html, err := internal.RenderSongHtml(
 		views.RenderConfig{
 			WithLiveReload: false,
@@ -29,6 +26,10 @@ func lesheetToHtml(this js.Value, args []js.Value) any {
 	if err != nil {
 		html = string(internal.RenderError(err))
 	}
+	// Show every problem found, above the part of the song that could be parsed
+	if parseErr != nil {
+		html = string(internal.RenderError(parseErr)) + html
+	}
 
 	return js.ValueOf(html)
 }
@@ -0,0 +1,364 @@
+// Package abc writes songs as a single ABC tune, to go through any ABC tool chain, abc2svg included:
+// the chords as chord symbols over slashes or invisible rests, the sections as parts, the repeats and
+// endings as bar lines and the ABC backticks spliced in as they are written.
+package abc
+
+import (
+	"io"
+	"lesheets/internal/domain"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// slashMap is the abc2svg note map drawing the notes of the chord bars with slash heads. The other ABC
+// tools skip the "%%" directives and draw them as B notes.
+const slashMap = "slashes"
+
+// decorations are the ABC decorations of the chord annotations, the other annotations are written as
+// text above the chord.
+var decorations = map[string]string{
+	"fermata":         "!fermata!",
+	"diamond-fermata": "!fermata!",
+	"marcato":         "!marcato!",
+	"hold":            "!tenuto!",
+}
+
+// Write writes the song as one ABC tune, each line of the chart being a line of the tune. The chords
+// are chord symbols over slashes, a B note on each beat, or over invisible rests of their length when
+// rests is set. The "%" and "%%" bars repeat the chords of the bars before them, and are drawn as
+// measure repeats by abc2svg when the chords are over slashes. Nashville numbers are spelled in the
+// key of their bar, or written as they are when there is no key.
+func Write(w io.Writer, song *domain.Song, rests bool) error {
+	aw := &writer{rests: rests, length: song.DefaultLength()}
+	aw.unit = parseLength(aw.length)
+	items := []item{}
+	for _, section := range song.Sections {
+		part := section.Name
+		for _, line := range section.Lines {
+			if line.MultilineBacktick.Value != "" {
+				items = append(items, item{part: part, backtick: line.MultilineBacktick.Value})
+				part = ""
+			}
+			for j := range line.Bars {
+				items = append(items, item{part: part, bar: &line.Bars[j], lineEnd: j == len(line.Bars)-1})
+				part = ""
+			}
+		}
+	}
+	aw.header(song, items)
+	for i, it := range items {
+		if it.part != "" {
+			aw.sb.WriteString("P:" + it.part + "\n")
+		}
+		if it.bar == nil {
+			aw.multilineBacktick(it.backtick)
+			continue
+		}
+		var next *domain.Bar
+		if i+1 < len(items) {
+			next = items[i+1].bar
+		}
+		last := true
+		for _, other := range items[i+1:] {
+			last = last && other.bar == nil
+		}
+		aw.bar(it.bar, i == 0 || items[i-1].bar == nil, next, last)
+		if it.lineEnd {
+			aw.sb.WriteString("\n")
+		} else {
+			aw.sb.WriteString(" ")
+		}
+	}
+	_, err := io.WriteString(w, aw.sb.String())
+	return err
+}
+
+// item is a bar of the chart or a multiline backtick, with the name of the part it starts.
+type item struct {
+	part     string
+	bar      *domain.Bar
+	lineEnd  bool
+	backtick string
+}
+
+// writer holds what is in effect on the last bar written, to write the changes only.
+type writer struct {
+	sb     strings.Builder
+	rests  bool
+	length string  // the unit note length, L:
+	unit   float64 // the unit note length in whole notes
+	meter  domain.Meter
+	key    string
+	tempo  int
+	// mapped tells whether the notes are drawn with slash heads
+	mapped bool
+	// played are the notes of the bars written, for the "%" and "%%" bars to repeat them
+	played  []played
+	twoBars bool // the bar before was the first "%%" bar
+}
+
+type played struct {
+	notes    []string
+	backtick bool
+}
+
+func (w *writer) header(song *domain.Song, items []item) {
+	w.meter, w.key = domain.DefaultMeter, ""
+	if time, err := domain.ParseMeter(song.FrontMatter["time"]); err == nil {
+		w.meter = time
+	}
+	for _, it := range items {
+		if it.bar != nil {
+			w.meter, w.key, w.tempo = it.bar.Meter, it.bar.Key, it.bar.Tempo
+			break
+		}
+	}
+	if w.meter.Beats == 0 {
+		w.meter = domain.DefaultMeter
+	}
+	w.sb.WriteString("X:1\n")
+	for _, name := range []string{"title", "subtitle"} {
+		if value := song.FrontMatter[name]; value != "" {
+			w.sb.WriteString("T:" + value + "\n")
+		}
+	}
+	if composer := song.FrontMatter["composer"]; composer != "" {
+		w.sb.WriteString("C:" + composer + "\n")
+	}
+	w.sb.WriteString("M:" + w.meter.String() + "\n")
+	w.sb.WriteString("L:" + w.length + "\n")
+	if w.tempo > 0 {
+		w.sb.WriteString("Q:1/4=" + strconv.Itoa(w.tempo) + "\n")
+	}
+	if !w.rests {
+		w.sb.WriteString("%%map " + slashMap + " * heads=srep\n")
+	}
+	w.sb.WriteString("K:" + keyField(w.key) + "\n")
+	if !w.rests {
+		w.sb.WriteString("%%voicemap " + slashMap + "\n")
+		w.mapped = true
+	}
+}
+
+// bar writes a bar and the bar line after it. first is set when no bar line is written before it,
+// next is the bar after it, nil before a multiline backtick, and last is set on the last bar.
+func (w *writer) bar(bar *domain.Bar, first bool, next *domain.Bar, last bool) {
+	if first && bar.RepeatStart {
+		w.sb.WriteString("|:")
+	}
+	if bar.EndingStart && bar.Ending != nil {
+		w.sb.WriteString("[" + bar.Ending.Label + " ")
+	}
+	meter := bar.Meter
+	if meter.Beats == 0 {
+		meter = w.meter
+	}
+	if meter != w.meter {
+		w.sb.WriteString("[M:" + meter.String() + "]")
+		w.meter = meter
+	}
+	if bar.Key != w.key {
+		w.sb.WriteString("[K:" + keyField(bar.Key) + "]")
+		w.key = bar.Key
+	}
+	if bar.Tempo > 0 && bar.Tempo != w.tempo {
+		w.sb.WriteString("[Q:1/4=" + strconv.Itoa(bar.Tempo) + "]")
+		w.tempo = bar.Tempo
+	}
+
+	p := w.notes(bar)
+	if !w.rests && p.backtick == w.mapped {
+		if p.backtick {
+			w.sb.WriteString("[I:voicemap none]")
+		} else {
+			w.sb.WriteString("[I:voicemap " + slashMap + "]")
+		}
+		w.mapped = !p.backtick
+	}
+	if n := bar.RepeatedBars(); n > 0 && !w.rests && len(w.played) >= n && !(n == 2 && w.twoBars) {
+		w.sb.WriteString("[I:repeat " + strconv.Itoa(n) + "]")
+	}
+	w.twoBars = bar.RepeatedBars() == 2 && !w.twoBars
+	w.played = append(w.played, p)
+
+	notes := append([]string{}, p.notes...)
+	start := ""
+	for _, n := range bar.NavigationAt(true) {
+		start += "!" + string(n) + "!"
+	}
+	if bar.BarNote != "" {
+		start += text(bar.BarNote)
+	}
+	end := ""
+	for _, n := range bar.NavigationAt(false) {
+		end += text(n.Text())
+	}
+	if bar.RepeatEnd && bar.RepeatCount > 0 {
+		end += text("x" + strconv.Itoa(bar.RepeatCount))
+	}
+	notes[len(notes)-1] = end + notes[len(notes)-1]
+	notes[0] = start + notes[0]
+	w.sb.WriteString(strings.Join(notes, " "))
+
+	switch {
+	case bar.RepeatEnd && next != nil && next.RepeatStart:
+		w.sb.WriteString(" ::")
+	case bar.RepeatEnd:
+		w.sb.WriteString(" :|")
+	case last:
+		w.sb.WriteString(" |]")
+	case next != nil && next.RepeatStart:
+		w.sb.WriteString(" |:")
+	case bar.DoubleBarEnd:
+		w.sb.WriteString(" ||")
+	default:
+		w.sb.WriteString(" |")
+	}
+}
+
+// notes returns the notes of a bar: its backtick as it's written, the notes of the bars it repeats,
+// or its chords over slashes or rests.
+func (w *writer) notes(bar *domain.Bar) played {
+	n := bar.RepeatedBars()
+	switch {
+	case n > 0 && len(w.played) >= n:
+		return w.played[len(w.played)-n]
+	case bar.Backtick.Value != "":
+		value := bar.Backtick.Value
+		if length := bar.Backtick.DefaultLength; length != "" && length != w.length {
+			value = "[L:" + length + "]" + value + "[L:" + w.length + "]"
+		}
+		return played{notes: []string{value}, backtick: true}
+	}
+	key, _ := domain.ParseKey(bar.Key)
+	notes := []string{}
+	for i, chord := range bar.Chords {
+		if chord.IsPlaceholder() && len(notes) > 0 {
+			continue
+		}
+		end := float64(w.meter.Beats)
+		for _, after := range bar.Chords[i+1:] {
+			if !after.IsPlaceholder() {
+				end = after.Beat
+				break
+			}
+		}
+		symbol := ""
+		switch chord.Kind() {
+		case domain.KindNoChord:
+			symbol = "\"N.C.\""
+		case domain.KindChord:
+			symbol = "\"" + chordSymbol(chord.Value, key) + "\""
+		}
+		if chord.Annotation != nil && chord.Annotation.Value != "" {
+			if decoration, ok := decorations[chord.Annotation.Value]; ok {
+				symbol = decoration + symbol
+			} else {
+				symbol = text(chord.Annotation.Value) + symbol
+			}
+		}
+		for _, note := range w.rhythm(chord.Beat, end) {
+			notes = append(notes, symbol+note)
+			symbol = ""
+		}
+	}
+	if len(notes) == 0 {
+		notes = append(notes, "x"+w.duration(float64(w.meter.Beats)))
+	}
+	return played{notes: notes}
+}
+
+// rhythm returns the notes from a beat to another: an invisible rest, or a slash on each beat.
+func (w *writer) rhythm(start float64, end float64) []string {
+	if w.rests {
+		return []string{"x" + w.duration(end-start)}
+	}
+	notes := []string{}
+	for start < end {
+		next := min(math.Floor(start)+1, end)
+		notes = append(notes, "B"+w.duration(next-start))
+		start = next
+	}
+	return notes
+}
+
+// duration writes a number of beats as a length in unit note lengths, "" for one unit and "3/2" for
+// one and a half.
+func (w *writer) duration(beats float64) string {
+	units := beats / float64(w.meter.Unit) / w.unit
+	for d := 1; d <= 64; d++ {
+		n := units * float64(d)
+		if math.Abs(n-math.Round(n)) < 1e-6 {
+			switch {
+			case d == 1 && n == 1:
+				return ""
+			case d == 1:
+				return strconv.Itoa(int(math.Round(n)))
+			}
+			return strconv.Itoa(int(math.Round(n))) + "/" + strconv.Itoa(d)
+		}
+	}
+	return strconv.Itoa(max(int(math.Round(units)), 1))
+}
+
+// multilineBacktick splices a multiline backtick in, without its X: field as it's already in a tune.
+// The unit note length, meter, tempo and key of the chart are written back after it when it changes
+// them.
+func (w *writer) multilineBacktick(value string) {
+	if w.mapped {
+		w.sb.WriteString("%%voicemap none\n")
+		w.mapped = false
+	}
+	restore := ""
+	for _, line := range strings.Split(strings.TrimSpace(value), "\n") {
+		switch {
+		case strings.HasPrefix(line, "X:"):
+			continue
+		case strings.HasPrefix(line, "L:"):
+			restore += "L:" + w.length + "\n"
+		case strings.HasPrefix(line, "M:"):
+			restore += "M:" + w.meter.String() + "\n"
+		case strings.HasPrefix(line, "Q:") && w.tempo > 0:
+			restore += "Q:1/4=" + strconv.Itoa(w.tempo) + "\n"
+		case strings.HasPrefix(line, "K:"):
+			restore += "K:" + keyField(w.key) + "\n"
+		}
+		w.sb.WriteString(line + "\n")
+	}
+	w.sb.WriteString(restore)
+}
+
+// chordSymbol returns the text of a chord symbol, a Nashville number being spelled in the key given.
+func chordSymbol(value string, key *domain.Key) string {
+	symbol, err := domain.ParseChordSymbol(value)
+	if err == nil && symbol.IsNashville() && key != nil {
+		return key.ChordToLetters(value)
+	}
+	return value
+}
+
+// keyField writes a key for the K: field, "none" when there is none.
+func keyField(key string) string {
+	k, err := domain.ParseKey(key)
+	if key == "" || err != nil {
+		return "none"
+	}
+	return k.String()
+}
+
+// text writes an annotation placed above the next note.
+func text(value string) string {
+	return "\"^" + strings.ReplaceAll(value, "\"", "'") + "\""
+}
+
+// parseLength reads a unit note length like "1/16" as a fraction of a whole note.
+func parseLength(value string) float64 {
+	num, den, ok := strings.Cut(value, "/")
+	n, err1 := strconv.Atoi(strings.TrimSpace(num))
+	d, err2 := strconv.Atoi(strings.TrimSpace(den))
+	if !ok || err1 != nil || err2 != nil || n <= 0 || d <= 0 {
+		return 1.0 / 16
+	}
+	return float64(n) / float64(d)
+}
@@ -0,0 +1,157 @@
+package abc
+
+import (
+	"bytes"
+	"lesheets/internal"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func write(t *testing.T, source string, rests bool) string {
+	song, err := internal.ParseSongFromString(source)
+	require.NoError(t, err)
+	buf := bytes.Buffer{}
+	require.NoError(t, Write(&buf, song, rests))
+	return buf.String()
+}
+
+// body returns the tune without its header, the lines after the K: field.
+func body(tune string) string {
+	_, after, _ := strings.Cut(tune, "\nK:")
+	_, after, _ = strings.Cut(after, "\n")
+	return strings.TrimPrefix(after, "%%voicemap slashes\n")
+}
+
+func TestWriteHeader(t *testing.T) {
+	tune := write(t, `---
+title: Blue Bossa
+subtitle: Latin
+composer: Kenny Dorham
+key: Cm
+tempo: 140
+time: 3/4
+L: 1/8
+---
+
+Cm7 | Fm7
+`, false)
+	assert.Equal(t, `X:1
+T:Blue Bossa
+T:Latin
+C:Kenny Dorham
+M:3/4
+L:1/8
+Q:1/4=140
+%%map slashes * heads=srep
+K:Cm
+%%voicemap slashes
+"Cm7"B2 B2 B2 | "Fm7"B2 B2 B2 |]
+`, tune)
+
+	tune = write(t, "1 | 4\n", true)
+	assert.Equal(t, "X:1\nM:4/4\nL:1/16\nK:none\n\"1\"x16 | \"4\"x16 |]\n", tune)
+}
+
+func TestWriteChords(t *testing.T) {
+	testCases := []struct {
+		desc    string
+		source  string
+		slashes string
+		rests   string
+	}{
+		{
+			desc:    "one chord",
+			source:  "Cmaj7",
+			slashes: `"Cmaj7"B4 B4 B4 B4 |]`,
+			rests:   `"Cmaj7"x16 |]`,
+		},
+		{
+			desc:    "dots and slashes",
+			source:  "C . G / ",
+			slashes: `"C"B4 B4 "G"B4 B4 |]`,
+			rests:   `"C"x8 "G"x4 x4 |]`,
+		},
+		{
+			desc:    "leading dot",
+			source:  ". !pull!Cm . .",
+			slashes: `B4 "^pull""Cm"B4 B4 B4 |]`,
+			rests:   `x4 "^pull""Cm"x12 |]`,
+		},
+		{
+			desc:    "off the beat",
+			source:  "(3/4) C G",
+			slashes: `"C"B4 B2 "G"B2 B4 |]`,
+			rests:   `"C"x6 "G"x6 |]`,
+		},
+		{
+			desc:    "no chord and fermata",
+			source:  "N.C. !fermata!G7",
+			slashes: `"N.C."B4 B4 !fermata!"G7"B4 B4 |]`,
+			rests:   `"N.C."x8 !fermata!"G7"x8 |]`,
+		},
+		{
+			desc:    "Nashville numbers in the key",
+			source:  "---\nkey: D\n---\n6m7 5/7",
+			slashes: `"Bm7"B4 B4 "A/C#"B4 B4 |]`,
+			rests:   `"Bm7"x8 "A/C#"x8 |]`,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			assert.Equal(t, tC.slashes+"\n", body(write(t, tC.source+"\n", false)))
+			assert.Equal(t, tC.rests+"\n", body(write(t, tC.source+"\n", true)))
+		})
+	}
+}
+
+func TestWriteStructure(t *testing.T) {
+	tune := write(t, `---
+key: C
+---
+
+# A
+
+||: "Head" C | F :||||: G | !segno! C ||
+[1 Dm :||[2 !D.S.alfine! G :|| 3x
+
+# B !key=D! !tempo=90!
+
+!coda! D | !tocoda! A ||
+`, true)
+	assert.Equal(t, `P:A
+|:"^Head""C"x16 | "F"x16 :: "G"x16 | !segno!"C"x16 ||
+[1 "Dm"x16 :| [2 "^D.S. al Fine""^x3""G"x16 :|
+P:B
+[K:D][Q:1/4=90]!coda!"D"x16 | "^To Coda""A"x16 |]
+`, body(tune))
+}
+
+func TestWriteRepeatedBars(t *testing.T) {
+	source := "C | % | D | E | %% | %% | F\n"
+	assert.Equal(t, `"C"x16 | "C"x16 | "D"x16 | "E"x16 | "D"x16 | "E"x16 | "F"x16 |]`+"\n", body(write(t, source, true)))
+	assert.Equal(t, `"C"B4 B4 B4 B4 | [I:repeat 1]"C"B4 B4 B4 B4 | "D"B4 B4 B4 B4 | "E"B4 B4 B4 B4 | `+
+		`[I:repeat 2]"D"B4 B4 B4 B4 | "E"B4 B4 B4 B4 | "F"B4 B4 B4 B4 |]`+"\n", body(write(t, source, false)))
+}
+
+func TestWriteBackticks(t *testing.T) {
+	tune := write(t, "C | `\"G\"G4 z4 A8` | D\n", false)
+	assert.Equal(t, `"C"B4 B4 B4 B4 | [I:voicemap none]"G"G4 z4 A8 | [I:voicemap slashes]"D"B4 B4 B4 B4 |]`+"\n", body(tune))
+
+	tune = write(t, "# Solo\n\n```\nX:1\nT:Solo\nM:3/4\nL:1/8\nK:G\nGAB |]\n```\n\n# Out\n\nC\n", false)
+	assert.Equal(t, `P:Solo
+%%voicemap none
+T:Solo
+M:3/4
+L:1/8
+K:G
+GAB |]
+M:4/4
+L:1/16
+K:none
+P:Out
+[I:voicemap slashes]"C"B4 B4 B4 B4 |]
+`, body(tune))
+}
@@ -0,0 +1,385 @@
+// Package chordpro reads songs written in ChordPro into a domain.Song and writes songs back to it, to
+// bring the songbooks kept in ChordPro into lesheets and to share charts with the apps that use it.
+package chordpro
+
+import (
+	"errors"
+	"lesheets/internal/domain"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Extensions are the file extensions of ChordPro files.
+var Extensions = []string{".cho", ".chopro", ".chordpro", ".crd", ".pro"}
+
+// metaDirectives are the ChordPro directives kept as front matter fields of the same name.
+var metaDirectives = []string{"title", "subtitle", "artist", "composer", "lyricist", "arranger", "album", "year", "copyright", "duration", "capo"}
+
+// directiveAliases are the short forms of the directives.
+var directiveAliases = map[string]string{
+	"t":                 "title",
+	"st":                "subtitle",
+	"c":                 "comment",
+	"ci":                "comment",
+	"cb":                "comment",
+	"np":                "new_page",
+	"npp":               "new_page",
+	"soc":               "start_of_chorus",
+	"eoc":               "end_of_chorus",
+	"sov":               "start_of_verse",
+	"eov":               "end_of_verse",
+	"sob":               "start_of_bridge",
+	"eob":               "end_of_bridge",
+	"sot":               "start_of_tab",
+	"eot":               "end_of_tab",
+	"sog":               "start_of_grid",
+	"eog":               "end_of_grid",
+	"comment_italic":    "comment",
+	"comment_box":       "comment",
+	"highlight":         "comment",
+	"new_physical_page": "new_page",
+}
+
+// Parse reads a ChordPro song. The metadata directives ({title:}, {key:}, {tempo:}...) go to the front
+// matter, or are key, tempo and meter changes when they come after the first chords. The environments
+// ({start_of_chorus}, {start_of_verse: Label}...) are sections, and {chorus} reuses the last chorus.
+// Each chord of a lyrics line starts a bar, with the lyrics up to the next chord, and the grids are
+// read bar by bar. Comments are bar notes of the next bar, and the tabs are left out.
+func Parse(source string) (*domain.Song, error) {
+	p := &parser{
+		song:   &domain.Song{FrontMatter: map[string]string{}, Sections: []domain.Section{{}}},
+		meter:  domain.DefaultMeter,
+		counts: map[string]int{},
+	}
+	for i, line := range strings.Split(strings.ReplaceAll(source, "\r\n", "\n"), "\n") {
+		if err := p.line(line); err != nil {
+			return nil, errors.New("line " + strconv.Itoa(i+1) + ": " + err.Error())
+		}
+	}
+	if p.environment == "abc" {
+		p.endAbc()
+	}
+	return p.song, nil
+}
+
+type parser struct {
+	song *domain.Song
+	// environment is the environment open, without its start_of_ prefix
+	environment string
+	abc         strings.Builder
+	// the meter, key and tempo in effect, the changes waiting for the next bar or section
+	meter                               domain.Meter
+	key                                 string
+	tempo                               int
+	meterChange, keyChange, tempoChange bool
+	notes                               []string
+	newPage                             bool
+	started                             bool
+	barsCount                           int
+	counts                              map[string]int // sections by name, to number them
+	lastChorus                          string
+}
+
+func (p *parser) section() *domain.Section {
+	return &p.song.Sections[len(p.song.Sections)-1]
+}
+
+func (p *parser) line(line string) error {
+	trimmed := strings.TrimSpace(line)
+	if strings.HasPrefix(trimmed, "{") {
+		if !strings.HasSuffix(trimmed, "}") {
+			return errors.New("missing closing \"}\" in \"" + trimmed + "\"")
+		}
+		name, value := splitDirective(trimmed[1 : len(trimmed)-1])
+		return p.directive(name, value)
+	}
+	switch p.environment {
+	case "abc":
+		p.abc.WriteString(line + "\n")
+		return nil
+	case "tab":
+		return nil
+	}
+	if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+		return nil
+	}
+	if p.environment == "grid" {
+		p.gridLine(trimmed)
+		return nil
+	}
+	return p.lyricsLine(trimmed)
+}
+
+// splitDirective returns the name of a directive and its value, written after a colon or a space.
+// The label="..." attributes of ChordPro 6 are read as the value.
+func splitDirective(directive string) (string, string) {
+	i := strings.IndexAny(directive, ": ")
+	if i < 0 {
+		return strings.ToLower(directive), ""
+	}
+	name, value := strings.ToLower(strings.TrimSpace(directive[:i])), strings.TrimSpace(directive[i+1:])
+	if label, ok := strings.CutPrefix(value, "label="); ok {
+		value = strings.Trim(label, `"'`)
+	}
+	return name, value
+}
+
+func (p *parser) directive(name string, value string) error {
+	if alias, ok := directiveAliases[name]; ok {
+		name = alias
+	}
+	switch {
+	case slices.Contains(metaDirectives, name):
+		p.song.FrontMatter[name] = value
+	case name == "meta":
+		field, fieldValue, _ := strings.Cut(value, " ")
+		p.song.FrontMatter[field] = strings.TrimSpace(fieldValue)
+	case name == "key":
+		if _, err := domain.ParseKey(value); err != nil {
+			return err
+		}
+		p.key = value
+		p.change("key", value, &p.keyChange)
+	case name == "tempo":
+		tempo, err := domain.ParseTempo(value)
+		if err != nil {
+			return err
+		}
+		p.tempo = tempo
+		p.change("tempo", strconv.Itoa(tempo), &p.tempoChange)
+	case name == "time":
+		meter, err := domain.ParseMeter(value)
+		if err != nil {
+			return err
+		}
+		p.meter = meter
+		p.change("time", value, &p.meterChange)
+	case name == "comment":
+		p.notes = append(p.notes, value)
+	case name == "new_page":
+		p.newPage = true
+	case name == "chorus":
+		p.reuseChorus(value)
+	case name == "start_of_abc":
+		p.environment = "abc"
+		p.abc.Reset()
+		if value != "" {
+			p.startSection(value)
+		}
+	case name == "end_of_abc":
+		p.endAbc()
+	case strings.HasPrefix(name, "start_of_") && name != "start_of_":
+		p.environment = strings.TrimPrefix(name, "start_of_")
+		if p.environment == "tab" {
+			return nil
+		}
+		if value == "" {
+			value = p.numbered(strings.ToUpper(p.environment[:1]) + strings.ReplaceAll(p.environment[1:], "_", " "))
+		}
+		p.startSection(value)
+		if p.environment == "chorus" {
+			p.lastChorus = value
+		}
+	case strings.HasPrefix(name, "end_of_") && name != "end_of_":
+		p.environment = ""
+	}
+	return nil
+}
+
+// change sets a front matter field before the first bar, and marks the change for the next bar after.
+func (p *parser) change(field string, value string, pending *bool) {
+	if p.started {
+		*pending = true
+	} else {
+		p.song.FrontMatter[field] = value
+	}
+}
+
+// numbered returns the name of a section, numbered from the second one with the same name:
+// "Verse", "Verse 2"...
+func (p *parser) numbered(name string) string {
+	p.counts[name]++
+	if n := p.counts[name]; n > 1 {
+		return name + " " + strconv.Itoa(n)
+	}
+	return name
+}
+
+// startSection adds a section, with the key and tempo changes written before it in its header.
+func (p *parser) startSection(name string) {
+	section := domain.Section{Name: name, Break: p.newPage}
+	if p.keyChange {
+		section.Key, p.keyChange = p.key, false
+	}
+	if p.tempoChange {
+		section.Tempo, p.tempoChange = p.tempo, false
+	}
+	p.newPage = false
+	p.song.Sections = append(p.song.Sections, section)
+}
+
+// reuseChorus adds a section reusing the last chorus, "# Chorus 2 = Chorus", moved to the key set
+// before it.
+func (p *parser) reuseChorus(label string) {
+	i := len(p.song.Sections) - 1
+	for i >= 0 && p.song.Sections[i].Name != p.lastChorus {
+		i--
+	}
+	if p.lastChorus == "" || i < 0 {
+		p.notes = append(p.notes, "Chorus")
+		return
+	}
+	if label == "" {
+		label = p.numbered("Chorus")
+	}
+	p.startSection(label)
+	section := p.section()
+	section.Ref = p.lastChorus
+	section.Lines = domain.ReuseLines(p.song.Sections[i].Lines, nil)
+	if section.Key != "" {
+		section.TransposeReused(section.Key)
+	}
+	var last *domain.Bar
+	p.barsCount, last = section.ChainReused(p.barsCount, p.meter, p.key, p.tempo)
+	if last != nil {
+		p.meter, p.key, p.tempo = last.Meter, last.Key, last.Tempo
+	}
+}
+
+func (p *parser) endAbc() {
+	p.environment = ""
+	p.section().Lines = append(p.section().Lines, domain.Line{MultilineBacktick: domain.MultilineBacktick{
+		Value:         p.abc.String(),
+		DefaultLength: p.song.DefaultLength(),
+	}})
+}
+
+// bar returns a bar with the chords given and the changes and comments written before it.
+func (p *parser) bar(chords ...string) domain.Bar {
+	p.started = true
+	bar := domain.Bar{
+		Meter:       p.meter,
+		MeterChange: p.meterChange,
+		Key:         p.key,
+		KeyChange:   p.keyChange,
+		Tempo:       p.tempo,
+		TempoChange: p.tempoChange,
+		BarNote:     strings.Join(p.notes, ", "),
+		Id:          p.barsCount,
+	}
+	p.meterChange, p.keyChange, p.tempoChange = false, false, false
+	p.notes = nil
+	p.barsCount++
+	for _, chord := range chords {
+		bar.Chords = append(bar.Chords, domain.Chord{Value: chord, Annotation: &domain.Annotation{}})
+	}
+	bar.PlaceBeats()
+	return bar
+}
+
+// isChord tells whether a bracketed value is a chord or a sign written in place of one, like "N.C.".
+// The other values are annotations like [*Riff].
+func isChord(value string) bool {
+	chord := domain.Chord{Value: value}
+	if !chord.IsChordSymbol() {
+		return true
+	}
+	_, err := chord.Symbol()
+	return err == nil
+}
+
+// lyricsLine adds a line with a bar for each chord of the line, the lyrics after the chord going to
+// its bar. A line without chords holds the chord before it with a "%" bar.
+func (p *parser) lyricsLine(text string) error {
+	chords, fragments := []string{}, []string{""}
+	for {
+		open := strings.IndexByte(text, '[')
+		if open < 0 {
+			break
+		}
+		end := strings.IndexByte(text[open:], ']')
+		if end < 0 {
+			return errors.New("missing closing \"]\" in \"" + text + "\"")
+		}
+		value := strings.TrimSpace(text[open+1 : open+end])
+		fragments[len(fragments)-1] += text[:open]
+		text = text[open+end+1:]
+		if !isChord(value) {
+			p.notes = append(p.notes, strings.TrimPrefix(value, "*"))
+			continue
+		}
+		chords = append(chords, value)
+		fragments = append(fragments, "")
+	}
+	fragments[len(fragments)-1] += text
+	if len(chords) == 0 {
+		chords = []string{"%"}
+		if p.barsCount == 0 {
+			chords[0] = "N.C."
+		}
+		fragments = append(fragments, "")
+	}
+	// The lyrics before the first chord go with it
+	fragments[1] = fragments[0] + fragments[1]
+	fragments = fragments[1:]
+
+	line := domain.Line{}
+	lyrics := domain.Lyrics{}
+	hasLyrics := false
+	for i, chord := range chords {
+		bar := p.bar(chord)
+		bar.Lyrics = strings.TrimSpace(strings.ReplaceAll(fragments[i], "|", "/"))
+		hasLyrics = hasLyrics || bar.Lyrics != ""
+		lyrics.Fragments = append(lyrics.Fragments, bar.Lyrics)
+		line.Bars = append(line.Bars, bar)
+	}
+	if hasLyrics {
+		line.Lyrics = []domain.Lyrics{lyrics}
+	}
+	p.section().Lines = append(p.section().Lines, line)
+	return nil
+}
+
+// gridLine adds a line of a grid: "|: C . . . | G . . . :| x2". The cells are the beats of the bars,
+// the text before the first bar line and after the last one is left out, except the repeat counts
+// that a lesheet can hold, from 2 to domain.MaxPass.
+func (p *parser) gridLine(text string) {
+	line := domain.Line{}
+	var cells []string
+	opened, repeatStart := false, false
+	for _, field := range strings.Fields(text) {
+		if count, ok := strings.CutPrefix(field, "x"); ok && len(cells) == 0 && len(line.Bars) > 0 && line.Bars[len(line.Bars)-1].RepeatEnd {
+			if n, err := strconv.Atoi(count); err == nil && n >= 2 && n <= domain.MaxPass {
+				line.Bars[len(line.Bars)-1].RepeatCount = n
+				continue
+			}
+		}
+		if !isGridBarLine(field) {
+			if opened {
+				cells = append(cells, strings.Split(field, "~")...)
+			}
+			continue
+		}
+		if opened && len(cells) > 0 {
+			if cells[0] == "%" || cells[0] == "%%" {
+				// The repeat signs fill the bar, "% . . ." is "%"
+				cells = cells[:1]
+			}
+			bar := p.bar(cells...)
+			bar.RepeatStart = repeatStart
+			bar.RepeatEnd = strings.HasPrefix(field, ":")
+			bar.DoubleBarEnd = !bar.RepeatEnd && (field == "||" || field == "|.")
+			line.Bars = append(line.Bars, bar)
+		}
+		opened, cells = true, nil
+		repeatStart = strings.HasSuffix(field, ":")
+	}
+	if len(line.Bars) > 0 {
+		p.section().Lines = append(p.section().Lines, line)
+	}
+}
+
+func isGridBarLine(field string) bool {
+	return strings.Contains(field, "|") && strings.Trim(field, "|:.") == ""
+}
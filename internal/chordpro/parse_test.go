@@ -0,0 +1,261 @@
+package chordpro
+
+import (
+	"lesheets/internal"
+	"lesheets/internal/domain"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func chords(bar domain.Bar) []string {
+	values := []string{}
+	for _, chord := range bar.Chords {
+		values = append(values, chord.Value)
+	}
+	return values
+}
+
+func TestParseMeta(t *testing.T) {
+	song, err := Parse(`{title: Amazing Grace}
+{st: Traditional}
+{artist: John Newton}
+{key: G}
+{time: 3/4}
+{tempo: 80}
+{meta: source Hymnal}
+
+[G]Amazing [G7]grace
+{key: A}
+[A]How sweet the sound
+`)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"title":    "Amazing Grace",
+		"subtitle": "Traditional",
+		"artist":   "John Newton",
+		"key":      "G",
+		"time":     "3/4",
+		"tempo":    "80",
+		"source":   "Hymnal",
+	}, song.FrontMatter)
+	lines := song.Sections[0].Lines
+	require.Len(t, lines, 2)
+	assert.Equal(t, domain.Meter{Beats: 3, Unit: 4}, lines[0].Bars[0].Meter)
+	assert.Equal(t, 80, lines[0].Bars[0].Tempo)
+	assert.False(t, lines[0].Bars[0].KeyChange)
+	assert.Equal(t, "A", lines[1].Bars[0].Key)
+	assert.True(t, lines[1].Bars[0].KeyChange)
+}
+
+func TestParseLyrics(t *testing.T) {
+	testCases := []struct {
+		desc      string
+		line      string
+		chords    [][]string
+		fragments []string
+	}{
+		{
+			desc:      "a bar for each chord",
+			line:      "A[G]mazing [G7]grace, how [C]sweet the [G]sound",
+			chords:    [][]string{{"G"}, {"G7"}, {"C"}, {"G"}},
+			fragments: []string{"Amazing", "grace, how", "sweet the", "sound"},
+		},
+		{
+			desc:      "chords without lyrics",
+			line:      "[Am] [F] [C]",
+			chords:    [][]string{{"Am"}, {"F"}, {"C"}},
+			fragments: nil,
+		},
+		{
+			desc:      "lyrics without chords",
+			line:      "That saved a wretch like me",
+			chords:    [][]string{{"N.C."}},
+			fragments: []string{"That saved a wretch like me"},
+		},
+		{
+			desc:      "annotations",
+			line:      "[*Riff][C]I once was [G]lost",
+			chords:    [][]string{{"C"}, {"G"}},
+			fragments: []string{"I once was", "lost"},
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			song, err := Parse(tC.line)
+			require.NoError(t, err)
+			line := song.Sections[0].Lines[0]
+			actual := [][]string{}
+			for _, bar := range line.Bars {
+				actual = append(actual, chords(bar))
+			}
+			assert.Equal(t, tC.chords, actual)
+			if tC.fragments == nil {
+				assert.Empty(t, line.Lyrics)
+			} else {
+				require.Len(t, line.Lyrics, 1)
+				assert.Equal(t, tC.fragments, line.Lyrics[0].Fragments)
+			}
+		})
+	}
+}
+
+func TestParseHoldsChord(t *testing.T) {
+	song, err := Parse("[G]Amazing grace\nHow sweet the sound\n")
+	require.NoError(t, err)
+	lines := song.Sections[0].Lines
+	require.Len(t, lines, 2)
+	assert.Equal(t, []string{"%"}, chords(lines[1].Bars[0]))
+	assert.Equal(t, 1, lines[1].Bars[0].RepeatedBars())
+}
+
+func TestParseSections(t *testing.T) {
+	song, err := Parse(`{start_of_verse}
+[G]One
+{end_of_verse}
+{soc}
+[C]Chorus
+{eoc}
+{start_of_verse: label="Last verse"}
+[D]Two
+{end_of_verse}
+{sov}
+[E]Three
+{eov}
+{sot}
+e|---0---|
+{eot}
+`)
+	require.NoError(t, err)
+	names := []string{}
+	for _, section := range song.Sections {
+		names = append(names, section.Name)
+	}
+	assert.Equal(t, []string{"", "Verse", "Chorus", "Last verse", "Verse 2"}, names)
+	assert.Len(t, song.Sections[4].Lines, 1)
+}
+
+func TestParseChorusReference(t *testing.T) {
+	song, err := Parse(`{key: G}
+{soc}
+[C]I once was [G]lost
+{eoc}
+{c: Last time}
+{key: A}
+{chorus}
+`)
+	require.NoError(t, err)
+	require.Len(t, song.Sections, 3)
+	chorus := song.Sections[2]
+	assert.Equal(t, "Chorus 2", chorus.Name)
+	assert.Equal(t, "Chorus", chorus.Ref)
+	assert.Equal(t, "A", chorus.Key)
+	assert.Empty(t, chorus.WrittenLines())
+	bars := chorus.Lines[0].Bars
+	assert.Equal(t, []string{"D"}, chords(bars[0]))
+	assert.Equal(t, []string{"A"}, chords(bars[1]))
+	assert.Equal(t, 2, bars[0].Id)
+}
+
+func TestParseChorusWithoutChorus(t *testing.T) {
+	song, err := Parse("{chorus}\n[G]Amazing grace\n")
+	require.NoError(t, err)
+	require.Len(t, song.Sections, 1)
+	assert.Equal(t, "Chorus", song.Sections[0].Lines[0].Bars[0].BarNote)
+}
+
+func TestParseComments(t *testing.T) {
+	song, err := Parse("{c: Intro}\n{ci: softly}\n[G]Amazing grace\n")
+	require.NoError(t, err)
+	assert.Equal(t, "Intro, softly", song.Sections[0].Lines[0].Bars[0].BarNote)
+}
+
+func TestParseGrid(t *testing.T) {
+	song, err := Parse(`{start_of_grid: Intro}
+|: A . . . | D . E~F# . :| x2
+| A . . . | % . . . ||
+{end_of_grid}
+`)
+	require.NoError(t, err)
+	require.Len(t, song.Sections, 2)
+	lines := song.Sections[1].Lines
+	require.Len(t, lines, 2)
+	first := lines[0].Bars
+	require.Len(t, first, 2)
+	assert.True(t, first[0].RepeatStart)
+	assert.Equal(t, []string{"D", ".", "E", "F#", "."}, chords(first[1]))
+	assert.True(t, first[1].RepeatEnd)
+	assert.Equal(t, 2, first[1].RepeatCount)
+	second := lines[1].Bars
+	require.Len(t, second, 2)
+	assert.Equal(t, 1, second[1].RepeatedBars())
+	assert.True(t, second[1].DoubleBarEnd)
+}
+
+func TestParseGridRepeatCounts(t *testing.T) {
+	testCases := []struct {
+		count    string
+		expected int
+	}{
+		{count: "x1", expected: 0},
+		{count: "x2", expected: 2},
+		{count: "x99", expected: 99},
+		{count: "x100", expected: 0},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.count, func(t *testing.T) {
+			song, err := Parse("{start_of_grid}\n| C . . . | G . . . :| " + tC.count + "\n{end_of_grid}\n")
+			require.NoError(t, err)
+			bars := song.Sections[1].Lines[0].Bars
+			require.Len(t, bars, 2)
+			assert.Equal(t, tC.expected, bars[1].RepeatCount)
+
+			source, err := internal.PrintSource(song)
+			require.NoError(t, err)
+			converted, err := internal.ParseSongFromString(source)
+			require.NoError(t, err, source)
+			assert.Equal(t, tC.expected, converted.Bars()[1].RepeatCount)
+		})
+	}
+}
+
+func TestParseAbc(t *testing.T) {
+	song, err := Parse("{start_of_abc}\nX:1\nK:C\nCDEF|\n{end_of_abc}\n")
+	require.NoError(t, err)
+	lines := song.Sections[0].Lines
+	require.Len(t, lines, 1)
+	assert.Equal(t, "X:1\nK:C\nCDEF|\n", lines[0].MultilineBacktick.Value)
+}
+
+func TestParseUnknownDirectives(t *testing.T) {
+	testCases := []string{"0\n{start_of_}", "{start_of_}\n[G]Amazing grace\n{end_of_}", "{start_of: Verse}\n[G]Amazing grace\n{foo}"}
+	for _, source := range testCases {
+		t.Run(source, func(t *testing.T) {
+			song, err := Parse(source)
+			require.NoError(t, err)
+			require.Len(t, song.Sections, 1)
+			assert.NotEmpty(t, song.Sections[0].Lines)
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	testCases := []struct {
+		desc   string
+		source string
+		err    string
+	}{
+		{desc: "unclosed directive", source: "{title: Song\n", err: "line 1: missing closing \"}\""},
+		{desc: "unclosed chord", source: "\n[G Amazing\n", err: "line 2: missing closing \"]\""},
+		{desc: "bad key", source: "{key: H}\n", err: "line 1: "},
+		{desc: "bad time", source: "{time: three}\n", err: "line 1: "},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			_, err := Parse(tC.source)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tC.err)
+		})
+	}
+}
@@ -0,0 +1,252 @@
+package chordpro
+
+import (
+	"lesheets/internal/domain"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// printedFields are the front matter fields written first, in this order, as their directives. The
+// other fields are written as {meta: name value}, except the ones only lesheets uses.
+var printedFields = []string{"title", "subtitle", "artist", "composer", "lyricist", "arranger", "album", "year", "copyright", "key", "time", "tempo", "duration", "capo"}
+
+var lesheetsFields = []string{"L", "references"}
+
+// Print writes the song in ChordPro. The front matter fields are directives and the sections are
+// environments: chorus, verse or bridge after their name, verse for the other names. The sections
+// with lyrics are written once for each verse of lyrics, with the chords of each bar over its lyrics,
+// and the sections without lyrics are written as grids, bar by bar. A section reusing a chorus
+// without changing it is a {chorus}. Bar notes and navigation markers are comments, and the ABC
+// backticks written on their own lines are {start_of_abc} environments.
+func Print(song *domain.Song) string {
+	sb := &strings.Builder{}
+	printMeta(song, sb)
+	pr := printer{sb: sb, environments: map[string]string{}}
+	for i := range song.Sections {
+		pr.section(&song.Sections[i])
+	}
+	return sb.String()
+}
+
+func printMeta(song *domain.Song, sb *strings.Builder) {
+	names := []string{}
+	for name := range song.FrontMatter {
+		if !slices.Contains(printedFields, name) && !slices.Contains(lesheetsFields, name) {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+	for _, name := range printedFields {
+		if value, ok := song.FrontMatter[name]; ok {
+			sb.WriteString("{" + name + ": " + value + "}\n")
+		}
+	}
+	for _, name := range names {
+		sb.WriteString("{meta: " + name + " " + song.FrontMatter[name] + "}\n")
+	}
+}
+
+type printer struct {
+	sb *strings.Builder
+	// played are the chords of the bars printed so far, for the bars repeating them
+	played [][]domain.Chord
+	// environments are the environments of the sections printed, by name
+	environments map[string]string
+}
+
+// environment returns the ChordPro environment of a section from its name: "Chorus 2" is a chorus.
+func environment(name string) string {
+	first, _, _ := strings.Cut(strings.ToLower(name), " ")
+	switch first {
+	case "chorus", "bridge", "grid":
+		return first
+	}
+	return "verse"
+}
+
+func (pr *printer) section(section *domain.Section) {
+	if len(section.Lines) == 0 && section.Name == "" {
+		return
+	}
+	if section.Break {
+		pr.sb.WriteString("{new_page}\n")
+	}
+	if section.Key != "" {
+		pr.sb.WriteString("{key: " + section.Key + "}\n")
+	}
+	if section.Tempo > 0 {
+		pr.sb.WriteString("{tempo: " + strconv.Itoa(section.Tempo) + "}\n")
+	}
+	bars := pr.resolve(section.Lines)
+	env := environment(section.Name)
+	if section.Ref != "" && len(section.WrittenLines()) == 0 && section.Key == "" && pr.environments[section.Ref] == "chorus" {
+		pr.environments[section.Name] = "chorus"
+		pr.sb.WriteString("{chorus: " + section.Name + "}\n\n")
+		return
+	}
+	verses := 0
+	for _, line := range section.Lines {
+		verses = max(verses, len(line.Lyrics))
+	}
+	if verses == 0 && slices.ContainsFunc(section.Lines, func(line domain.Line) bool { return len(line.Bars) > 0 }) {
+		env = "grid"
+	}
+	pr.environments[section.Name] = env
+	for verse := range max(verses, 1) {
+		if section.Name != "" || env == "grid" {
+			pr.sb.WriteString("{start_of_" + env)
+			if section.Name != "" {
+				pr.sb.WriteString(": " + section.Name)
+			}
+			pr.sb.WriteString("}\n")
+		}
+		for i, line := range section.Lines {
+			pr.directives(&line)
+			if line.MultilineBacktick.Value != "" {
+				pr.sb.WriteString("{start_of_abc}\n" + strings.TrimSuffix(line.MultilineBacktick.Value, "\n") + "\n{end_of_abc}\n")
+			}
+			if len(line.Bars) == 0 {
+				continue
+			}
+			if env == "grid" {
+				pr.gridLine(&line)
+				continue
+			}
+			fragments := []string{}
+			if verse < len(line.Lyrics) {
+				fragments = line.Lyrics[verse].Fragments
+			}
+			pr.lyricsLine(&line, bars[i], fragments)
+		}
+		if section.Name != "" || env == "grid" {
+			pr.sb.WriteString("{end_of_" + env + "}\n")
+		}
+		pr.sb.WriteString("\n")
+	}
+}
+
+// resolve returns the chords of each bar of the lines, with the chords of the bars repeated by the
+// "%" and "%%" signs in place of them.
+func (pr *printer) resolve(lines []domain.Line) [][][]domain.Chord {
+	res := [][][]domain.Chord{}
+	for _, line := range lines {
+		bars := [][]domain.Chord{}
+		for _, bar := range line.Bars {
+			chords := bar.Chords
+			if n := bar.RepeatedBars(); n > 0 && len(pr.played) >= n {
+				chords = pr.played[len(pr.played)-n]
+			}
+			if bar.Backtick.Value != "" {
+				chords = nil
+			}
+			pr.played = append(pr.played, chords)
+			bars = append(bars, chords)
+		}
+		res = append(res, bars)
+	}
+	return res
+}
+
+// directives writes the changes and the comments of the bars of the line before it.
+func (pr *printer) directives(line *domain.Line) {
+	for _, bar := range line.Bars {
+		if bar.MeterChange {
+			pr.sb.WriteString("{time: " + bar.Meter.String() + "}\n")
+		}
+		if bar.KeyChange {
+			pr.sb.WriteString("{key: " + bar.Key + "}\n")
+		}
+		if bar.TempoChange {
+			pr.sb.WriteString("{tempo: " + strconv.Itoa(bar.Tempo) + "}\n")
+		}
+		for _, n := range bar.NavigationAt(true) {
+			pr.sb.WriteString("{comment: " + n.Text() + "}\n")
+		}
+		if bar.BarNote != "" {
+			pr.sb.WriteString("{comment: " + bar.BarNote + "}\n")
+		}
+		for _, n := range bar.NavigationAt(false) {
+			pr.sb.WriteString("{comment: " + n.Text() + "}\n")
+		}
+	}
+}
+
+// lyricsLine writes the lyrics of the bars with their chords spread over the words, as the chords are
+// spread over the beats of the bar.
+func (pr *printer) lyricsLine(line *domain.Line, bars [][]domain.Chord, fragments []string) {
+	parts := []string{}
+	for i, bar := range line.Bars {
+		fragment := ""
+		if i < len(fragments) {
+			fragment = fragments[i]
+		}
+		words := strings.Fields(fragment)
+		chordsAt := map[int][]string{}
+		for _, chord := range bars[i] {
+			if chord.IsPlaceholder() || chord.IsSlash() {
+				continue
+			}
+			at := 0
+			if len(words) > 0 && bar.Meter.Beats > 0 {
+				at = min(int(chord.Beat/float64(bar.Meter.Beats)*float64(len(words))), len(words)-1)
+			}
+			chordsAt[at] = append(chordsAt[at], "["+chord.Value+"]")
+		}
+		if len(words) == 0 {
+			if chords := chordsAt[0]; len(chords) > 0 {
+				parts = append(parts, strings.Join(chords, " "))
+			}
+			continue
+		}
+		for w, word := range words {
+			parts = append(parts, strings.Join(chordsAt[w], "")+word)
+		}
+	}
+	pr.sb.WriteString(strings.Join(parts, " ") + "\n")
+}
+
+// gridLine writes the bars of the line as a grid line, with a cell for each beat and the repeat counts
+// after the repeat signs. The "%" and "%%" signs are kept, grids have them too.
+func (pr *printer) gridLine(line *domain.Line) {
+	sb := strings.Builder{}
+	for i, bar := range line.Bars {
+		switch {
+		case i == 0 && bar.RepeatStart:
+			sb.WriteString("|: ")
+		case i == 0:
+			sb.WriteString("| ")
+		}
+		cells := slices.Repeat([]string{"."}, max(bar.Meter.Beats, 1))
+		for _, chord := range bar.Chords {
+			if chord.IsPlaceholder() || bar.Backtick.Value != "" {
+				continue
+			}
+			at := min(int(math.Floor(chord.Beat)), len(cells)-1)
+			if cells[at] == "." {
+				cells[at] = chord.Value
+			} else {
+				cells[at] += "~" + chord.Value
+			}
+		}
+		sb.WriteString(strings.Join(cells, " "))
+		next := i + 1
+		switch {
+		case bar.RepeatEnd && next < len(line.Bars) && line.Bars[next].RepeatStart:
+			sb.WriteString(" :|: ")
+		case bar.RepeatEnd:
+			sb.WriteString(" :| ")
+		case next < len(line.Bars) && line.Bars[next].RepeatStart:
+			sb.WriteString(" |: ")
+		case bar.DoubleBarEnd:
+			sb.WriteString(" || ")
+		default:
+			sb.WriteString(" | ")
+		}
+		if bar.RepeatEnd && bar.RepeatCount > 0 {
+			sb.WriteString("x" + strconv.Itoa(bar.RepeatCount) + " ")
+		}
+	}
+	pr.sb.WriteString(strings.TrimSuffix(sb.String(), " ") + "\n")
+}
@@ -0,0 +1,139 @@
+package chordpro
+
+import (
+	"lesheets/internal"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrint(t *testing.T) {
+	testCases := []struct {
+		desc     string
+		input    string
+		expected string
+	}{
+		{
+			desc: "front matter",
+			input: `---
+title: Amazing Grace
+artist: John Newton
+key: G
+source: Hymnal
+L: 1/8
+---
+G
+`,
+			expected: `{title: Amazing Grace}
+{artist: John Newton}
+{key: G}
+{meta: source Hymnal}
+{start_of_grid}
+| G . . . |
+{end_of_grid}
+
+`,
+		},
+		{
+			desc: "lyrics",
+			input: `# Verse
+
+G | G7 C | %
+> Amazing | grace, how sweet | the sound
+> That saved | a wretch | like me
+`,
+			expected: `{start_of_verse: Verse}
+[G]Amazing [G7]grace, [C]how sweet [G7]the [C]sound
+{end_of_verse}
+
+{start_of_verse: Verse}
+[G]That saved [G7]a [C]wretch [G7]like [C]me
+{end_of_verse}
+
+`,
+		},
+		{
+			desc: "grid",
+			input: `# Intro
+
+||: A | D E :||x2
+A | % ||
+`,
+			expected: `{start_of_grid: Intro}
+|: A . . . | D . E . :| x2
+| A . . . | % . . . ||
+{end_of_grid}
+
+`,
+		},
+		{
+			desc: "chorus reference",
+			input: `# Chorus
+
+C | G
+> I once | was lost
+
+# Chorus 2 = Chorus
+`,
+			expected: `{start_of_chorus: Chorus}
+[C]I once [G]was lost
+{end_of_chorus}
+
+{chorus: Chorus 2}
+
+`,
+		},
+		{
+			desc: "changes and notes",
+			input: `# Bridge
+
+"Softly" C | !key=D! !tempo=90! (3/4) D !D.C.!
+> One | two
+`,
+			expected: `{start_of_bridge: Bridge}
+{comment: Softly}
+{time: 3/4}
+{key: D}
+{tempo: 90}
+{comment: D.C.}
+[C]One [D]two
+{end_of_bridge}
+
+`,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			song, err := internal.ParseSongFromString(tC.input)
+			require.NoError(t, err)
+			assert.Equal(t, tC.expected, Print(song))
+		})
+	}
+}
+
+func TestPrintRoundTrip(t *testing.T) {
+	source := `{title: Amazing Grace}
+{key: G}
+{time: 3/4}
+{start_of_verse: Verse}
+[G]Amazing [G7]grace, how [C]sweet the [G]sound
+{end_of_verse}
+
+{start_of_chorus: Chorus}
+{comment: Riff}
+[C]I once was [G]lost but now I'm [D]found
+{end_of_chorus}
+
+{chorus: Chorus 2}
+
+{start_of_grid: Outro}
+|: A . . | D . E :| x2
+| A . . | % . . ||
+{end_of_grid}
+
+`
+	song, err := Parse(source)
+	require.NoError(t, err)
+	assert.Equal(t, source, Print(song))
+}
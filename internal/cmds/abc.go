@@ -0,0 +1,37 @@
+package cmds
+
+import (
+	"fmt"
+	"lesheets/internal"
+	"lesheets/internal/abc"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// AbcCommand writes an ABC tune for each song in the output dir, with the chords over invisible rests
+// when rests is set and over slashes otherwise.
+func AbcCommand(files []string, outputDir string, rests bool) {
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		log.Fatalf("failed to create output dir: %v", err)
+	}
+	for _, inputFile := range files {
+		_, song, err := internal.ParseSongFromFile(inputFile)
+		if err != nil {
+			log.Fatalf("error parsing song: %v", err)
+		}
+		outputFile := filepath.Join(outputDir, strings.TrimSuffix(filepath.Base(inputFile), filepath.Ext(inputFile))+".abc")
+		f, err := os.Create(outputFile)
+		if err != nil {
+			log.Fatalf("error creating %s: %v", outputFile, err)
+		}
+		if err := abc.Write(f, song, rests); err != nil {
+			log.Fatalf("error writing %s: %v", outputFile, err)
+		}
+		if err := f.Close(); err != nil {
+			log.Fatalf("error writing %s: %v", outputFile, err)
+		}
+		fmt.Printf("Writing %s to %s\n", inputFile, outputFile)
+	}
+}
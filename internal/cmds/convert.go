@@ -0,0 +1,91 @@
+package cmds
+
+import (
+	"errors"
+	"fmt"
+	"lesheets/internal"
+	"lesheets/internal/chordpro"
+	"lesheets/internal/domain"
+	"lesheets/internal/ireal"
+	"log"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+func ConvertCommand(files []string, to string) {
+	for _, inputFile := range files {
+		songs, err := readSongs(inputFile)
+		if err != nil {
+			log.Fatalf("error parsing song: %v", err)
+		}
+		for _, song := range songs {
+			convertSong(song, inputFile, to)
+		}
+	}
+}
+
+func convertSong(song *domain.Song, inputFile string, to string) {
+	var err error
+	switch to {
+	case "nashville":
+		err = song.ToNashville()
+	case "letters":
+		err = song.ToLetters()
+	case "lesheet", "chordpro", "ireal":
+	default:
+		log.Fatalf("unknown conversion %q, use -to=nashville, letters, lesheet, chordpro or ireal", to)
+	}
+	if err != nil {
+		log.Fatalf("error converting %s: %v", inputFile, err)
+	}
+	switch to {
+	case "chordpro":
+		fmt.Print(chordpro.Print(song))
+	case "ireal":
+		link, err := ireal.Encode(song)
+		if err != nil {
+			log.Fatalf("error converting %s: %v", inputFile, err)
+		}
+		fmt.Println(link)
+	default:
+		source, err := internal.PrintSource(song)
+		if err != nil {
+			log.Fatalf("error printing %s: %v", inputFile, err)
+		}
+		fmt.Print(source)
+	}
+}
+
+// readSongs reads the songs of an iReal Pro link, given in place of a file or found in an HTML page,
+// of a ChordPro file after its extension, or of a lesheet.
+func readSongs(file string) ([]*domain.Song, error) {
+	if ireal.IsLink(file) {
+		return ireal.Decode(file)
+	}
+	ext := strings.ToLower(filepath.Ext(file))
+	if ext != ".html" && ext != ".htm" && !slices.Contains(chordpro.Extensions, ext) {
+		_, song, err := internal.ParseSongFromFile(file)
+		return []*domain.Song{song}, err
+	}
+	source, err := internal.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	if slices.Contains(chordpro.Extensions, ext) {
+		song, err := chordpro.Parse(source)
+		return []*domain.Song{song}, err
+	}
+	songs := []*domain.Song{}
+	for _, link := range ireal.FindLinks(source) {
+		linked, err := ireal.Decode(link)
+		if err != nil {
+			return nil, err
+		}
+		songs = append(songs, linked...)
+	}
+	if len(songs) == 0 {
+		return nil, errors.New("no iReal Pro link in " + file)
+	}
+	return songs, nil
+}
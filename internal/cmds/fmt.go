@@ -0,0 +1,46 @@
+package cmds
+
+import (
+	"fmt"
+	"lesheets/internal"
+	"log"
+	"os"
+)
+
+// FmtCommand formats the files, printing them, writing them back or, with check, listing the ones
+// that are not formatted. It returns whether any file was not formatted.
+func FmtCommand(files []string, write bool, check bool) bool {
+	unformatted := false
+	for _, inputFile := range files {
+		sourceCode, err := internal.ReadFile(inputFile)
+		if err != nil {
+			log.Fatalf("error reading %s: %v", inputFile, err)
+		}
+		song, err := internal.ParseSongFromStringWithFileName(inputFile, sourceCode)
+		if err != nil {
+			log.Fatalf("error parsing %s: %v", inputFile, err)
+		}
+		formatted, err := internal.FormatLesheet(song)
+		if err != nil {
+			log.Fatalf("error formatting %s: %v", inputFile, err)
+		}
+		changed := formatted != sourceCode
+		unformatted = unformatted || changed
+		switch {
+		case check:
+			if changed {
+				fmt.Println(inputFile)
+			}
+		case write:
+			if changed {
+				err = os.WriteFile(inputFile, []byte(formatted), 0644)
+				if err != nil {
+					log.Fatalf("error writing %s: %v", inputFile, err)
+				}
+			}
+		default:
+			fmt.Print(formatted)
+		}
+	}
+	return unformatted
+}
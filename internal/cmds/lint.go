@@ -0,0 +1,45 @@
+package cmds
+
+import (
+	"encoding/json"
+	"fmt"
+	"lesheets/internal"
+	"lesheets/internal/domain"
+	"lesheets/internal/lint"
+	"log"
+)
+
+type fileDiagnostic struct {
+	File string `json:"file"`
+	domain.Diagnostic
+}
+
+// LintCommand checks the files and prints the problems found, as text or json. It returns whether
+// any problem was found, so that the process can exit with an error in CI.
+func LintCommand(files []string, format string) bool {
+	if format != "text" && format != "json" {
+		log.Fatalf("unknown format %q, use -format=text or -format=json", format)
+	}
+	problems := []fileDiagnostic{}
+	for _, inputFile := range files {
+		sourceCode, err := internal.ReadFile(inputFile)
+		if err != nil {
+			log.Fatalf("error reading %s: %v", inputFile, err)
+		}
+		for _, d := range lint.Lint(inputFile, sourceCode) {
+			problems = append(problems, fileDiagnostic{File: inputFile, Diagnostic: d})
+		}
+	}
+	if format == "json" {
+		j, err := json.MarshalIndent(problems, "", "  ")
+		if err != nil {
+			log.Fatalf("Error marshalling json: %v", err)
+		}
+		fmt.Println(string(j))
+	} else {
+		for _, p := range problems {
+			fmt.Println(p.File + ":" + p.Diagnostic.String())
+		}
+	}
+	return len(problems) > 0
+}
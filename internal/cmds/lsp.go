@@ -0,0 +1,16 @@
+package cmds
+
+import (
+	"lesheets/internal/lsp"
+	"log"
+	"os"
+)
+
+// LspCommand runs the language server on the standard input and output. Logs go to the standard
+// error, which editors show apart.
+func LspCommand() {
+	err := lsp.NewServer(os.Stdin, os.Stdout).Run()
+	if err != nil {
+		log.Fatalf("language server error: %v", err)
+	}
+}
@@ -13,7 +13,7 @@ func JsonCommand(files []string, outputDir string) {
 		if err != nil {
 			log.Fatalf("error parsing song: %v", err)
 		}
-		j, err := json.Marshal(song)
+		j, err := json.Marshal(song.JsonView())
 		if err != nil {
 			log.Fatalf("Error marshalling json: %v", err)
 		}
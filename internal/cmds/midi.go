@@ -0,0 +1,41 @@
+package cmds
+
+import (
+	"fmt"
+	"lesheets/internal"
+	"lesheets/internal/midi"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// MidiCommand writes a MIDI file for each song in the output dir, with the chords played in the given
+// style and a click.
+func MidiCommand(files []string, outputDir string, style string) {
+	s, err := midi.ParseStyle(style)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		log.Fatalf("failed to create output dir: %v", err)
+	}
+	for _, inputFile := range files {
+		_, song, err := internal.ParseSongFromFile(inputFile)
+		if err != nil {
+			log.Fatalf("error parsing song: %v", err)
+		}
+		outputFile := filepath.Join(outputDir, strings.TrimSuffix(filepath.Base(inputFile), filepath.Ext(inputFile))+".mid")
+		f, err := os.Create(outputFile)
+		if err != nil {
+			log.Fatalf("error creating %s: %v", outputFile, err)
+		}
+		if err := midi.Write(f, song, s); err != nil {
+			log.Fatalf("error writing %s: %v", outputFile, err)
+		}
+		if err := f.Close(); err != nil {
+			log.Fatalf("error writing %s: %v", outputFile, err)
+		}
+		fmt.Printf("Writing %s to %s\n", inputFile, outputFile)
+	}
+}
@@ -0,0 +1,36 @@
+package cmds
+
+import (
+	"fmt"
+	"lesheets/internal"
+	"lesheets/internal/musicxml"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// MusicXMLCommand writes a MusicXML score for each song in the output dir.
+func MusicXMLCommand(files []string, outputDir string) {
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		log.Fatalf("failed to create output dir: %v", err)
+	}
+	for _, inputFile := range files {
+		_, song, err := internal.ParseSongFromFile(inputFile)
+		if err != nil {
+			log.Fatalf("error parsing song: %v", err)
+		}
+		outputFile := filepath.Join(outputDir, strings.TrimSuffix(filepath.Base(inputFile), filepath.Ext(inputFile))+".musicxml")
+		f, err := os.Create(outputFile)
+		if err != nil {
+			log.Fatalf("error creating %s: %v", outputFile, err)
+		}
+		if err := musicxml.Write(f, song); err != nil {
+			log.Fatalf("error writing %s: %v", outputFile, err)
+		}
+		if err := f.Close(); err != nil {
+			log.Fatalf("error writing %s: %v", outputFile, err)
+		}
+		fmt.Printf("Writing %s to %s\n", inputFile, outputFile)
+	}
+}
@@ -0,0 +1,29 @@
+package cmds
+
+import (
+	"fmt"
+	"lesheets/internal"
+	"log"
+)
+
+func TransposeCommand(files []string, semitones int, toKey string) {
+	for _, inputFile := range files {
+		_, song, err := internal.ParseSongFromFile(inputFile)
+		if err != nil {
+			log.Fatalf("error parsing song: %v", err)
+		}
+		if toKey != "" {
+			err = song.TransposeTo(toKey)
+		} else {
+			err = song.Transpose(semitones)
+		}
+		if err != nil {
+			log.Fatalf("error transposing %s: %v", inputFile, err)
+		}
+		source, err := internal.PrintSource(song)
+		if err != nil {
+			log.Fatalf("error printing %s: %v", inputFile, err)
+		}
+		fmt.Print(source)
+	}
+}
@@ -0,0 +1,47 @@
+package cmds
+
+import (
+	"encoding/json"
+	"fmt"
+	"lesheets/internal"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// UnrollCommand prints the bars of the songs in the order they are played, as text or json.
+func UnrollCommand(files []string, format string) {
+	if format != "text" && format != "json" {
+		log.Fatalf("unknown format %q, use -format=text or -format=json", format)
+	}
+	for _, inputFile := range files {
+		_, song, err := internal.ParseSongFromFile(inputFile)
+		if err != nil {
+			log.Fatalf("error parsing song: %v", err)
+		}
+		unrolled := song.Unroll()
+		if format == "json" {
+			j, err := json.MarshalIndent(unrolled, "", "  ")
+			if err != nil {
+				log.Fatalf("Error marshalling json: %v", err)
+			}
+			fmt.Println(string(j))
+			continue
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		for i, bar := range unrolled.Bars {
+			chords := strings.Join(bar.Chords, " ")
+			if bar.Sounding.Backtick.Value != "" {
+				chords = "`" + bar.Sounding.Backtick.Value + "`"
+			}
+			fmt.Fprintf(w, "%d\tbar %d\t%s\t%s\t%s\n", i+1, bar.Number, bar.Section, bar.Meter, chords)
+		}
+		if err := w.Flush(); err != nil {
+			log.Fatalf("error writing: %v", err)
+		}
+		fmt.Println(inputFile + ": " + strconv.Itoa(unrolled.BarCount) + " bars played, " + strconv.Itoa(unrolled.WrittenBarCount) +
+			" written, " + strconv.FormatFloat(unrolled.QuarterNotes, 'f', -1, 64) + " quarter notes")
+	}
+}
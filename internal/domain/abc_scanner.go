@@ -0,0 +1,215 @@
+package domain
+
+import (
+	"strconv"
+	"strings"
+)
+
+// AbcTokenKind is the kind of an AbcToken.
+type AbcTokenKind int
+
+const (
+	// AbcText is text read as it is: a character of no other kind, or the rest of the fragment
+	// after a quote, a decoration or an inline field left open
+	AbcText AbcTokenKind = iota
+	// AbcField is a field on its own line, "K:Bb", or an inline field, "[K:Bb]"
+	AbcField
+	// AbcComment is a comment, up to and including the end of its line
+	AbcComment
+	// AbcQuoted is a chord symbol or an annotation between double quotes
+	AbcQuoted
+	// AbcDecoration is a decoration, "!trill!" or "+trill+"
+	AbcDecoration
+	// AbcBarLine is a bar line with its repeat signs and ending numbers, "|", ":|2", "[|" or "[1"
+	AbcBarLine
+	// AbcNote is a pitch with its accidentals and octave marks, without its length
+	AbcNote
+)
+
+// maxAbcLength bounds the terms of the lengths read by AbcScanner.Length, so that the durations
+// computed from them don't overflow.
+const maxAbcLength = 1 << 16
+
+// AbcToken is a part of an ABC fragment read by an AbcScanner.
+type AbcToken struct {
+	Kind AbcTokenKind
+	// Text is the token as written
+	Text string
+	// Value is the field without its brackets, or the text between the quotes
+	Value string
+	// Letter is the letter of a note, 0 for C to 6 for B, and Octave its octave, 4 from C to B and
+	// 5 from c to b
+	Letter, Octave int
+	// Alteration is the sharps, or the flats when negative, written before a note. Explicit tells
+	// whether an accidental is written, "=" being a natural.
+	Alteration int
+	Explicit   bool
+}
+
+// AbcScanner reads an ABC fragment token by token, for the code that rewrites it or reads its
+// notes. The lengths, ties, rhythms and the other signs are left to the caller, as AbcText tokens
+// or with Peek, Skip and Length.
+type AbcScanner struct {
+	input string
+	pos   int
+}
+
+// NewAbcScanner returns a scanner reading the fragment given from its start.
+func NewAbcScanner(abc string) *AbcScanner {
+	return &AbcScanner{input: abc}
+}
+
+// Done tells whether the whole fragment has been read.
+func (s *AbcScanner) Done() bool {
+	return s.pos >= len(s.input)
+}
+
+// Peek returns the character at the offset given from the current position, 0 past the end.
+func (s *AbcScanner) Peek(offset int) byte {
+	if s.pos+offset >= len(s.input) {
+		return 0
+	}
+	return s.input[s.pos+offset]
+}
+
+// Skip moves past the next n characters.
+func (s *AbcScanner) Skip(n int) {
+	s.pos = min(s.pos+n, len(s.input))
+}
+
+// Next reads the next token. It must not be called once the fragment is Done.
+func (s *AbcScanner) Next() AbcToken {
+	start := s.pos
+	ch := s.input[s.pos]
+	switch {
+	case (s.pos == 0 || s.input[s.pos-1] == '\n') && isAbcFieldName(ch) && s.Peek(1) == ':':
+		end := strings.IndexByte(s.input[s.pos:], '\n')
+		if end < 0 {
+			end = len(s.input) - s.pos
+		}
+		s.pos += end
+		return AbcToken{Kind: AbcField, Text: s.input[start:s.pos], Value: s.input[start:s.pos]}
+	case ch == '[' && isAbcFieldName(s.Peek(1)) && s.Peek(2) == ':':
+		return s.closed(AbcField, ']')
+	case ch == '%':
+		s.skipPast('\n')
+		return AbcToken{Kind: AbcComment, Text: s.input[start:s.pos]}
+	case ch == '"':
+		return s.closed(AbcQuoted, '"')
+	case ch == '!' || ch == '+':
+		return s.closed(AbcDecoration, ch)
+	case ch == '|' || (ch == '[' && (s.Peek(1) == '|' || isDigit(s.Peek(1)))) || (ch == ':' && (s.Peek(1) == '|' || s.Peek(1) == ':')):
+		s.pos++
+		for !s.Done() {
+			c := s.input[s.pos]
+			if strings.IndexByte("|:]0123456789,-", c) < 0 && (c != '[' || (s.Peek(1) != '|' && !isDigit(s.Peek(1)))) {
+				break
+			}
+			s.pos++
+		}
+		return AbcToken{Kind: AbcBarLine, Text: s.input[start:s.pos]}
+	case strings.IndexByte("^_=ABCDEFGabcdefg", ch) >= 0:
+		return s.note()
+	}
+	s.pos++
+	return AbcToken{Kind: AbcText, Text: s.input[start:s.pos]}
+}
+
+func isAbcFieldName(ch byte) bool {
+	return (ch >= 'A' && ch <= 'Z') || strings.IndexByte("mrsw", ch) >= 0
+}
+
+func isDigit(ch byte) bool {
+	return ch >= '0' && ch <= '9'
+}
+
+// skipPast moves past the given delimiter, or to the end when there is none, and tells whether it
+// was found.
+func (s *AbcScanner) skipPast(delimiter byte) bool {
+	end := strings.IndexByte(s.input[s.pos+1:], delimiter)
+	if end < 0 {
+		s.pos = len(s.input)
+		return false
+	}
+	s.pos += end + 2
+	return true
+}
+
+// closed reads a token ending with the delimiter given, as text when it's left open.
+func (s *AbcScanner) closed(kind AbcTokenKind, delimiter byte) AbcToken {
+	start := s.pos
+	if !s.skipPast(delimiter) {
+		return AbcToken{Kind: AbcText, Text: s.input[start:]}
+	}
+	text := s.input[start:s.pos]
+	return AbcToken{Kind: kind, Text: text, Value: text[1 : len(text)-1]}
+}
+
+// note reads a pitch with its accidentals and octave marks, or the accidentals alone as text when
+// no letter follows them.
+func (s *AbcScanner) note() AbcToken {
+	start := s.pos
+	tok := AbcToken{Kind: AbcNote, Octave: 4}
+	for !s.Done() && strings.IndexByte("^_=", s.input[s.pos]) >= 0 {
+		switch s.input[s.pos] {
+		case '^':
+			tok.Alteration++
+		case '_':
+			tok.Alteration--
+		}
+		tok.Explicit = true
+		s.pos++
+	}
+	if s.Done() || strings.IndexByte("ABCDEFGabcdefg", s.input[s.pos]) < 0 {
+		return AbcToken{Kind: AbcText, Text: s.input[start:s.pos]}
+	}
+	tok.Letter = strings.IndexByte(noteLetters, strings.ToUpper(s.input[s.pos : s.pos+1])[0])
+	if s.input[s.pos] >= 'a' {
+		tok.Octave = 5
+	}
+	s.pos++
+	for !s.Done() && (s.input[s.pos] == ',' || s.input[s.pos] == '\'') {
+		if s.input[s.pos] == ',' {
+			tok.Octave--
+		} else {
+			tok.Octave++
+		}
+		s.pos++
+	}
+	tok.Text = s.input[start:s.pos]
+	return tok
+}
+
+// Length reads the length written after a note, a rest or a chord, "2", "3/2" or "/", as a fraction
+// of the unit note length: 1/1 when none is written. Both terms are at most 65536.
+func (s *AbcScanner) Length() (int, int) {
+	num, den := 1, 1
+	if digits := s.digits(); digits != "" {
+		num = lengthTerm(digits)
+	}
+	for s.Peek(0) == '/' {
+		s.pos++
+		d := 2
+		if digits := s.digits(); digits != "" {
+			d = max(lengthTerm(digits), 1)
+		}
+		den = min(den*d, maxAbcLength)
+	}
+	return num, den
+}
+
+func (s *AbcScanner) digits() string {
+	start := s.pos
+	for isDigit(s.Peek(0)) {
+		s.pos++
+	}
+	return s.input[start:s.pos]
+}
+
+func lengthTerm(digits string) int {
+	n, err := strconv.Atoi(digits)
+	if err != nil {
+		return maxAbcLength
+	}
+	return min(n, maxAbcLength)
+}
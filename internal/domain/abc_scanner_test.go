@@ -0,0 +1,66 @@
+package domain
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAbcScanner(t *testing.T) {
+	testCases := []struct {
+		desc  string
+		abc   string
+		kinds []AbcTokenKind
+		texts []string
+	}{
+		{
+			desc:  "fields",
+			abc:   "K:G\nC[M:3/4]",
+			kinds: []AbcTokenKind{AbcField, AbcText, AbcNote, AbcField},
+			texts: []string{"K:G", "\n", "C", "[M:3/4]"},
+		},
+		{
+			desc:  "bar lines",
+			abc:   "C|:D:|2E[|F|[G][1A",
+			kinds: []AbcTokenKind{AbcNote, AbcBarLine, AbcNote, AbcBarLine, AbcNote, AbcBarLine, AbcNote, AbcBarLine, AbcText, AbcNote, AbcText, AbcBarLine, AbcNote},
+			texts: []string{"C", "|:", "D", ":|2", "E", "[|", "F", "|", "[", "G", "]", "[1", "A"},
+		},
+		{
+			desc:  "quotes, decorations and comments",
+			abc:   "\"Am\"!trill!A+fermata+ % C\nB",
+			kinds: []AbcTokenKind{AbcQuoted, AbcDecoration, AbcNote, AbcDecoration, AbcText, AbcComment, AbcNote},
+			texts: []string{"\"Am\"", "!trill!", "A", "+fermata+", " ", "% C\n", "B"},
+		},
+		{
+			desc:  "left open",
+			abc:   "^ \"Am",
+			kinds: []AbcTokenKind{AbcText, AbcText, AbcText},
+			texts: []string{"^", " ", "\"Am"},
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			kinds, texts := []AbcTokenKind{}, []string{}
+			for s := NewAbcScanner(tC.abc); !s.Done(); {
+				tok := s.Next()
+				kinds = append(kinds, tok.Kind)
+				texts = append(texts, tok.Text)
+			}
+			assert.Equal(t, tC.kinds, kinds)
+			assert.Equal(t, tC.texts, texts)
+		})
+	}
+}
+
+func TestAbcScannerNotes(t *testing.T) {
+	s := NewAbcScanner("^^f'3/2_B,,=c")
+	tok := s.Next()
+	assert.Equal(t, AbcToken{Kind: AbcNote, Text: "^^f'", Letter: 3, Octave: 6, Alteration: 2, Explicit: true}, tok)
+	num, den := s.Length()
+	assert.Equal(t, []int{3, 2}, []int{num, den})
+	assert.Equal(t, AbcToken{Kind: AbcNote, Text: "_B,,", Letter: 6, Octave: 2, Alteration: -1, Explicit: true}, s.Next())
+	num, den = s.Length()
+	assert.Equal(t, []int{1, 1}, []int{num, den})
+	assert.Equal(t, AbcToken{Kind: AbcNote, Text: "=c", Letter: 0, Octave: 5, Explicit: true}, s.Next())
+	assert.True(t, s.Done())
+}
@@ -0,0 +1,279 @@
+package domain
+
+import (
+	"strings"
+	"unicode"
+)
+
+// abcTransposer rewrites an ABC fragment: note pitches, quoted chord symbols and K: fields.
+type abcTransposer struct {
+	t      *Transposer
+	chords *Transposer
+	out    strings.Builder
+	input  string
+	// signatures of the current key, as the alteration of each letter, before and after transposing
+	fromSignature [7]int
+	toSignature   [7]int
+	// accidentals written in the current bar, by letter and octave
+	fromBar map[int]int
+	toBar   map[int]int
+	steps   int
+	// unreadable is set after a K: field with a key that can't be read, the notes are left as they
+	// are up to the next key
+	unreadable bool
+}
+
+// Abc transposes an ABC fragment. Fragments without a K: field are read without key signature, as
+// inline backticks are rendered.
+func (t *Transposer) Abc(abc string) string {
+	a := &abcTransposer{
+		t:       t,
+		chords:  t,
+		input:   abc,
+		fromBar: map[int]int{},
+		toBar:   map[int]int{},
+	}
+	a.steps = letterSteps(t.From, t.To, t.Semitones)
+	a.transpose()
+	return a.out.String()
+}
+
+// letterSteps returns how many letters a note moves, e.g. 1 from C to D or Db.
+func letterSteps(from *Key, to *Key, semitones int) int {
+	var steps int
+	if from != nil && to != nil {
+		steps = mod7(strings.Index(noteLetters, to.Root.Letter) - strings.Index(noteLetters, from.Root.Letter))
+	} else {
+		steps = strings.Index(noteLetters, majorKeyNames[mod12(semitones)][:1])
+	}
+	if semitones < 0 && steps > 0 {
+		steps -= 7
+	}
+	return steps
+}
+
+// signature returns the alteration of each letter (C to B) in the key.
+func signature(k *Key) [7]int {
+	sig := [7]int{}
+	if k == nil {
+		return sig
+	}
+	major := *k
+	if k.Minor {
+		// the natural minor uses the signature of its relative major
+		major = Key{Root: moveRoot(k.Root, 2, 3)}
+	}
+	tonic := strings.Index(noteLetters, major.Root.Letter)
+	for d := 0; d < 7; d++ {
+		letter := mod7(tonic + d)
+		pc := major.PitchClass() + majorScale[d]
+		sig[letter] = mod12(pc-majorScale[letter]+6) - 6
+	}
+	return sig
+}
+
+// moveRoot returns the letter root the given letters and semitones away, "Eb" for C, 2 and 3.
+func moveRoot(r ChordRoot, steps int, semitones int) ChordRoot {
+	letter := noteLetters[mod7(strings.Index(noteLetters, r.Letter)+steps)]
+	alteration := mod12(r.PitchClass()+semitones-letterPitchClass(letter)+6) - 6
+	return ChordRoot{Letter: string(letter), Accidental: accidentalName(alteration)}
+}
+
+func accidentalName(alteration int) string {
+	switch alteration {
+	case 1:
+		return "#"
+	case -1:
+		return "b"
+	}
+	return ""
+}
+
+func (a *abcTransposer) transpose() {
+	s := NewAbcScanner(a.input)
+	for !s.Done() {
+		tok := s.Next()
+		switch tok.Kind {
+		case AbcField:
+			if tok.Text == tok.Value {
+				a.field(tok.Value)
+			} else {
+				a.out.WriteString("[")
+				a.field(tok.Value)
+				a.out.WriteString("]")
+			}
+		case AbcQuoted:
+			// Annotations ("^text", "<text", ...) are left untouched by Chord
+			a.out.WriteString(`"`)
+			a.out.WriteString(a.chords.Chord(tok.Value))
+			a.out.WriteString(`"`)
+		case AbcBarLine:
+			clear(a.fromBar)
+			clear(a.toBar)
+			a.out.WriteString(tok.Text)
+		case AbcNote:
+			a.note(tok)
+		default:
+			a.out.WriteString(tok.Text)
+		}
+	}
+}
+
+// abcModes are the modes of a K: field by the first three letters of their name, any case, as the
+// degree of the major scale they start on.
+var abcModes = map[string]int{"maj": 0, "ion": 0, "dor": 1, "phr": 2, "lyd": 3, "mix": 4, "aeo": 5, "min": 5, "m": 5, "loc": 6}
+
+// abcKey is the key of a K: field, "Dmix" or "A minor clef=bass".
+type abcKey struct {
+	tonic ChordRoot
+	// degree is the degree of the major scale the mode starts on, 0 for major and 5 for minor
+	degree int
+	// suffix is the text after the tonic as written, the mode and the clef
+	suffix string
+}
+
+// parseAbcKey reads the value of a K: field. The mode is written right after the tonic or after a
+// space, the words that are not modes are kept in the suffix, like "clef=bass". It fails when the
+// value doesn't start with a tonic, or when letters that are not a mode follow the tonic.
+func parseAbcKey(value string) (abcKey, bool) {
+	if value == "" || value[0] < 'A' || value[0] > 'G' {
+		return abcKey{}, false
+	}
+	key := abcKey{tonic: ChordRoot{Letter: value[:1]}}
+	n := 1
+	if n < len(value) && (value[n] == '#' || value[n] == 'b') {
+		key.tonic.Accidental = value[n : n+1]
+		n++
+	}
+	key.suffix = value[n:]
+	word := strings.TrimLeft(key.suffix, " ")
+	end := strings.IndexFunc(word, func(r rune) bool { return !unicode.IsLetter(r) })
+	if end < 0 {
+		end = len(word)
+	}
+	if end == 0 || (end < len(word) && word[end] == '=') {
+		return key, true
+	}
+	mode := strings.ToLower(word[:end])
+	degree, ok := abcModes[mode[:min(3, len(mode))]]
+	if !ok && word == key.suffix {
+		return abcKey{}, false
+	}
+	key.degree = degree
+	return key, true
+}
+
+// signatureKey returns the key itself for the major and minor modes, or the major key with the same
+// signature for the others.
+func (k abcKey) signatureKey() Key {
+	switch k.degree {
+	case 0:
+		return Key{Root: k.tonic}
+	case 5:
+		return Key{Root: k.tonic, Minor: true}
+	}
+	return Key{Root: moveRoot(k.tonic, -k.degree, -majorScale[k.degree])}
+}
+
+// AbcKeySignature returns the key setting the signature of a K: field value, "Dmix" being G major,
+// see parseAbcKey. It fails when the value has no key that can be read.
+func AbcKeySignature(value string) (*Key, bool) {
+	key, ok := parseAbcKey(strings.TrimSpace(value))
+	if !ok {
+		return nil, false
+	}
+	signature := key.signatureKey()
+	return &signature, true
+}
+
+// in returns the K: field value of the mode in the key given by its signatureKey.
+func (k abcKey) in(key Key) string {
+	tonic := key.Root
+	if k.degree != 0 && k.degree != 5 {
+		tonic = moveRoot(key.Root, k.degree, majorScale[k.degree])
+	}
+	return tonic.String() + k.suffix
+}
+
+// field writes a header or inline field like "K:Bb", transposing it when it's a key. After a key that
+// can't be read the notes are left as they are, "K:none" has no signature and a K: field with a clef
+// only keeps the key.
+func (a *abcTransposer) field(field string) {
+	if !strings.HasPrefix(field, "K:") {
+		a.out.WriteString(field)
+		return
+	}
+	value := strings.TrimLeft(field[2:], " ")
+	first, _, _ := strings.Cut(value, " ")
+	key, ok := parseAbcKey(value)
+	if !ok {
+		a.out.WriteString(field)
+		switch {
+		case first == "none":
+			a.unreadable = false
+			a.chords = a.t
+			a.steps = letterSteps(a.t.From, a.t.To, a.t.Semitones)
+			a.fromSignature, a.toSignature = [7]int{}, [7]int{}
+		case first != "" && !strings.Contains(first, "="):
+			a.unreadable = true
+		}
+		return
+	}
+	from := key.signatureKey()
+	to := from.Transpose(a.t.Semitones)
+	if a.t.From != nil && a.t.To != nil && from.PitchClass() == a.t.From.PitchClass() && from.Minor == a.t.From.Minor {
+		to = *a.t.To
+	}
+	a.unreadable = false
+	a.chords = &Transposer{Semitones: a.t.Semitones, From: &from, To: &to}
+	a.steps = letterSteps(&from, &to, a.t.Semitones)
+	a.fromSignature = signature(&from)
+	a.toSignature = signature(&to)
+
+	a.out.WriteString(field[:len(field)-len(value)])
+	a.out.WriteString(key.in(to))
+}
+
+func (a *abcTransposer) note(tok AbcToken) {
+	if a.unreadable {
+		a.out.WriteString(tok.Text)
+		return
+	}
+	letter, octave, alteration, explicit := tok.Letter, tok.Octave, tok.Alteration, tok.Explicit
+	diatonic := octave*7 + letter
+	if explicit {
+		a.fromBar[diatonic] = alteration
+	} else if alt, ok := a.fromBar[diatonic]; ok {
+		alteration = alt
+	} else {
+		alteration = a.fromSignature[letter]
+	}
+	pitch := octave*12 + majorScale[letter] + alteration + a.t.Semitones
+
+	diatonic += a.steps
+	letter, octave = mod7(diatonic), (diatonic-mod7(diatonic))/7
+	alteration = pitch - octave*12 - majorScale[letter]
+
+	expected, ok := a.toBar[diatonic]
+	if !ok {
+		expected = a.toSignature[letter]
+	}
+	if explicit || alteration != expected {
+		a.toBar[diatonic] = alteration
+		switch {
+		case alteration > 0:
+			a.out.WriteString(strings.Repeat("^", alteration))
+		case alteration < 0:
+			a.out.WriteString(strings.Repeat("_", -alteration))
+		default:
+			a.out.WriteString("=")
+		}
+	}
+	if octave >= 5 {
+		a.out.WriteString(strings.ToLower(noteLetters[letter : letter+1]))
+		a.out.WriteString(strings.Repeat("'", octave-5))
+	} else {
+		a.out.WriteByte(noteLetters[letter])
+		a.out.WriteString(strings.Repeat(",", 4-octave))
+	}
+}
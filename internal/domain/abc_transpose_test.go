@@ -0,0 +1,73 @@
+package domain
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTransposeAbc(t *testing.T) {
+	testCases := []struct {
+		name      string
+		key       string
+		semitones int
+		in        string
+		out       string
+	}{
+		{name: "inline notes and chords", key: "Cm", semitones: 2, in: `"Cm" F2"Bb"F2z2"Ab"F2 z8`, out: `"Dm" G2"C"G2z2"Bb"G2 z8`},
+		{name: "accidentals", key: "C", semitones: 1, in: `C^CD _E=E`, out: `_D=D_E _F=F`},
+		{name: "accidentals carry through the bar", key: "C", semitones: 2, in: `^F F | F`, out: `^G G | G`},
+		{name: "octaves", key: "C", semitones: 5, in: `G, g b'`, out: `C c' e''`},
+		{name: "down", key: "D", semitones: -2, in: `D,d`, out: `C,c`},
+		{name: "decorations and annotations", key: "C", semitones: 2, in: `!marcato!A2 "^push"C +fermata+E`, out: `!marcato!B2 "^push"D +fermata+^F`},
+		{name: "voltas and inline fields", key: "C", semitones: 2, in: `[1 "G7"G2 [M:3/4] [K:Bb] B :|[2 c`, out: `[1 "A7"A2 [M:3/4] [K:C] c :|[2 d`},
+		{name: "no key in the song", key: "", semitones: 3, in: `"C"C`, out: `"Eb"_E`},
+		{
+			name:      "multiline with key signature",
+			key:       "Bb",
+			semitones: 2,
+			in:        "X:1\nM:4/4\nK:Bb\nL:1/16\n% a comment with C D\n\"Cmaj7\"z8 CDEF GABc | B_B=B B |",
+			out:       "X:1\nM:4/4\nK:C\nL:1/16\n% a comment with C D\n\"Dmaj7\"z8 DEFG ABcd | c=c^c c |",
+		},
+		{
+			name:      "key field with clef",
+			key:       "",
+			semitones: 3,
+			in:        "K:Am clef=bass\nA,=G,",
+			out:       "K:Cm clef=bass\nC_B,",
+		},
+		{name: "mixolydian", key: "", semitones: 2, in: "K:Dmix\nDEFG|", out: "K:Emix\nEFGA|"},
+		{name: "dorian", key: "", semitones: -2, in: "K:Ddor\nDEFc|", out: "K:Cdor\nCDEB|"},
+		{name: "long major", key: "", semitones: 1, in: "K:Amaj\nAcE|", out: "K:Bbmaj\nBdF|"},
+		{name: "minor with a space", key: "", semitones: 3, in: "K:A minor\nAcE", out: "K:C minor\nceG"},
+		{name: "mode in capitals", key: "", semitones: 2, in: "K:G Lydian clef=treble\nGc", out: "K:A Lydian clef=treble\nAd"},
+		{name: "mode of the song key", key: "G", semitones: 2, in: "K:D Mix\n\"D\"D=F", out: "K:E Mix\n\"E\"E=G"},
+		{name: "clef only", key: "C", semitones: 2, in: "K:G\n[K:clef=bass]F", out: "K:A\n[K:clef=bass]G"},
+		{name: "no key signature", key: "C", semitones: 2, in: "K:G\nF[K:none]F", out: "K:A\nG[K:none]G"},
+		{name: "unreadable key", key: "C", semitones: 2, in: "K:Hp\n\"C\"DEF[K:C]C", out: "K:Hp\n\"D\"DEF[K:D]D"},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.name, func(t *testing.T) {
+			var key *Key
+			if tC.key != "" {
+				k, err := ParseKey(tC.key)
+				assert.NoError(t, err)
+				key = k
+			}
+			assert.Equal(t, tC.out, NewTransposer(key, tC.semitones).Abc(tC.in))
+		})
+	}
+}
+
+func TestSongTransposeBackticks(t *testing.T) {
+	song := Song{
+		FrontMatter: map[string]string{"key": "C"},
+		Sections: []Section{{Lines: []Line{
+			{Bars: []Bar{{Backtick: Backtick{Value: `"C"C2 "G7"B,2`}}}},
+			{MultilineBacktick: MultilineBacktick{Value: "X:1\nK:C\n\"Am\"A4|\n"}},
+		}}},
+	}
+	assert.NoError(t, song.Transpose(7))
+	assert.Equal(t, `"G"G2 "D7"^F2`, song.Sections[0].Lines[0].Bars[0].Backtick.Value)
+	assert.Equal(t, "X:1\nK:G\n\"Em\"e4|\n", song.Sections[0].Lines[1].MultilineBacktick.Value)
+}
@@ -7,11 +7,13 @@ type MultilineBacktick struct {
 	Id            int    `json:"id"`
 	DefaultLength string `json:"default_length"`
 	SourceFile    string `json:"source_file"`
+	Span          Span   `json:"span"`
 }
 type Backtick struct {
 	Id            int    `json:"id"`
 	Value         string `json:"value"`
 	DefaultLength string `json:"default_length"`
+	Span          Span   `json:"span"`
 }
 
 func (mb *MultilineBacktick) Svg() string {
@@ -1,17 +1,35 @@
 package domain
 
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
 type Bar struct {
-	Tokens               []Token  `json:"-"` // chords, symbols, annotations, backticks
-	Chords               []Chord  `json:"chords"`
-	Backtick             Backtick `json:"backtick"`
-	Type                 string   `json:"type"`
-	RepeatEnd            bool     `json:"repeat_end"`
-	RepeatStart          bool     `json:"repeat_start"`
-	DoubleBarEnd         bool     `json:"double_bar_end"`
-	BarNote              string   `json:"bar_note"`
-	Lyrics               string   `json:"lyrics"`
-	Id                   int      `json:"id"`
-	PreviousWasRepeatEnd bool     `json:"-"`
+	Tokens               []Token      `json:"-"` // chords, symbols, annotations, backticks
+	Chords               []Chord      `json:"chords"`
+	Backtick             Backtick     `json:"backtick"`
+	Type                 string       `json:"type"`
+	RepeatEnd            bool         `json:"repeat_end"`
+	RepeatCount          int          `json:"repeat_count"` // times the repeat is played, 0 when not written
+	RepeatStart          bool         `json:"repeat_start"`
+	DoubleBarEnd         bool         `json:"double_bar_end"`
+	BarNote              string       `json:"bar_note"`
+	Ending               *Ending      `json:"ending"`       // the first, second... ending the bar belongs to
+	EndingStart          bool         `json:"ending_start"` // the bar starts the bracket of its ending
+	Navigation           []Navigation `json:"navigation"`   // segno, coda, D.S. al Coda...
+	Meter                Meter        `json:"meter"`        // the time signature of the bar
+	MeterChange          bool         `json:"meter_change"` // the meter is written on this bar
+	Key                  string       `json:"key"`          // the key in effect, "" when the song has none
+	KeyChange            bool         `json:"key_change"`   // the key is written on this bar
+	Tempo                int          `json:"tempo"`        // the tempo in effect in bpm, 0 when unknown
+	TempoChange          bool         `json:"tempo_change"` // the tempo is written on this bar
+	Lyrics               string       `json:"lyrics"`
+	Reused               bool         `json:"reused"` // copied from the section reused by its section
+	Id                   int          `json:"id"`
+	PreviousWasRepeatEnd bool         `json:"-"`
+	Span                 Span         `json:"span"`
 }
 
 func (bar *Bar) Number() int {
@@ -23,3 +41,102 @@ func (bar *Bar) IsEmpty() bool {
 		(len(bar.Chords) == 1 && bar.Chords[0].Value == "")
 	return emptyChords && bar.Backtick.Value == "" && bar.BarNote == ""
 }
+
+// RepeatedBars tells how many bars before this one it repeats: 1 for a "%" bar, 2 for a "%%" bar and
+// 0 for the rest. A "%%" bar and the bar after it repeat the two bars before them.
+func (bar *Bar) RepeatedBars() int {
+	if len(bar.Chords) != 1 {
+		return 0
+	}
+	switch bar.Chords[0].Kind() {
+	case KindRepeatBar:
+		return 1
+	case KindRepeatTwoBars:
+		return 2
+	}
+	return 0
+}
+
+// PlaceBeats spreads the chords of the bar evenly over the beats of its meter: every chord, "." and
+// "/" takes the same share. A chord or a slash sounds until the next one, the dots after it lengthen
+// it and have no duration of their own.
+func (bar *Bar) PlaceBeats() {
+	if len(bar.Chords) == 0 {
+		return
+	}
+	slot := float64(bar.Meter.Beats) / float64(len(bar.Chords))
+	var sounding *Chord
+	for i := range bar.Chords {
+		chord := &bar.Chords[i]
+		chord.Beat = float64(i) * slot
+		if chord.IsPlaceholder() {
+			chord.Duration = 0
+			if sounding != nil {
+				sounding.Duration += slot
+			}
+			continue
+		}
+		chord.Duration = slot
+		sounding = chord
+	}
+}
+
+// MaxPass is the highest pass of a repeat: a repeat is played at most MaxPass times.
+const MaxPass = 99
+
+// Ending is a volta bracket over the bars played only on some passes of a repeat, written [1, [2,
+// [1,2 or [1-3 before the first bar.
+type Ending struct {
+	Label  string      `json:"label"`
+	Passes []PassRange `json:"passes"`
+}
+
+// PassRange is the passes from First to Last of an ending, both included: "1" is 1-1 and "1-3" is 1-3.
+type PassRange struct {
+	First int `json:"first"`
+	Last  int `json:"last"`
+}
+
+// ParseEnding reads the passes of an ending label like "1", "1,2" or "1-3".
+func ParseEnding(label string) (*Ending, error) {
+	ending := &Ending{Label: label, Passes: []PassRange{}}
+	for _, part := range strings.Split(label, ",") {
+		first, last, isRange := strings.Cut(part, "-")
+		from, err := strconv.Atoi(first)
+		if err != nil || from < 1 {
+			return nil, errors.New("invalid ending \"[" + label + "\": expected pass numbers like [1, [1,2 or [1-3")
+		}
+		to := from
+		if isRange {
+			to, err = strconv.Atoi(last)
+			if err != nil || to < from {
+				return nil, errors.New("invalid ending \"[" + label + "\": expected pass numbers like [1, [1,2 or [1-3")
+			}
+		}
+		if to > MaxPass {
+			return nil, errors.New("invalid ending \"[" + label + "\": a repeat is played at most " +
+				strconv.Itoa(MaxPass) + " times")
+		}
+		ending.Passes = append(ending.Passes, PassRange{First: from, Last: to})
+	}
+	return ending, nil
+}
+
+// Plays tells whether the ending is played on the given pass of its repeat, counting from 1.
+func (e *Ending) Plays(pass int) bool {
+	for _, r := range e.Passes {
+		if pass >= r.First && pass <= r.Last {
+			return true
+		}
+	}
+	return false
+}
+
+// LastPass is the highest pass the ending is played on.
+func (e *Ending) LastPass() int {
+	last := 0
+	for _, r := range e.Passes {
+		last = max(last, r.Last)
+	}
+	return last
+}
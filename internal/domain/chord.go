@@ -2,18 +2,89 @@ package domain
 
 import (
 	"encoding/json"
+	"slices"
 )
 
 type Chord struct {
 	Value      string      `json:"value"`
 	Annotation *Annotation `json:"annotation"`
+	// Beat is where the chord starts in the bar and Duration how long it sounds, in beats of the meter
+	Beat     float64 `json:"beat"`
+	Duration float64 `json:"duration"`
+	Span     Span    `json:"span"`
 }
 
 type Annotation struct {
 	Value string `json:"value"`
 }
 
+// KnownAnnotations are the chord annotations the renderer knows how to draw.
+var KnownAnnotations = []string{"marcato", "push", "pull", "hold", "fermata", "diamond", "diamond-fermata"}
+
+// ChordKind tells what a chord value stands for: a chord symbol, a beat or a sign written in place
+// of a chord.
+type ChordKind string
+
+const (
+	KindChord         ChordKind = "chord"
+	KindPlaceholder   ChordKind = "placeholder"     // ".", holds the chord before it
+	KindSlash         ChordKind = "slash"           // "/", plays the chord before it again
+	KindRepeatBar     ChordKind = "repeat-bar"      // "%", the previous bar again
+	KindRepeatTwoBars ChordKind = "repeat-two-bars" // "%%", the two previous bars again
+	KindNoChord       ChordKind = "no-chord"        // "N.C.", silence
+)
+
+// nonChordValues are values written in place of a chord that don't name one.
+var nonChordValues = map[string]ChordKind{
+	".":    KindPlaceholder,
+	"/":    KindSlash,
+	"%":    KindRepeatBar,
+	"%%":   KindRepeatTwoBars,
+	"N.C":  KindNoChord,
+	"N.C.": KindNoChord,
+	"NC":   KindNoChord,
+}
+
+func (a *Annotation) IsKnown() bool {
+	return a.Value == "" || slices.Contains(KnownAnnotations, a.Value)
+}
+
+// Kind tells what the value of the chord stands for.
+func (chord *Chord) Kind() ChordKind {
+	if kind, ok := nonChordValues[chord.Value]; ok {
+		return kind
+	}
+	return KindChord
+}
+
+// IsChordSymbol tells whether the value names a chord, instead of being a repeat sign, a no chord or
+// a beat.
+func (chord *Chord) IsChordSymbol() bool {
+	return chord.Kind() == KindChord
+}
+
+// IsPlaceholder tells whether the chord is a "." beat, which holds the chord before it.
+func (chord *Chord) IsPlaceholder() bool {
+	return chord.Kind() == KindPlaceholder
+}
+
+// IsSlash tells whether the chord is a "/" beat, which plays the chord before it again.
+func (chord *Chord) IsSlash() bool {
+	return chord.Kind() == KindSlash
+}
+
+// ValueSpan returns the span of the chord value, without its annotation.
+func (chord *Chord) ValueSpan() Span {
+	start := chord.Span.End
+	start.Offset -= len(chord.Value)
+	start.Column -= len(chord.Value)
+	return Span{Start: start, End: chord.Span.End}
+}
+
 func (chord *Chord) PrettyPrint() string {
+	if chord.Kind() == KindNoChord {
+		return "N.C."
+	}
 	return FormatChord(chord.Value)
 }
 
@@ -21,13 +92,26 @@ func (chord *Chord) PrettyPrintHTML() string {
 	return chord.PrettyPrint()
 }
 
+// Symbol parses the chord value into its root, quality, extensions, alterations and bass.
+func (chord *Chord) Symbol() (*ChordSymbol, error) {
+	return ParseChordSymbol(chord.Value)
+}
+
 func (p Chord) MarshalJSON() ([]byte, error) {
 	type Alias Chord
+	parsed, err := p.Symbol()
+	if err != nil {
+		parsed = nil
+	}
 	return json.Marshal(&struct {
 		Alias
-		Pretty string `json:"pretty"`
+		Kind   ChordKind    `json:"kind"`
+		Pretty string       `json:"pretty"`
+		Parsed *ChordSymbol `json:"parsed"`
 	}{
 		Alias:  (Alias)(p),
+		Kind:   p.Kind(),
 		Pretty: p.PrettyPrint(),
+		Parsed: parsed,
 	})
 }
@@ -0,0 +1,312 @@
+package domain
+
+import (
+	"strconv"
+	"strings"
+)
+
+type ChordQuality string
+
+const (
+	QualityMajor          ChordQuality = "major"
+	QualityMinor          ChordQuality = "minor"
+	QualityDiminished     ChordQuality = "diminished"
+	QualityAugmented      ChordQuality = "augmented"
+	QualityHalfDiminished ChordQuality = "half-diminished"
+)
+
+// ChordRoot is either a letter (C, F#, Bb) or a Nashville degree (1, b7, #4).
+type ChordRoot struct {
+	Letter     string `json:"letter,omitempty"`
+	Degree     int    `json:"degree,omitempty"`
+	Accidental string `json:"accidental,omitempty"`
+}
+
+// ChordSymbol is the structured form of a chord like "Bbmaj7(#11)/D".
+type ChordSymbol struct {
+	Root        ChordRoot    `json:"root"`
+	Quality     ChordQuality `json:"quality"`
+	Extensions  []string     `json:"extensions"`
+	Alterations []string     `json:"alterations"`
+	Bass        *ChordRoot   `json:"bass,omitempty"`
+	// Lower is the chord under this one in a polychord, "Cmaj6/Dm7", Bass being its root.
+	Lower *ChordSymbol `json:"lower,omitempty"`
+	// Suffix is the text between the root and the bass exactly as written, so that a chord can be
+	// rewritten (e.g. transposed) without normalizing the way the author spelled it.
+	Suffix string `json:"suffix"`
+}
+
+type ChordError struct {
+	Chord  string
+	Offset int
+	Reason string
+}
+
+func (e *ChordError) Error() string {
+	return "invalid chord \"" + e.Chord + "\": " + e.Reason + " at position " + strconv.Itoa(e.Offset)
+}
+
+func (r ChordRoot) IsNashville() bool {
+	return r.Degree != 0
+}
+
+func (r ChordRoot) String() string {
+	if r.IsNashville() {
+		return r.Accidental + strconv.Itoa(r.Degree)
+	}
+	return r.Letter + r.Accidental
+}
+
+func (c *ChordSymbol) IsNashville() bool {
+	return c.Root.IsNashville()
+}
+
+func (c *ChordSymbol) String() string {
+	s := c.Root.String() + c.Suffix
+	if c.Lower != nil {
+		s += "/" + c.Lower.String()
+	} else if c.Bass != nil {
+		s += "/" + c.Bass.String()
+	}
+	return s
+}
+
+// MapRoots rewrites the root, the bass and the lower chord of a polychord with f.
+func (c *ChordSymbol) MapRoots(f func(ChordRoot) ChordRoot) {
+	c.Root = f(c.Root)
+	if c.Lower != nil {
+		c.Lower.MapRoots(f)
+		c.Bass = &c.Lower.Root
+	} else if c.Bass != nil {
+		bass := f(*c.Bass)
+		c.Bass = &bass
+	}
+}
+
+// ParseChordSymbol parses a chord written with a letter root ("F#m7b5/C") or a Nashville degree
+// ("b7sus4", "6m7", "1/3"). A slash can also add an extension, "Cmaj7/9", or put the chord over
+// another one, "Cmaj6/Dm7".
+func ParseChordSymbol(value string) (*ChordSymbol, error) {
+	p := chordScanner{input: value}
+	return p.parse()
+}
+
+type chordScanner struct {
+	input string
+	pos   int
+}
+
+func (s *chordScanner) fail(reason string) error {
+	return &ChordError{Chord: s.input, Offset: s.pos, Reason: reason}
+}
+
+func (s *chordScanner) eof() bool {
+	return s.pos >= len(s.input)
+}
+
+func (s *chordScanner) rest() string {
+	return s.input[s.pos:]
+}
+
+// accept consumes the first prefix found and returns it.
+func (s *chordScanner) accept(prefixes ...string) (string, bool) {
+	for _, p := range prefixes {
+		if strings.HasPrefix(s.rest(), p) {
+			s.pos += len(p)
+			return p, true
+		}
+	}
+	return "", false
+}
+
+func (s *chordScanner) acceptAccidental() string {
+	switch acc, _ := s.accept("#", "♯", "b", "♭"); acc {
+	case "#", "♯":
+		return "#"
+	case "b", "♭":
+		return "b"
+	}
+	return ""
+}
+
+// acceptNumber consumes one of the chord degrees that can appear as extension or alteration.
+func (s *chordScanner) acceptNumber() (string, bool) {
+	return s.accept("13", "11", "9", "7", "6", "5", "4", "2")
+}
+
+func (s *chordScanner) parseRoot() (ChordRoot, error) {
+	if s.eof() {
+		return ChordRoot{}, s.fail("missing root")
+	}
+	root := ChordRoot{}
+	ch := s.input[s.pos]
+	switch {
+	case ch >= 'A' && ch <= 'G':
+		root.Letter = string(ch)
+		s.pos++
+		root.Accidental = s.acceptAccidental()
+		return root, nil
+	default:
+		root.Accidental = s.acceptAccidental()
+		if !s.eof() && s.input[s.pos] >= '1' && s.input[s.pos] <= '7' {
+			root.Degree = int(s.input[s.pos] - '0')
+			s.pos++
+			return root, nil
+		}
+		return ChordRoot{}, s.fail("expected a note (A-G) or a degree (1-7)")
+	}
+}
+
+func (s *chordScanner) parseQuality() ChordQuality {
+	// "maj" and "M" are not qualities, they introduce a major seventh extension
+	if strings.HasPrefix(s.rest(), "maj") || strings.HasPrefix(s.rest(), "Maj") || strings.HasPrefix(s.rest(), "M") {
+		return QualityMajor
+	}
+	if _, ok := s.accept("halfdim", "ø", "Ø"); ok {
+		return QualityHalfDiminished
+	}
+	if _, ok := s.accept("dim", "°", "o"); ok {
+		return QualityDiminished
+	}
+	if _, ok := s.accept("aug", "+"); ok {
+		return QualityAugmented
+	}
+	if _, ok := s.accept("min", "mi", "m", "-"); ok {
+		return QualityMinor
+	}
+	return QualityMajor
+}
+
+// parseItem parses one extension or alteration and adds it to the chord.
+func (s *chordScanner) parseItem(chord *ChordSymbol) error {
+	if _, ok := s.accept("maj", "Maj", "MA", "M", "△", "Δ", "^"); ok {
+		n, ok := s.acceptNumber()
+		if !ok {
+			n = "7"
+		}
+		chord.Extensions = append(chord.Extensions, "maj"+n)
+		return nil
+	}
+	if _, ok := s.accept("sus"); ok {
+		n, _ := s.accept("2", "4")
+		if n == "" {
+			n = "4"
+		}
+		chord.Extensions = append(chord.Extensions, "sus"+n)
+		return nil
+	}
+	if _, ok := s.accept("add"); ok {
+		acc := s.acceptAccidental()
+		n, ok := s.acceptNumber()
+		if !ok {
+			return s.fail("expected a degree after \"add\"")
+		}
+		chord.Extensions = append(chord.Extensions, "add"+acc+n)
+		return nil
+	}
+	if _, ok := s.accept("alt"); ok {
+		chord.Alterations = append(chord.Alterations, "alt")
+		return nil
+	}
+	if acc, ok := s.accept("#", "♯", "+", "b", "♭", "-"); ok {
+		n, ok := s.acceptNumber()
+		if !ok {
+			return s.fail("expected a degree after \"" + acc + "\"")
+		}
+		switch acc {
+		case "#", "♯", "+":
+			acc = "#"
+		default:
+			acc = "b"
+		}
+		chord.Alterations = append(chord.Alterations, acc+n)
+		return nil
+	}
+	if _, ok := s.accept("6/9"); ok {
+		chord.Extensions = append(chord.Extensions, "6", "9")
+		return nil
+	}
+	if n, ok := s.acceptNumber(); ok {
+		chord.Extensions = append(chord.Extensions, n)
+		return nil
+	}
+	return s.fail("unexpected \"" + string([]rune(s.rest())[0]) + "\"")
+}
+
+func (s *chordScanner) parse() (*ChordSymbol, error) {
+	root, err := s.parseRoot()
+	if err != nil {
+		return nil, err
+	}
+	chord := &ChordSymbol{
+		Root:        root,
+		Extensions:  []string{},
+		Alterations: []string{},
+	}
+	suffixStart := s.pos
+	chord.Quality = s.parseQuality()
+
+	for !s.eof() && (s.input[s.pos] != '/' || s.slashExtension()) {
+		if s.input[s.pos] == '/' {
+			s.pos++
+		}
+		if s.input[s.pos] == '(' {
+			s.pos++
+			for !s.eof() && s.input[s.pos] != ')' {
+				if _, ok := s.accept(",", " "); ok {
+					continue
+				}
+				if err := s.parseItem(chord); err != nil {
+					return nil, err
+				}
+			}
+			if s.eof() {
+				return nil, s.fail("missing closing \")\"")
+			}
+			s.pos++
+			continue
+		}
+		if err := s.parseItem(chord); err != nil {
+			return nil, err
+		}
+	}
+	chord.Suffix = s.input[suffixStart:s.pos]
+
+	if !s.eof() {
+		s.pos++ // skip /
+		start := s.pos
+		bass, err := s.parseRoot()
+		if err != nil {
+			return nil, err
+		}
+		if bass.IsNashville() != root.IsNashville() {
+			return nil, s.fail("the bass must use the same notation as the root")
+		}
+		chord.Bass = &bass
+		if !s.eof() {
+			// A polychord, the rest is the chord under this one
+			lower := chordScanner{input: s.input, pos: start}
+			if chord.Lower, err = lower.parse(); err != nil {
+				return nil, err
+			}
+			if chord.Lower.Bass != nil {
+				return nil, &ChordError{Chord: s.input, Offset: start, Reason: "a polychord has two chords"}
+			}
+			chord.Bass = &chord.Lower.Root
+			s.pos = lower.pos
+		}
+	}
+	return chord, nil
+}
+
+// slashExtension tells whether the slash at the position adds an extension, "Cmaj7/9", rather than
+// a bass. The degrees written after it can't be read as a bass.
+func (s *chordScanner) slashExtension() bool {
+	rest := s.rest()[1:]
+	for _, n := range []string{"13", "11", "9"} {
+		if strings.HasPrefix(rest, n) {
+			return true
+		}
+	}
+	return false
+}
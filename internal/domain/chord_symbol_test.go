@@ -0,0 +1,178 @@
+package domain
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseChordSymbol(t *testing.T) {
+	testCases := []struct {
+		in          string
+		root        ChordRoot
+		quality     ChordQuality
+		extensions  []string
+		alterations []string
+		bass        *ChordRoot
+	}{
+		{in: "C", root: ChordRoot{Letter: "C"}, quality: QualityMajor, extensions: []string{}, alterations: []string{}},
+		{in: "F#min11", root: ChordRoot{Letter: "F", Accidental: "#"}, quality: QualityMinor, extensions: []string{"11"}, alterations: []string{}},
+		{in: "Bbmaj7", root: ChordRoot{Letter: "B", Accidental: "b"}, quality: QualityMajor, extensions: []string{"maj7"}, alterations: []string{}},
+		{in: "Cm(maj7)", root: ChordRoot{Letter: "C"}, quality: QualityMinor, extensions: []string{"maj7"}, alterations: []string{}},
+		{in: "Cdim7", root: ChordRoot{Letter: "C"}, quality: QualityDiminished, extensions: []string{"7"}, alterations: []string{}},
+		{in: "Ehalfdim7", root: ChordRoot{Letter: "E"}, quality: QualityHalfDiminished, extensions: []string{"7"}, alterations: []string{}},
+		{in: "Caug", root: ChordRoot{Letter: "C"}, quality: QualityAugmented, extensions: []string{}, alterations: []string{}},
+		{in: "G7b9", root: ChordRoot{Letter: "G"}, quality: QualityMajor, extensions: []string{"7"}, alterations: []string{"b9"}},
+		{in: "57(b13b9)", root: ChordRoot{Degree: 5}, quality: QualityMajor, extensions: []string{"7"}, alterations: []string{"b13", "b9"}},
+		{in: "Amaj7(#11)", root: ChordRoot{Letter: "A"}, quality: QualityMajor, extensions: []string{"maj7"}, alterations: []string{"#11"}},
+		{in: "C6/9", root: ChordRoot{Letter: "C"}, quality: QualityMajor, extensions: []string{"6", "9"}, alterations: []string{}},
+		{in: "D7sus4", root: ChordRoot{Letter: "D"}, quality: QualityMajor, extensions: []string{"7", "sus4"}, alterations: []string{}},
+		{in: "Cadd9", root: ChordRoot{Letter: "C"}, quality: QualityMajor, extensions: []string{"add9"}, alterations: []string{}},
+		{in: "G7alt", root: ChordRoot{Letter: "G"}, quality: QualityMajor, extensions: []string{"7"}, alterations: []string{"alt"}},
+		{in: "6m7", root: ChordRoot{Degree: 6}, quality: QualityMinor, extensions: []string{"7"}, alterations: []string{}},
+		{in: "b7", root: ChordRoot{Degree: 7, Accidental: "b"}, quality: QualityMajor, extensions: []string{}, alterations: []string{}},
+		{in: "1/3", root: ChordRoot{Degree: 1}, quality: QualityMajor, extensions: []string{}, alterations: []string{}, bass: &ChordRoot{Degree: 3}},
+		{in: "C/Bb", root: ChordRoot{Letter: "C"}, quality: QualityMajor, extensions: []string{}, alterations: []string{}, bass: &ChordRoot{Letter: "B", Accidental: "b"}},
+		{in: "Cmaj7/9", root: ChordRoot{Letter: "C"}, quality: QualityMajor, extensions: []string{"maj7", "9"}, alterations: []string{}},
+		{in: "CΔ7", root: ChordRoot{Letter: "C"}, quality: QualityMajor, extensions: []string{"maj7"}, alterations: []string{}},
+		{in: "Cmaj6/Dm7", root: ChordRoot{Letter: "C"}, quality: QualityMajor, extensions: []string{"maj6"}, alterations: []string{}, bass: &ChordRoot{Letter: "D"}},
+		{in: "1/2maj7", root: ChordRoot{Degree: 1}, quality: QualityMajor, extensions: []string{}, alterations: []string{}, bass: &ChordRoot{Degree: 2}},
+	}
+
+	for _, tC := range testCases {
+		t.Run(tC.in, func(t *testing.T) {
+			chord, err := ParseChordSymbol(tC.in)
+			assert.NoError(t, err)
+			assert.Equal(t, tC.root, chord.Root)
+			assert.Equal(t, tC.quality, chord.Quality)
+			assert.Equal(t, tC.extensions, chord.Extensions)
+			assert.Equal(t, tC.alterations, chord.Alterations)
+			assert.Equal(t, tC.bass, chord.Bass)
+			assert.Equal(t, tC.in, chord.String())
+		})
+	}
+}
+
+func TestParseChordSymbolErrors(t *testing.T) {
+	testCases := []struct {
+		in  string
+		err string
+	}{
+		{in: "", err: `invalid chord "": missing root at position 0`},
+		{in: "H7", err: `invalid chord "H7": expected a note (A-G) or a degree (1-7) at position 0`},
+		{in: "Cx", err: `invalid chord "Cx": unexpected "x" at position 1`},
+		{in: "C7(b9", err: `invalid chord "C7(b9": missing closing ")" at position 5`},
+		{in: "C/3", err: `invalid chord "C/3": the bass must use the same notation as the root at position 3`},
+		{in: "C/Dx", err: `invalid chord "C/Dx": unexpected "x" at position 3`},
+		{in: "C/Dm7/E", err: `invalid chord "C/Dm7/E": a polychord has two chords at position 2`},
+		{in: "C/1m7", err: `invalid chord "C/1m7": the bass must use the same notation as the root at position 3`},
+	}
+
+	for _, tC := range testCases {
+		t.Run(tC.in, func(t *testing.T) {
+			_, err := ParseChordSymbol(tC.in)
+			assert.EqualError(t, err, tC.err)
+		})
+	}
+}
+
+func TestParsePolychord(t *testing.T) {
+	chord, err := ParseChordSymbol("D7/Cmaj7(#11)")
+	assert.NoError(t, err)
+	assert.Equal(t, "7", chord.Suffix)
+	assert.Equal(t, &ChordSymbol{
+		Root:        ChordRoot{Letter: "C"},
+		Quality:     QualityMajor,
+		Extensions:  []string{"maj7"},
+		Alterations: []string{"#11"},
+		Suffix:      "maj7(#11)",
+	}, chord.Lower)
+	assert.Same(t, &chord.Lower.Root, chord.Bass)
+}
+
+func TestChordIntervals(t *testing.T) {
+	testCases := []struct {
+		in        string
+		intervals []int
+	}{
+		{in: "C", intervals: []int{0, 4, 7}},
+		{in: "Am", intervals: []int{0, 3, 7}},
+		{in: "G7", intervals: []int{0, 4, 7, 10}},
+		{in: "Cmaj7", intervals: []int{0, 4, 7, 11}},
+		{in: "Cm(maj7)", intervals: []int{0, 3, 7, 11}},
+		{in: "Dm9", intervals: []int{0, 3, 7, 10, 14}},
+		{in: "F13", intervals: []int{0, 4, 7, 10, 14, 21}},
+		{in: "Bdim7", intervals: []int{0, 3, 6, 9}},
+		{in: "Bhalfdim7", intervals: []int{0, 3, 6, 10}},
+		{in: "Caug", intervals: []int{0, 4, 8}},
+		{in: "D7sus4", intervals: []int{0, 5, 7, 10}},
+		{in: "Csus2", intervals: []int{0, 2, 7}},
+		{in: "C6/9", intervals: []int{0, 4, 7, 9, 14}},
+		{in: "Cadd9", intervals: []int{0, 4, 7, 14}},
+		{in: "E5", intervals: []int{0, 7}},
+		{in: "G7b9", intervals: []int{0, 4, 7, 10, 13}},
+		{in: "C7b5", intervals: []int{0, 4, 6, 10}},
+		{in: "Amaj7(#11)", intervals: []int{0, 4, 7, 11, 18}},
+		{in: "G7alt", intervals: []int{0, 4, 10, 13, 15, 20}},
+		{in: "57/7", intervals: []int{0, 4, 7, 10}},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.in, func(t *testing.T) {
+			chord, err := ParseChordSymbol(tC.in)
+			assert.NoError(t, err)
+			assert.Equal(t, tC.intervals, chord.Intervals())
+		})
+	}
+}
+
+func TestChordJsonIncludesParsedChord(t *testing.T) {
+	chord := Chord{Value: "Bb7/D", Annotation: &Annotation{}}
+	j, err := json.Marshal(chord)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{
+		"value": "Bb7/D",
+		"annotation": {"value": ""},
+		"kind": "chord",
+		"beat": 0,
+		"duration": 0,
+		"span": {"start": {"offset": 0, "line": 0, "column": 0}, "end": {"offset": 0, "line": 0, "column": 0}},
+		"pretty": "B♭⁷<span class=\"over\">/D</span>",
+		"parsed": {
+			"root": {"letter": "B", "accidental": "b"},
+			"quality": "major",
+			"extensions": ["7"],
+			"alterations": [],
+			"bass": {"letter": "D"},
+			"suffix": "7"
+		}
+	}`, string(j))
+}
+
+func TestChordKind(t *testing.T) {
+	testCases := []struct {
+		value string
+		kind  ChordKind
+	}{
+		{value: "Cmaj7", kind: KindChord},
+		{value: "6m7", kind: KindChord},
+		{value: ".", kind: KindPlaceholder},
+		{value: "/", kind: KindSlash},
+		{value: "%", kind: KindRepeatBar},
+		{value: "%%", kind: KindRepeatTwoBars},
+		{value: "N.C.", kind: KindNoChord},
+		{value: "NC", kind: KindNoChord},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.value, func(t *testing.T) {
+			chord := Chord{Value: tC.value}
+			assert.Equal(t, tC.kind, chord.Kind())
+		})
+	}
+}
+
+func TestBarRepeatedBars(t *testing.T) {
+	assert.Equal(t, 1, (&Bar{Chords: []Chord{{Value: "%"}}}).RepeatedBars())
+	assert.Equal(t, 2, (&Bar{Chords: []Chord{{Value: "%%"}}}).RepeatedBars())
+	assert.Equal(t, 0, (&Bar{Chords: []Chord{{Value: "C"}, {Value: "%"}}}).RepeatedBars())
+}
@@ -0,0 +1,48 @@
+package domain
+
+import "strings"
+
+type Severity string
+
+const (
+	SeverityError   Severity = "error"
+	SeverityWarning Severity = "warning"
+	SeverityInfo    Severity = "info"
+)
+
+// Diagnostic is a problem found in the source of a song.
+type Diagnostic struct {
+	Severity Severity `json:"severity"`
+	Code     string   `json:"code"`
+	Message  string   `json:"message"`
+	Span     Span     `json:"span"`
+}
+
+func (d Diagnostic) Error() string {
+	return d.Message
+}
+
+// String formats the diagnostic as "line:column: severity: message [code]".
+func (d Diagnostic) String() string {
+	return d.Span.Start.String() + ": " + string(d.Severity) + ": " + d.Message + " [" + d.Code + "]"
+}
+
+// Diagnostics is an error made of all the problems found while parsing a song.
+type Diagnostics []Diagnostic
+
+func (ds Diagnostics) Error() string {
+	messages := make([]string, len(ds))
+	for i, d := range ds {
+		messages[i] = d.Error()
+	}
+	return strings.Join(messages, "\n")
+}
+
+func (ds Diagnostics) HasErrors() bool {
+	for _, d := range ds {
+		if d.Severity == SeverityError {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,183 @@
+package domain
+
+import (
+	"errors"
+	"strings"
+)
+
+const noteLetters = "CDEFGAB"
+
+// majorScale holds the semitones from the tonic of each degree of the major scale.
+var majorScale = [7]int{0, 2, 4, 5, 7, 9, 11}
+
+var sharpNames = [12]string{"C", "C#", "D", "D#", "E", "F", "F#", "G", "G#", "A", "A#", "B"}
+var flatNames = [12]string{"C", "Db", "D", "Eb", "E", "F", "Gb", "G", "Ab", "A", "Bb", "B"}
+
+// The usual spelling of a key for each pitch class, the one with fewer accidentals.
+var majorKeyNames = [12]string{"C", "Db", "D", "Eb", "E", "F", "F#", "G", "Ab", "A", "Bb", "B"}
+var minorKeyNames = [12]string{"C", "C#", "D", "Eb", "E", "F", "F#", "G", "G#", "A", "Bb", "B"}
+
+type Key struct {
+	Root  ChordRoot
+	Minor bool
+}
+
+// ParseKey parses the key of a song, as written in the front matter ("C", "Bb", "C#m", "A minor").
+func ParseKey(value string) (*Key, error) {
+	value = strings.TrimSpace(value)
+	minor := false
+	lower := strings.ToLower(value)
+	for _, suffix := range []string{" minor", " major"} {
+		if strings.HasSuffix(lower, suffix) {
+			minor = suffix == " minor"
+			value = strings.TrimSpace(value[:len(value)-len(suffix)])
+		}
+	}
+	chord, err := ParseChordSymbol(value)
+	if err != nil {
+		return nil, errors.New("invalid key \"" + value + "\": " + err.Error())
+	}
+	if chord.IsNashville() || chord.Bass != nil || len(chord.Extensions) > 0 || len(chord.Alterations) > 0 ||
+		(chord.Quality != QualityMajor && chord.Quality != QualityMinor) {
+		return nil, errors.New("invalid key \"" + value + "\": a key is a note optionally followed by m")
+	}
+	return &Key{Root: chord.Root, Minor: minor || chord.Quality == QualityMinor}, nil
+}
+
+func (k Key) String() string {
+	if k.Minor {
+		return k.Root.String() + "m"
+	}
+	return k.Root.String()
+}
+
+func (k Key) PitchClass() int {
+	return k.Root.PitchClass()
+}
+
+// PrefersFlats tells whether chromatic notes should be spelled with flats in this key.
+func (k Key) PrefersFlats() bool {
+	if k.Root.Accidental == "b" {
+		return true
+	}
+	if k.Root.Accidental == "#" {
+		return false
+	}
+	if k.Minor {
+		return strings.Contains("DGCF", k.Root.Letter)
+	}
+	return k.Root.Letter == "F"
+}
+
+// Fifths is the number of sharps of the key signature, negative for flats: 2 for D, -3 for Cm.
+func (k Key) Fifths() int {
+	n := 0
+	for _, alteration := range signature(&k) {
+		n += alteration
+	}
+	return n
+}
+
+// Transpose returns the key a number of semitones away, spelled with the fewest accidentals.
+func (k Key) Transpose(semitones int) Key {
+	pc := mod12(k.PitchClass() + semitones)
+	name := majorKeyNames[pc]
+	if k.Minor {
+		name = minorKeyNames[pc]
+	}
+	// Both spellings have six accidentals, keep the flavour of the original key
+	if pc == 6 && !k.Minor && k.PrefersFlats() {
+		name = "Gb"
+	}
+	if pc == 3 && k.Minor && !k.PrefersFlats() {
+		name = "D#"
+	}
+	return Key{Root: rootFromName(name), Minor: k.Minor}
+}
+
+// ToDegree returns the Nashville degree of a letter root in this key. In minor keys the degrees are
+// counted from the tonic on a major scale, so 6 in C#m is A#.
+func (k Key) ToDegree(r ChordRoot) ChordRoot {
+	if r.IsNashville() {
+		return r
+	}
+	steps := mod7(strings.Index(noteLetters, r.Letter) - strings.Index(noteLetters, k.Root.Letter))
+	offset := mod12(r.PitchClass()-k.PitchClass()-majorScale[steps]+6) - 6
+	switch offset {
+	case 0:
+		return ChordRoot{Degree: steps + 1}
+	case -1:
+		return ChordRoot{Degree: steps + 1, Accidental: "b"}
+	case 1:
+		return ChordRoot{Degree: steps + 1, Accidental: "#"}
+	}
+	// Enharmonic spellings far from the key (e.g. Fb in F#), use the usual chromatic degree
+	return chromaticDegrees[mod12(r.PitchClass()-k.PitchClass())]
+}
+
+// ToLetter returns the letter root for a Nashville degree in this key.
+func (k Key) ToLetter(r ChordRoot) ChordRoot {
+	if !r.IsNashville() {
+		return r
+	}
+	letter := noteLetters[mod7(strings.Index(noteLetters, k.Root.Letter)+r.Degree-1)]
+	pc := mod12(k.PitchClass() + majorScale[r.Degree-1] + accidentalOffset(r.Accidental))
+	offset := mod12(pc-letterPitchClass(letter)+6) - 6
+	switch offset {
+	case 0:
+		return ChordRoot{Letter: string(letter)}
+	case -1:
+		return ChordRoot{Letter: string(letter), Accidental: "b"}
+	case 1:
+		return ChordRoot{Letter: string(letter), Accidental: "#"}
+	}
+	return SpellPitchClass(pc, k.PrefersFlats())
+}
+
+var chromaticDegrees = [12]ChordRoot{
+	{Degree: 1}, {Degree: 2, Accidental: "b"}, {Degree: 2}, {Degree: 3, Accidental: "b"},
+	{Degree: 3}, {Degree: 4}, {Degree: 4, Accidental: "#"}, {Degree: 5},
+	{Degree: 6, Accidental: "b"}, {Degree: 6}, {Degree: 7, Accidental: "b"}, {Degree: 7},
+}
+
+// PitchClass returns the pitch class (0 for C to 11 for B) of a letter root.
+func (r ChordRoot) PitchClass() int {
+	if r.IsNashville() || r.Letter == "" {
+		return 0
+	}
+	return mod12(letterPitchClass(r.Letter[0]) + accidentalOffset(r.Accidental))
+}
+
+// SpellPitchClass returns the root for a pitch class using sharps or flats.
+func SpellPitchClass(pc int, flats bool) ChordRoot {
+	if flats {
+		return rootFromName(flatNames[mod12(pc)])
+	}
+	return rootFromName(sharpNames[mod12(pc)])
+}
+
+func rootFromName(name string) ChordRoot {
+	return ChordRoot{Letter: name[:1], Accidental: name[1:]}
+}
+
+func letterPitchClass(letter byte) int {
+	return majorScale[strings.IndexByte(noteLetters, letter)]
+}
+
+func accidentalOffset(accidental string) int {
+	switch accidental {
+	case "#":
+		return 1
+	case "b":
+		return -1
+	}
+	return 0
+}
+
+func mod12(n int) int {
+	return ((n % 12) + 12) % 12
+}
+
+func mod7(n int) int {
+	return ((n % 7) + 7) % 7
+}
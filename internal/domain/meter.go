@@ -0,0 +1,61 @@
+package domain
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// Meter is a time signature like 4/4 or 7/8.
+type Meter struct {
+	Beats int `json:"beats"`
+	Unit  int `json:"unit"`
+}
+
+// DefaultMeter is the meter of the songs without a time in the front matter.
+var DefaultMeter = Meter{Beats: 4, Unit: 4}
+
+// MaxBeats and MaxUnit bound the meters, to the ones a MIDI time signature can hold.
+const (
+	MaxBeats = 255
+	MaxUnit  = 64
+)
+
+// ParseMeter reads a time signature written as beats/unit, the unit being a power of two. There are
+// at most MaxBeats beats and the unit is at most MaxUnit.
+func ParseMeter(value string) (Meter, error) {
+	beats, unit, ok := strings.Cut(strings.TrimSpace(value), "/")
+	b, errBeats := strconv.Atoi(strings.TrimSpace(beats))
+	u, errUnit := strconv.Atoi(strings.TrimSpace(unit))
+	if !ok || errBeats != nil || errUnit != nil || b < 1 || u < 1 || u&(u-1) != 0 {
+		return Meter{}, errors.New("invalid meter \"" + value + "\": expected beats/unit like 4/4, 3/4 or 7/8")
+	}
+	if b > MaxBeats || u > MaxUnit {
+		return Meter{}, errors.New("invalid meter \"" + value + "\": a bar has at most " + strconv.Itoa(MaxBeats) +
+			" beats and the unit is at most " + strconv.Itoa(MaxUnit))
+	}
+	return Meter{Beats: b, Unit: u}, nil
+}
+
+func (m Meter) String() string {
+	return strconv.Itoa(m.Beats) + "/" + strconv.Itoa(m.Unit)
+}
+
+// QuarterNotes is the length of a bar in quarter notes, 3.5 for 7/8.
+func (m Meter) QuarterNotes() float64 {
+	return float64(m.Beats) * 4 / float64(m.Unit)
+}
+
+// Meter returns the time signature of the front matter, or 4/4 when it has none. The error tells
+// when the time can't be read.
+func (song *Song) Meter() (Meter, error) {
+	value := song.FrontMatter["time"]
+	if strings.TrimSpace(value) == "" {
+		return DefaultMeter, nil
+	}
+	m, err := ParseMeter(value)
+	if err != nil {
+		return DefaultMeter, err
+	}
+	return m, nil
+}
@@ -0,0 +1,55 @@
+package domain
+
+import "errors"
+
+// ToNashville rewrites every letter chord as a Nashville number relative to the key of its bar, the
+// key of the song or the last key change before it.
+func (song *Song) ToNashville() error {
+	key, err := song.parsedKey("Nashville numbers")
+	if err != nil {
+		return err
+	}
+	song.mapChordsInKey(key, Key.ChordToNashville)
+	return nil
+}
+
+// ToLetters rewrites every Nashville number as a letter chord in the key of its bar.
+func (song *Song) ToLetters() error {
+	key, err := song.parsedKey("letter chords")
+	if err != nil {
+		return err
+	}
+	song.mapChordsInKey(key, Key.ChordToLetters)
+	return nil
+}
+
+// ChordToNashville writes a letter chord as a Nashville number in this key.
+func (k Key) ChordToNashville(value string) string {
+	return convertChord(value, k.ToDegree)
+}
+
+// ChordToLetters writes a Nashville number as a letter chord in this key.
+func (k Key) ChordToLetters(value string) string {
+	return convertChord(value, k.ToLetter)
+}
+
+func (song *Song) parsedKey(target string) (*Key, error) {
+	value := song.Key()
+	if value == "" {
+		return nil, errors.New("cannot convert to " + target + ": the song has no key in the front matter")
+	}
+	key, err := ParseKey(value)
+	if err != nil {
+		return nil, errors.New("cannot convert to " + target + ": " + err.Error())
+	}
+	return key, nil
+}
+
+func convertChord(value string, convertRoot func(ChordRoot) ChordRoot) string {
+	chord, err := ParseChordSymbol(value)
+	if err != nil {
+		return value
+	}
+	chord.MapRoots(convertRoot)
+	return chord.String()
+}
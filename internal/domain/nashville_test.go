@@ -0,0 +1,78 @@
+package domain
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConvertChordBetweenNashvilleAndLetters(t *testing.T) {
+	testCases := []struct {
+		key       string
+		nashville string
+		letters   string
+	}{
+		{key: "C", nashville: "1", letters: "C"},
+		{key: "C", nashville: "6m7", letters: "Am7"},
+		{key: "C", nashville: "b7", letters: "Bb"},
+		{key: "C", nashville: "1/3", letters: "C/E"},
+		{key: "C", nashville: "57(b13b9)", letters: "G7(b13b9)"},
+		{key: "C#m", nashville: "6m7", letters: "A#m7"},
+		{key: "C#m", nashville: "b7", letters: "B"},
+		{key: "C#m", nashville: "4/1", letters: "F#/C#"},
+		{key: "Eb", nashville: "2m7", letters: "Fm7"},
+		{key: "Eb", nashville: "b6", letters: "Cb"},
+		{key: "F#", nashville: "#4m7b5", letters: "B#m7b5"},
+		{key: "A", nashville: "b3", letters: "C"},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.key+"/"+tC.nashville, func(t *testing.T) {
+			key, err := ParseKey(tC.key)
+			assert.NoError(t, err)
+			assert.Equal(t, tC.letters, convertChord(tC.nashville, key.ToLetter))
+			assert.Equal(t, tC.nashville, convertChord(tC.letters, key.ToDegree))
+		})
+	}
+}
+
+func TestSongToLettersAndBack(t *testing.T) {
+	song := Song{
+		FrontMatter: map[string]string{"Key": "C#m"},
+		Sections: []Section{{Lines: []Line{{Bars: []Bar{
+			{Chords: []Chord{{Value: "6m7"}, {Value: "%"}}},
+			{Chords: []Chord{{Value: "b7"}, {Value: "1/3"}}},
+		}}}}},
+	}
+	assert.NoError(t, song.ToLetters())
+	bars := song.Sections[0].Lines[0].Bars
+	assert.Equal(t, "A#m7", bars[0].Chords[0].Value)
+	assert.Equal(t, "%", bars[0].Chords[1].Value)
+	assert.Equal(t, "B", bars[1].Chords[0].Value)
+	assert.Equal(t, "C#/E#", bars[1].Chords[1].Value)
+
+	assert.NoError(t, song.ToNashville())
+	assert.Equal(t, "6m7", bars[0].Chords[0].Value)
+	assert.Equal(t, "b7", bars[1].Chords[0].Value)
+	assert.Equal(t, "1/3", bars[1].Chords[1].Value)
+}
+
+func TestSongToNashvilleKeyChanges(t *testing.T) {
+	song := Song{
+		FrontMatter: map[string]string{"key": "C"},
+		Sections: []Section{{Lines: []Line{{Bars: []Bar{
+			{Key: "C", Chords: []Chord{{Value: "G7"}}},
+			{Key: "D", KeyChange: true, Chords: []Chord{{Value: "A7"}}},
+			{Chords: []Chord{{Value: "G"}}},
+		}}}}},
+	}
+	assert.NoError(t, song.ToNashville())
+	bars := song.Bars()
+	assert.Equal(t, "57", bars[0].Chords[0].Value)
+	assert.Equal(t, "57", bars[1].Chords[0].Value)
+	assert.Equal(t, "5", bars[2].Chords[0].Value)
+}
+
+func TestSongToNashvilleWithoutKey(t *testing.T) {
+	song := Song{}
+	assert.EqualError(t, song.ToNashville(), "cannot convert to Nashville numbers: the song has no key in the front matter")
+}
@@ -0,0 +1,97 @@
+package domain
+
+import "slices"
+
+// Navigation is a roadmap marker of a bar, written like an annotation: !segno!, !D.S.alcoda!...
+type Navigation string
+
+const (
+	Segno          Navigation = "segno"
+	Coda           Navigation = "coda"
+	Fine           Navigation = "fine"
+	ToCoda         Navigation = "tocoda"
+	DaCapo         Navigation = "D.C."
+	DaCapoAlFine   Navigation = "D.C.alfine"
+	DaCapoAlCoda   Navigation = "D.C.alcoda"
+	DalSegno       Navigation = "D.S."
+	DalSegnoAlFine Navigation = "D.S.alfine"
+	DalSegnoAlCoda Navigation = "D.S.alcoda"
+)
+
+// Navigations are the navigation markers known by the parser.
+var Navigations = []Navigation{Segno, Coda, Fine, ToCoda, DaCapo, DaCapoAlFine, DaCapoAlCoda, DalSegno, DalSegnoAlFine, DalSegnoAlCoda}
+
+// IsNavigation tells whether an annotation value is a navigation marker instead of a chord annotation.
+func IsNavigation(value string) bool {
+	return slices.Contains(Navigations, Navigation(value))
+}
+
+// IsJump tells whether the marker sends the player back, to the start or to the segno.
+func (n Navigation) IsJump() bool {
+	switch n {
+	case DaCapo, DaCapoAlFine, DaCapoAlCoda, DalSegno, DalSegnoAlFine, DalSegnoAlCoda:
+		return true
+	}
+	return false
+}
+
+// IsDalSegno tells whether the jump goes back to the segno instead of the start.
+func (n Navigation) IsDalSegno() bool {
+	return n == DalSegno || n == DalSegnoAlFine || n == DalSegnoAlCoda
+}
+
+// IsAlCoda tells whether the jump is followed up to the "To Coda", from which the coda is played.
+func (n Navigation) IsAlCoda() bool {
+	return n == DaCapoAlCoda || n == DalSegnoAlCoda
+}
+
+// AtBarStart tells whether the marker is written at the start of its bar, like the segno and the
+// coda, or at its end, like the jumps, "Fine" and "To Coda".
+func (n Navigation) AtBarStart() bool {
+	return n == Segno || n == Coda
+}
+
+// Text is the marker as written on charts, the segno and coda signs are drawn with the music font.
+func (n Navigation) Text() string {
+	switch n {
+	case Fine:
+		return "Fine"
+	case ToCoda:
+		return "To Coda"
+	case DaCapoAlFine:
+		return "D.C. al Fine"
+	case DaCapoAlCoda:
+		return "D.C. al Coda"
+	case DalSegnoAlFine:
+		return "D.S. al Fine"
+	case DalSegnoAlCoda:
+		return "D.S. al Coda"
+	}
+	return string(n)
+}
+
+// HasNavigation tells whether the bar has the given navigation marker.
+func (bar *Bar) HasNavigation(n Navigation) bool {
+	return slices.Contains(bar.Navigation, n)
+}
+
+// Jump returns the D.C. or D.S. marker of the bar, if any.
+func (bar *Bar) Jump() Navigation {
+	for _, n := range bar.Navigation {
+		if n.IsJump() {
+			return n
+		}
+	}
+	return ""
+}
+
+// NavigationAt returns the navigation markers written at the start of the bar, or at its end.
+func (bar *Bar) NavigationAt(start bool) []Navigation {
+	res := []Navigation{}
+	for _, n := range bar.Navigation {
+		if n.AtBarStart() == start {
+			res = append(res, n)
+		}
+	}
+	return res
+}
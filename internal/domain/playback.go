@@ -0,0 +1,170 @@
+package domain
+
+// Unrolled is a song expanded into the bars as they are played.
+type Unrolled struct {
+	Bars []PlayedBar `json:"bars"`
+	// BarCount is the number of bars played, WrittenBarCount the number of bars of the chart
+	BarCount        int `json:"bar_count"`
+	WrittenBarCount int `json:"written_bar_count"`
+	// QuarterNotes is the length of the song, from the meter of its bars
+	QuarterNotes float64 `json:"quarter_notes"`
+}
+
+// PlayedBar is a bar of the chart at its place in the playback order.
+type PlayedBar struct {
+	Number  int      `json:"number"` // Bar.Number() of the written bar
+	Section string   `json:"section"`
+	Chords  []string `json:"chords"`
+	Meter   Meter    `json:"meter"`
+	Key     string   `json:"key"`
+	Tempo   int      `json:"tempo"`
+	Bar     *Bar     `json:"-"`
+	// Sounding is the bar whose chords are played, the one repeated by a "%" or "%%" bar, or Bar
+	Sounding *Bar `json:"-"`
+}
+
+// Unroll expands the song following its repeats, endings and navigation markers, see PlaybackOrder.
+func (song *Song) Unroll() *Unrolled {
+	sections := map[*Bar]string{}
+	for i := range song.Sections {
+		for j := range song.Sections[i].Lines {
+			for k := range song.Sections[i].Lines[j].Bars {
+				sections[&song.Sections[i].Lines[j].Bars[k]] = song.Sections[i].Name
+			}
+		}
+	}
+	unrolled := &Unrolled{Bars: []PlayedBar{}, WrittenBarCount: len(sections)}
+	for _, bar := range song.PlaybackOrder() {
+		sounding := bar
+		// A repeat sign plays the bars played before it, which are resolved already
+		if n := bar.RepeatedBars(); n > 0 && len(unrolled.Bars) >= n {
+			sounding = unrolled.Bars[len(unrolled.Bars)-n].Sounding
+		}
+		chords := []string{}
+		for _, chord := range sounding.Chords {
+			chords = append(chords, chord.Value)
+		}
+		unrolled.Bars = append(unrolled.Bars, PlayedBar{
+			Number:   bar.Number(),
+			Section:  sections[bar],
+			Chords:   chords,
+			Meter:    bar.Meter,
+			Key:      bar.Key,
+			Tempo:    bar.Tempo,
+			Bar:      bar,
+			Sounding: sounding,
+		})
+	}
+	unrolled.BarCount = len(unrolled.Bars)
+	for _, bar := range unrolled.Bars {
+		unrolled.QuarterNotes += bar.Meter.QuarterNotes()
+	}
+	return unrolled
+}
+
+// PlaybackOrder returns the bars of the song in the order they are played: the bars between "||:"
+// and ":||" are played again, or from the start of the song when there is no "||:", and the bars of
+// an ending only on its passes. A D.C. or D.S. sends back to the start or to the segno once, without
+// the repeats, up to the "Fine" or, when it's al Coda, up to the "To Coda" and then the coda.
+func (song *Song) PlaybackOrder() []*Bar {
+	bars := song.Bars()
+	order := []*Bar{}
+	start, pass := 0, 1
+	// jump is the D.C. or D.S. taken, once
+	var jump Navigation
+	for i := 0; i < len(bars); i++ {
+		bar := bars[i]
+		if bar.RepeatStart && i != start {
+			start, pass = i, 1
+		}
+		if bar.Ending != nil && !playsEnding(bars, i, pass, jump != "") {
+			continue
+		}
+		order = append(order, bar)
+		if bar.RepeatEnd && jump == "" && pass < passes(bars, start, i) {
+			pass++
+			i = start - 1
+			continue
+		}
+		if bar.RepeatEnd {
+			start, pass = i+1, 1
+		}
+		switch {
+		case jump == "" && bar.Jump() != "":
+			jump = bar.Jump()
+			i = jumpTarget(bars, jump) - 1
+		case jump != "" && !jump.IsAlCoda() && bar.HasNavigation(Fine):
+			return order
+		case jump.IsAlCoda() && bar.HasNavigation(ToCoda):
+			coda := findNavigation(bars, i+1, Coda)
+			if coda < 0 {
+				return order
+			}
+			i = coda - 1
+		}
+	}
+	return order
+}
+
+// playsEnding tells whether the bar of an ending is played on the given pass. After a D.C. or D.S.
+// the repeats are not played again, only the last ending is.
+func playsEnding(bars []*Bar, i int, pass int, afterJump bool) bool {
+	if !afterJump {
+		return bars[i].Ending.Plays(pass)
+	}
+	for j := i + 1; j < len(bars) && bars[j].Ending != nil && !bars[j].RepeatStart; j++ {
+		if bars[j].Ending.LastPass() > bars[i].Ending.LastPass() {
+			return false
+		}
+	}
+	return true
+}
+
+// passes counts how many times the repeat from start to the repeat end at the given index is played:
+// its count, twice by default, or as many times as the endings that follow it ask for.
+func passes(bars []*Bar, start int, end int) int {
+	res := 2
+	if bars[end].RepeatCount > 0 {
+		res = bars[end].RepeatCount
+	}
+	for i := start; i < len(bars); i++ {
+		if i > end && (bars[i].Ending == nil || bars[i].RepeatStart) {
+			break
+		}
+		if bars[i].Ending != nil {
+			res = max(res, bars[i].Ending.LastPass())
+		}
+	}
+	return res
+}
+
+// jumpTarget is the index of the bar a D.C. or D.S. sends to, the start of the song when there is no
+// segno.
+func jumpTarget(bars []*Bar, jump Navigation) int {
+	if jump.IsDalSegno() {
+		return max(0, findNavigation(bars, 0, Segno))
+	}
+	return 0
+}
+
+func findNavigation(bars []*Bar, from int, n Navigation) int {
+	for i := from; i < len(bars); i++ {
+		if bars[i].HasNavigation(n) {
+			return i
+		}
+	}
+	return -1
+}
+
+// Bars returns every bar of the song, in the order they are written.
+func (song *Song) Bars() []*Bar {
+	res := []*Bar{}
+	for i := range song.Sections {
+		for j := range song.Sections[i].Lines {
+			for k := range song.Sections[i].Lines[j].Bars {
+				res = append(res, &song.Sections[i].Lines[j].Bars[k])
+			}
+		}
+	}
+	return res
+}
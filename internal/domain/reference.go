@@ -0,0 +1,152 @@
+package domain
+
+import (
+	"slices"
+	"strings"
+)
+
+// CompactReferences tells whether the sections reusing another one are shown as a "(as before)" box
+// with the bars written in them only, with "references: compact" in the front matter. They are
+// shown with all their bars otherwise.
+func (song *Song) CompactReferences() bool {
+	return strings.EqualFold(strings.TrimSpace(song.FrontMatter["references"]), "compact")
+}
+
+// ReuseLines returns the lines of a section reusing the lines of another one: a copy of them, with
+// the bars written in the section replacing the last ones, so that a single bar replaces the last
+// bar. The copied lines and bars are marked as Reused.
+func ReuseLines(reused []Line, written []Line) []Line {
+	n := 0
+	for _, line := range written {
+		n += len(line.Bars)
+	}
+	lines := []Line{}
+	for _, line := range reused {
+		lines = append(lines, line.copy())
+	}
+	trimmed := false
+	for n > 0 && len(lines) > 0 && len(lines[len(lines)-1].Bars) > 0 {
+		last := &lines[len(lines)-1]
+		if len(last.Bars) <= n {
+			n -= len(last.Bars)
+			lines = lines[:len(lines)-1]
+			continue
+		}
+		last.Bars = last.Bars[:len(last.Bars)-n]
+		n = 0
+		trimmed = true
+	}
+	if trimmed && len(written) > 0 && len(written[0].Bars) > 0 {
+		// The first written line goes on the line of the bars it replaces
+		copied := lines[len(lines)-1].Bars
+		first := written[0]
+		first.Bars = append(slices.Clone(copied), first.Bars...)
+		first.Bars[len(copied)].PreviousWasRepeatEnd = copied[len(copied)-1].RepeatEnd
+		lines[len(lines)-1] = first
+		written = written[1:]
+	}
+	return append(lines, written...)
+}
+
+// ChainReused numbers the bars of a section reusing another one from id, once its lines are filled
+// with ReuseLines, and marks its first bar as a change when the copy is not played in the meter, key
+// and tempo given, the ones in effect before the section. The bars written after the copy go on with
+// its meter, key and tempo. It returns the id of the bar after the section and its last bar, nil when
+// it has none.
+func (section *Section) ChainReused(id int, meter Meter, key string, tempo int) (int, *Bar) {
+	var last *Bar
+	for i := range section.Lines {
+		for j := range section.Lines[i].Bars {
+			bar := &section.Lines[i].Bars[j]
+			if last == nil {
+				bar.MeterChange = bar.MeterChange || bar.Meter != meter
+				bar.KeyChange = bar.KeyChange || bar.Key != key
+				bar.TempoChange = bar.TempoChange || bar.Tempo != tempo
+			} else {
+				// The bars written after the copy go on with its meter, key and tempo
+				if !bar.MeterChange && bar.Meter != last.Meter {
+					bar.Meter = last.Meter
+					bar.PlaceBeats()
+				}
+				if !bar.KeyChange {
+					bar.Key = last.Key
+				}
+				if !bar.TempoChange {
+					bar.Tempo = last.Tempo
+				}
+			}
+			bar.Id = id
+			id++
+			last = bar
+		}
+	}
+	return id, last
+}
+
+// TransposeReused moves the bars copied from another section to the given key, for a section that
+// reuses another one in a new key: "# Last chorus = Chorus !key=D!". The key changes inside the copy
+// are moved the same way.
+func (section *Section) TransposeReused(key string) {
+	to, err := ParseKey(key)
+	if err != nil {
+		return
+	}
+	var base, current *Transposer
+	for i := range section.Lines {
+		line := &section.Lines[i]
+		if line.Reused && line.MultilineBacktick.Value != "" && current != nil {
+			line.MultilineBacktick.Value = current.Abc(line.MultilineBacktick.Value)
+		}
+		for j := range line.Bars {
+			bar := &line.Bars[j]
+			if !bar.Reused {
+				continue
+			}
+			if base == nil {
+				from, err := ParseKey(bar.Key)
+				if err != nil {
+					return
+				}
+				semitones := mod12(to.PitchClass()-from.PitchClass()+5) - 5
+				base = &Transposer{Semitones: semitones, From: from, To: to}
+				current = base
+			} else if bar.KeyChange {
+				current = base.inKey(bar.Key)
+			}
+			bar.Key = current.keyName(bar.Key)
+			for c := range bar.Chords {
+				bar.Chords[c].Value = current.Chord(bar.Chords[c].Value)
+			}
+			if bar.Backtick.Value != "" {
+				bar.Backtick.Value = current.Abc(bar.Backtick.Value)
+			}
+		}
+	}
+}
+
+func (line Line) copy() Line {
+	line.Reused = true
+	line.Bars = slices.Clone(line.Bars)
+	for i := range line.Bars {
+		line.Bars[i].Reused = true
+		line.Bars[i].Chords = slices.Clone(line.Bars[i].Chords)
+	}
+	return line
+}
+
+// WrittenLines returns the lines of the section as written in the source, without the lines and
+// bars copied from the section it reuses.
+func (section *Section) WrittenLines() []Line {
+	if section.Ref == "" {
+		return section.Lines
+	}
+	lines := []Line{}
+	for _, line := range section.Lines {
+		if line.Reused {
+			continue
+		}
+		line.Bars = slices.DeleteFunc(slices.Clone(line.Bars), func(bar Bar) bool { return bar.Reused })
+		lines = append(lines, line)
+	}
+	return lines
+}
@@ -4,22 +4,71 @@ import (
 	"encoding/json"
 	"errors"
 	"lesheets/internal/logger"
+	"slices"
+	"strconv"
 )
 
 type Song struct {
 	FrontMatter map[string]string `json:"front_matter"`
 	Sections    []Section         `json:"sections"`
+	Comments    []Comment         `json:"comments,omitempty"`
+	// Syntax is the source the song was parsed from, to write it back with Source
+	Syntax *SyntaxTree `json:"-"`
 }
 
+// Comment is a "// ..." comment of the source. Comments are kept apart from the song nodes, and tools
+// rewriting the source put them back by their position.
+type Comment struct {
+	Value string `json:"value"` // the text after "//"
+	Span  Span   `json:"span"`
+}
+
+// FrontMatterKeys are the front matter fields used to render a song.
+var FrontMatterKeys = []string{"title", "subtitle", "tempo", "key", "time", "L", "references"}
+
 type Section struct {
 	Name  string `json:"name"`
 	Lines []Line `json:"lines"`
 	Break bool   `json:"break"`
+	// Key and Tempo are the changes written in the header, like "# Bridge !key=D! !tempo=90!"
+	Key   string `json:"key"`
+	Tempo int    `json:"tempo"`
+	// Ref is the name of the section this one reuses, "# Chorus 2 = Chorus", see ReuseLines
+	Ref  string `json:"ref"`
+	Span Span   `json:"span"`
+}
+
+// Heading is the text of the section header after "#", with the section it reuses and its key and
+// tempo changes.
+func (section *Section) Heading() string {
+	heading := section.Name
+	if section.Ref != "" {
+		heading += " = " + section.Ref
+	}
+	if section.Key != "" {
+		heading += " !key=" + section.Key + "!"
+	}
+	if section.Tempo > 0 {
+		heading += " !tempo=" + strconv.Itoa(section.Tempo) + "!"
+	}
+	return heading
 }
 
 type Line struct {
 	Bars              []Bar             `json:"bars"`
 	MultilineBacktick MultilineBacktick `json:"multiline_backtick"`
+	// Lyrics are the "> ..." lines written under the bars, one per verse
+	Lyrics []Lyrics `json:"lyrics"`
+	// Reused tells the line is copied from the section reused by its section
+	Reused bool `json:"reused"`
+	Span   Span `json:"span"`
+}
+
+// Lyrics is a line of lyrics with a fragment for each bar of the line above it, the fragments are
+// separated by "|" like the bars.
+type Lyrics struct {
+	Fragments []string `json:"fragments"`
+	Span      Span     `json:"span"`
 }
 
 func (song *Song) PrintSong() {
@@ -47,8 +96,22 @@ func (song *Song) PrintSong() {
 	}
 }
 
+// JsonView returns the song as it's written as json. With compact references, the sections reusing
+// another one only hold the bars written in them.
+func (song *Song) JsonView() *Song {
+	if !song.CompactReferences() {
+		return song
+	}
+	compact := *song
+	compact.Sections = slices.Clone(song.Sections)
+	for i := range compact.Sections {
+		compact.Sections[i].Lines = compact.Sections[i].WrittenLines()
+	}
+	return &compact
+}
+
 func (song *Song) ToJson() (string, error) {
-	j, err := json.MarshalIndent(song, "", "  ")
+	j, err := json.MarshalIndent(song.JsonView(), "", "  ")
 	if err != nil {
 		return "", errors.New("error marshalling json: " + err.Error())
 	}
@@ -0,0 +1,53 @@
+package domain
+
+import "strings"
+
+type TriviaKind string
+
+const (
+	TriviaWhitespace TriviaKind = "whitespace"
+	TriviaComment    TriviaKind = "comment"
+	// TriviaSkipped is text that couldn't be read and was skipped to recover from an error
+	TriviaSkipped TriviaKind = "skipped"
+)
+
+// Trivia is source text that is not part of any token: whitespace, comments and skipped text.
+type Trivia struct {
+	Kind TriviaKind
+	Text string
+	Span Span
+}
+
+// SyntaxTree is the lossless form of a song: every token read, in order, with the trivia before it.
+// The last token is always TokenEof, holding the trivia at the end of the source.
+type SyntaxTree struct {
+	Tokens []Token
+}
+
+// String writes the source back exactly as it was read.
+func (t *SyntaxTree) String() string {
+	sb := strings.Builder{}
+	for _, tok := range t.Tokens {
+		for _, trivia := range tok.Leading {
+			sb.WriteString(trivia.Text)
+		}
+		sb.WriteString(tok.Text)
+	}
+	return sb.String()
+}
+
+// Comments returns the comments of the source, with the text after "//" as value.
+func (t *SyntaxTree) Comments() []Comment {
+	var comments []Comment
+	for _, tok := range t.Tokens {
+		for _, trivia := range tok.Leading {
+			if trivia.Kind == TriviaComment {
+				comments = append(comments, Comment{
+					Value: strings.TrimSuffix(trivia.Text[2:], "\r"),
+					Span:  trivia.Span,
+				})
+			}
+		}
+	}
+	return comments
+}
@@ -0,0 +1,38 @@
+package domain
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// MinTempo and MaxTempo bound the tempos, MinTempo being the slowest one a MIDI tempo can hold.
+const (
+	MinTempo = 4
+	MaxTempo = 999
+)
+
+// ParseTempo reads a tempo in beats per minute, written as a number with an optional "bpm" after it.
+// It's between MinTempo and MaxTempo.
+func ParseTempo(value string) (int, error) {
+	number := strings.TrimSpace(strings.TrimSuffix(strings.ToLower(strings.TrimSpace(value)), "bpm"))
+	bpm, err := strconv.Atoi(number)
+	if err != nil && !errors.Is(err, strconv.ErrRange) {
+		return 0, errors.New("invalid tempo \"" + value + "\": expected beats per minute like 120")
+	}
+	if err != nil || bpm < MinTempo || bpm > MaxTempo {
+		return 0, errors.New("invalid tempo \"" + value + "\": a tempo is between " + strconv.Itoa(MinTempo) + " and " +
+			strconv.Itoa(MaxTempo) + " beats per minute")
+	}
+	return bpm, nil
+}
+
+// Tempo returns the tempo of the front matter in beats per minute, or 0 when it has none. The error
+// tells when the tempo can't be read.
+func (song *Song) Tempo() (int, error) {
+	value := song.FrontMatter["tempo"]
+	if strings.TrimSpace(value) == "" {
+		return 0, nil
+	}
+	return ParseTempo(value)
+}
@@ -1,5 +1,7 @@
 package domain
 
+import "strconv"
+
 type TokenType string
 
 const (
@@ -15,9 +17,40 @@ const (
 	TokenUnknown           TokenType = "Unknown"
 	TokenEof               TokenType = "EOF"
 	TokenChord             TokenType = "Chord"
+	TokenLyrics            TokenType = "Lyrics"
+	TokenEnding            TokenType = "Ending"
+	TokenRepeatCount       TokenType = "RepeatCount"
+	TokenMeter             TokenType = "Meter"
 )
 
+// Position is a place in the source code. Line and Column are zero based, like Offset.
+type Position struct {
+	Offset int `json:"offset"`
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+// Span is the range of source code a token or a node was read from. End is exclusive.
+type Span struct {
+	Start Position `json:"start"`
+	End   Position `json:"end"`
+}
+
 type Token struct {
 	Type  TokenType
 	Value string
+	Span  Span
+	// Text is the token as written in the source, Value is its meaning (e.g. the name of a header
+	// without the # and the line break).
+	Text string
+	// Leading is the text between the previous token and this one.
+	Leading []Trivia
+}
+
+func (p Position) String() string {
+	return strconv.Itoa(p.Line+1) + ":" + strconv.Itoa(p.Column+1)
+}
+
+func (s Span) Contains(offset int) bool {
+	return s.Start.Offset <= offset && offset < s.End.Offset
 }
@@ -0,0 +1,171 @@
+package domain
+
+import (
+	"errors"
+	"strings"
+)
+
+// Transposer moves letter chords a number of semitones, spelling them for the target key. Nashville
+// chords are relative to the key, so they are left untouched.
+type Transposer struct {
+	Semitones int
+	From      *Key
+	To        *Key
+}
+
+func NewTransposer(from *Key, semitones int) *Transposer {
+	t := &Transposer{Semitones: semitones, From: from}
+	if from != nil {
+		to := from.Transpose(semitones)
+		t.To = &to
+	}
+	return t
+}
+
+func (t *Transposer) Root(r ChordRoot) ChordRoot {
+	if r.IsNashville() {
+		return r
+	}
+	if t.From != nil && t.To != nil {
+		return t.To.ToLetter(t.From.ToDegree(r))
+	}
+	pc := mod12(r.PitchClass() + t.Semitones)
+	switch r.Accidental {
+	case "b":
+		return SpellPitchClass(pc, true)
+	case "#":
+		return SpellPitchClass(pc, false)
+	}
+	return rootFromName(majorKeyNames[pc])
+}
+
+// Chord transposes a chord value. Values that are not chords (%, N.C., ...) are returned as they are.
+func (t *Transposer) Chord(value string) string {
+	chord, err := ParseChordSymbol(value)
+	if err != nil || chord.IsNashville() {
+		return value
+	}
+	chord.MapRoots(t.Root)
+	return chord.String()
+}
+
+// Transpose moves every chord and every ABC backtick of the song the given semitones and updates the
+// key in the front matter.
+func (song *Song) Transpose(semitones int) error {
+	var from *Key
+	field := song.keyField()
+	if field != "" {
+		key, err := ParseKey(song.FrontMatter[field])
+		if err != nil {
+			return errors.New("cannot transpose: " + err.Error())
+		}
+		from = key
+	}
+	song.transpose(field, NewTransposer(from, semitones))
+	return nil
+}
+
+// TransposeTo transposes the song to the given key, keeping the spelling of the key as given.
+func (song *Song) TransposeTo(key string) error {
+	to, err := ParseKey(key)
+	if err != nil {
+		return err
+	}
+	field := song.keyField()
+	if field == "" {
+		return errors.New("cannot transpose to " + key + ": the song has no key")
+	}
+	from, err := ParseKey(song.FrontMatter[field])
+	if err != nil {
+		return errors.New("cannot transpose: " + err.Error())
+	}
+	if from.Minor != to.Minor {
+		return errors.New("cannot transpose from " + from.String() + " to " + to.String() + ": both keys must be major or minor")
+	}
+	semitones := mod12(to.PitchClass()-from.PitchClass()+5) - 5
+	song.transpose(field, &Transposer{Semitones: semitones, From: from, To: to})
+	return nil
+}
+
+// transpose moves the song with t, and with a transposer for each key change of the sections and
+// the bars, so that every chord is spelled for the key it is played in.
+func (song *Song) transpose(keyField string, t *Transposer) {
+	if t.To != nil {
+		song.FrontMatter[keyField] = t.To.String()
+	}
+	current := t
+	for i := range song.Sections {
+		section := &song.Sections[i]
+		if section.Key != "" {
+			current = t.inKey(section.Key)
+			section.Key = current.keyName(section.Key)
+		}
+		for j := range section.Lines {
+			line := &section.Lines[j]
+			if line.MultilineBacktick.Value != "" {
+				line.MultilineBacktick.Value = current.Abc(line.MultilineBacktick.Value)
+			}
+			for k := range line.Bars {
+				bar := &line.Bars[k]
+				if bar.KeyChange {
+					current = t.inKey(bar.Key)
+				}
+				bar.Key = current.keyName(bar.Key)
+				for c := range bar.Chords {
+					bar.Chords[c].Value = current.Chord(bar.Chords[c].Value)
+				}
+				if bar.Backtick.Value != "" {
+					bar.Backtick.Value = current.Abc(bar.Backtick.Value)
+				}
+			}
+		}
+	}
+}
+
+// inKey returns a transposer moving the same semitones from another key. An invalid key was reported
+// when parsing, t is kept for it.
+func (t *Transposer) inKey(value string) *Transposer {
+	key, err := ParseKey(value)
+	if err != nil {
+		return t
+	}
+	return NewTransposer(key, t.Semitones)
+}
+
+// keyName returns the key a bar written in the given key is moved to.
+func (t *Transposer) keyName(value string) string {
+	if value == "" || t.To == nil {
+		return value
+	}
+	return t.To.String()
+}
+
+// Key returns the key of the song as written in the front matter.
+func (song *Song) Key() string {
+	return song.FrontMatter[song.keyField()]
+}
+
+// keyField returns the name of the front matter field holding the key. It's usually "key", but
+// "Key" is accepted as well.
+func (song *Song) keyField() string {
+	for k, v := range song.FrontMatter {
+		if strings.EqualFold(k, "key") && strings.TrimSpace(v) != "" {
+			return k
+		}
+	}
+	return ""
+}
+
+// mapChordsInKey rewrites every chord with f and the key of its bar, the song key being used for the
+// bars without a known key.
+func (song *Song) mapChordsInKey(songKey *Key, f func(Key, string) string) {
+	for _, bar := range song.Bars() {
+		key := songKey
+		if barKey, err := ParseKey(bar.Key); err == nil {
+			key = barKey
+		}
+		for c := range bar.Chords {
+			bar.Chords[c].Value = f(*key, bar.Chords[c].Value)
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package domain
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTransposeKey(t *testing.T) {
+	testCases := []struct {
+		key       string
+		semitones int
+		out       string
+	}{
+		{key: "C", semitones: 2, out: "D"},
+		{key: "C", semitones: 1, out: "Db"},
+		{key: "C", semitones: -1, out: "B"},
+		{key: "F", semitones: 1, out: "Gb"},
+		{key: "G", semitones: -1, out: "F#"},
+		{key: "Db", semitones: 5, out: "Gb"},
+		{key: "C#m", semitones: 3, out: "Em"},
+		{key: "Am", semitones: 1, out: "Bbm"},
+		{key: "A minor", semitones: 3, out: "Cm"},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.key, func(t *testing.T) {
+			key, err := ParseKey(tC.key)
+			assert.NoError(t, err)
+			assert.Equal(t, tC.out, key.Transpose(tC.semitones).String())
+		})
+	}
+}
+
+func TestParseKeyErrors(t *testing.T) {
+	for _, in := range []string{"H", "C7", "6m", "C/E"} {
+		t.Run(in, func(t *testing.T) {
+			_, err := ParseKey(in)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestKeyFifths(t *testing.T) {
+	testCases := []struct {
+		key    string
+		fifths int
+	}{
+		{key: "C", fifths: 0},
+		{key: "D", fifths: 2},
+		{key: "F#", fifths: 6},
+		{key: "Bb", fifths: -2},
+		{key: "Am", fifths: 0},
+		{key: "Cm", fifths: -3},
+		{key: "C#m", fifths: 4},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.key, func(t *testing.T) {
+			key, err := ParseKey(tC.key)
+			assert.NoError(t, err)
+			assert.Equal(t, tC.fifths, key.Fifths())
+		})
+	}
+}
+
+func TestTransposeChord(t *testing.T) {
+	testCases := []struct {
+		key       string
+		semitones int
+		in        string
+		out       string
+	}{
+		{key: "C", semitones: 2, in: "Cmaj7", out: "Dmaj7"},
+		{key: "C", semitones: 2, in: "Bb7", out: "C7"},
+		{key: "C", semitones: 2, in: "F#m7b5", out: "G#m7b5"},
+		{key: "C", semitones: 1, in: "Em7", out: "Fm7"},
+		{key: "C", semitones: 1, in: "A7(b13b9)", out: "Bb7(b13b9)"},
+		{key: "C", semitones: 1, in: "C/E", out: "Db/F"},
+		{key: "E", semitones: 1, in: "D", out: "Eb"},
+		{key: "E", semitones: 1, in: "G#m", out: "Am"},
+		{key: "Bb", semitones: 2, in: "Eb/G", out: "F/A"},
+		{key: "C", semitones: 2, in: "6m7", out: "6m7"},
+		{key: "C", semitones: 2, in: "%", out: "%"},
+		{key: "C", semitones: 2, in: "N.C.", out: "N.C."},
+		{key: "C", semitones: 2, in: "%%", out: "%%"},
+		{key: "C", semitones: 2, in: "/", out: "/"},
+		{key: "", semitones: 3, in: "C", out: "Eb"},
+		{key: "", semitones: 1, in: "F#", out: "G"},
+		{key: "", semitones: -1, in: "Bb", out: "A"},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.key+"/"+tC.in, func(t *testing.T) {
+			var key *Key
+			if tC.key != "" {
+				k, err := ParseKey(tC.key)
+				assert.NoError(t, err)
+				key = k
+			}
+			assert.Equal(t, tC.out, NewTransposer(key, tC.semitones).Chord(tC.in))
+		})
+	}
+}
+
+func TestSongTranspose(t *testing.T) {
+	song := Song{
+		FrontMatter: map[string]string{"Key": "Eb"},
+		Sections: []Section{{Lines: []Line{{Bars: []Bar{
+			{Chords: []Chord{{Value: "Eb"}, {Value: "Ab/C"}}},
+			{Chords: []Chord{{Value: "Bb7sus4"}}},
+		}}}}},
+	}
+	assert.NoError(t, song.Transpose(2))
+	assert.Equal(t, "F", song.FrontMatter["Key"])
+	bars := song.Sections[0].Lines[0].Bars
+	assert.Equal(t, "F", bars[0].Chords[0].Value)
+	assert.Equal(t, "Bb/D", bars[0].Chords[1].Value)
+	assert.Equal(t, "C7sus4", bars[1].Chords[0].Value)
+}
+
+func TestSongTransposeKeyChanges(t *testing.T) {
+	song := Song{
+		FrontMatter: map[string]string{"key": "C"},
+		Sections: []Section{
+			{Lines: []Line{{Bars: []Bar{
+				{Key: "C", Chords: []Chord{{Value: "C"}}},
+				{Key: "E", KeyChange: true, Chords: []Chord{{Value: "G#m"}}},
+				{Key: "E", Chords: []Chord{{Value: "E"}}},
+			}}}},
+			{Key: "Ab", Lines: []Line{{Bars: []Bar{{Key: "Ab", Chords: []Chord{{Value: "Db/F"}}}}}}},
+		},
+	}
+	assert.NoError(t, song.Transpose(1))
+	bars := song.Bars()
+	assert.Equal(t, []string{"Db", "F", "F", "A"}, []string{bars[0].Key, bars[1].Key, bars[2].Key, bars[3].Key})
+	assert.Equal(t, "Db", bars[0].Chords[0].Value)
+	assert.Equal(t, "Am", bars[1].Chords[0].Value)
+	assert.Equal(t, "F", bars[2].Chords[0].Value)
+	assert.Equal(t, "A", song.Sections[1].Key)
+	assert.Equal(t, "D/F#", bars[3].Chords[0].Value)
+}
+
+func TestSongTransposeInvalidKey(t *testing.T) {
+	song := Song{FrontMatter: map[string]string{"key": "X"}}
+	assert.Error(t, song.Transpose(2))
+}
+
+func TestSongTransposeTo(t *testing.T) {
+	song := Song{
+		FrontMatter: map[string]string{"key": "C"},
+		Sections:    []Section{{Lines: []Line{{Bars: []Bar{{Chords: []Chord{{Value: "C"}, {Value: "Bb/D"}}}}}}}},
+	}
+	assert.NoError(t, song.TransposeTo("F#"))
+	assert.Equal(t, "F#", song.FrontMatter["key"])
+	bars := song.Sections[0].Lines[0].Bars
+	assert.Equal(t, "F#", bars[0].Chords[0].Value)
+	assert.Equal(t, "E/G#", bars[0].Chords[1].Value)
+
+	assert.Error(t, song.TransposeTo("Am"))
+}
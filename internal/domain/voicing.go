@@ -0,0 +1,113 @@
+package domain
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// degreeSemitones are the semitones above the root of the degrees of a major scale, over two octaves.
+var degreeSemitones = map[int]int{1: 0, 2: 2, 3: 4, 4: 5, 5: 7, 6: 9, 7: 11, 9: 14, 11: 17, 13: 21}
+
+// Intervals returns the notes of the chord as semitones above its root, sorted: the triad of its
+// quality with the seventh, the extensions and the alterations it has. The bass of a slash chord is
+// not one of them.
+func (c *ChordSymbol) Intervals() []int {
+	third, fifth := 4, 7
+	seventh := -1
+	switch c.Quality {
+	case QualityMinor:
+		third = 3
+	case QualityDiminished:
+		third, fifth = 3, 6
+	case QualityAugmented:
+		fifth = 8
+	case QualityHalfDiminished:
+		third, fifth, seventh = 3, 6, 10
+	}
+	minorSeventh := 10
+	if c.Quality == QualityDiminished {
+		minorSeventh = 9
+	}
+	added := []int{}
+	for _, ext := range c.Extensions {
+		switch {
+		case ext == "5":
+			third = -1
+		case ext == "sus2":
+			third = 2
+		case ext == "sus4":
+			third = 5
+		case ext == "6":
+			added = append(added, 9)
+		case strings.HasPrefix(ext, "maj"):
+			seventh = 11
+			added = append(added, upperDegrees(ext[3:])...)
+		case strings.HasPrefix(ext, "add"):
+			if n, ok := alteredDegree(ext[3:]); ok {
+				added = append(added, n)
+			}
+		default:
+			if n, err := strconv.Atoi(ext); err == nil && n >= 7 {
+				// a 6/9 chord has no seventh
+				if seventh < 0 && !slices.Contains(c.Extensions, "6") {
+					seventh = minorSeventh
+				}
+				added = append(added, upperDegrees(ext)...)
+			}
+		}
+	}
+	for _, alt := range c.Alterations {
+		switch alt {
+		case "b5":
+			fifth = 6
+		case "#5":
+			fifth = 8
+		case "alt":
+			fifth = -1
+			added = append(added, 13, 15, 20)
+		default:
+			if n, ok := alteredDegree(alt); ok {
+				added = append(added, n)
+			}
+		}
+	}
+	notes := []int{0}
+	for _, n := range append([]int{third, fifth, seventh}, added...) {
+		if n >= 0 && !slices.Contains(notes, n) {
+			notes = append(notes, n)
+		}
+	}
+	slices.Sort(notes)
+	return notes
+}
+
+// upperDegrees returns the 9th, 11th and 13th that a 9, 11 or 13 chord stacks over its seventh. The
+// 11th is left out of the 13th chords, it clashes with their third.
+func upperDegrees(ext string) []int {
+	switch ext {
+	case "9":
+		return []int{14}
+	case "11":
+		return []int{14, 17}
+	case "13":
+		return []int{14, 21}
+	}
+	return nil
+}
+
+// alteredDegree returns the semitones of a degree with an optional accidental, like "b9" or "#11".
+func alteredDegree(value string) (int, bool) {
+	offset := 0
+	if strings.HasPrefix(value, "b") {
+		offset, value = -1, value[1:]
+	} else if strings.HasPrefix(value, "#") {
+		offset, value = 1, value[1:]
+	}
+	n, err := strconv.Atoi(value)
+	semitones, ok := degreeSemitones[n]
+	if err != nil || !ok {
+		return 0, false
+	}
+	return semitones + offset, true
+}
@@ -0,0 +1,391 @@
+package internal
+
+import (
+	"lesheets/internal/domain"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"gopkg.in/yaml.v3"
+)
+
+// FormatLesheet prints a song in the canonical layout of the fmt command: the known front matter
+// fields first, a blank line around the headers and the bars of each section aligned in columns.
+// Comments and blank lines between lines are written back where they were in the source.
+func FormatLesheet(song *domain.Song) (string, error) {
+	f := formatter{comments: song.Comments, lastLine: -1}
+	if len(song.FrontMatter) > 0 {
+		fm, err := formatFrontMatter(song.FrontMatter)
+		if err != nil {
+			return "", err
+		}
+		f.sb.WriteString("---\n" + fm + "---\n")
+		f.written = true
+	}
+	for _, section := range song.Sections {
+		if section.Heading() != "" {
+			f.commentsBefore(section.Span.Start.Line)
+			f.blankLine()
+			if section.Break {
+				f.writeLine("#- " + section.Heading())
+			} else {
+				f.writeLine("# " + section.Heading())
+			}
+			f.lastLine = section.Span.Start.Line
+			if len(section.WrittenLines()) > 0 {
+				f.blankLine()
+			}
+		}
+		f.lines(section.WrittenLines())
+	}
+	f.commentsBefore(-1)
+	return f.sb.String(), nil
+}
+
+type formatter struct {
+	sb strings.Builder
+	// comments not written yet
+	comments []domain.Comment
+	// lastLine is the source line of the last node written, -1 before the first one
+	lastLine int
+	written  bool
+	blank    bool
+}
+
+func (f *formatter) writeLine(s string) {
+	f.sb.WriteString(strings.TrimRight(s, " "))
+	f.sb.WriteString("\n")
+	f.written = true
+	f.blank = false
+}
+
+func (f *formatter) blankLine() {
+	if f.written && !f.blank {
+		f.sb.WriteString("\n")
+		f.blank = true
+	}
+}
+
+// gapBefore writes a blank line when the source had blank lines between the last node written and
+// the given line.
+func (f *formatter) gapBefore(line int) {
+	if f.lastLine >= 0 && line > f.lastLine+1 {
+		f.blankLine()
+	}
+}
+
+// commentsBefore writes the comments found before the given source line, or all of them when the
+// line is negative.
+func (f *formatter) commentsBefore(line int) {
+	for len(f.comments) > 0 && (line < 0 || f.comments[0].Span.Start.Line < line) {
+		c := f.comments[0]
+		f.comments = f.comments[1:]
+		f.gapBefore(c.Span.Start.Line)
+		f.writeLine("//" + c.Value)
+		f.lastLine = c.Span.Start.Line
+	}
+}
+
+// trailingComment returns the comment written at the end of the given source line, if any.
+func (f *formatter) trailingComment(line int) string {
+	if len(f.comments) == 0 || f.comments[0].Span.Start.Line != line {
+		return ""
+	}
+	c := f.comments[0]
+	f.comments = f.comments[1:]
+	return " //" + c.Value
+}
+
+func (f *formatter) lines(lines []domain.Line) {
+	rows := make([]row, len(lines))
+	lyricRows := make([][]row, len(lines))
+	for i := range lines {
+		rows[i] = newRow(&lines[i])
+		for _, lyrics := range lines[i].Lyrics {
+			lyricRows[i] = append(lyricRows[i], newLyricsRow(&lyrics))
+		}
+	}
+	// The columns are aligned in each block of lines, blocks are separated by blank lines
+	sepWidths := make([][]int, len(lines))
+	cellWidths := make([][]int, len(lines))
+	start := 0
+	for i := 1; i <= len(lines); i++ {
+		if i < len(lines) && !f.separated(&lines[i-1], &lines[i]) {
+			continue
+		}
+		// The lyrics are aligned with the bars above them
+		block := slices.Clone(rows[start:i])
+		for j := start; j < i; j++ {
+			block = append(block, lyricRows[j]...)
+		}
+		seps, cells := columnWidths(block)
+		for j := start; j < i; j++ {
+			sepWidths[j], cellWidths[j] = seps, cells
+		}
+		start = i
+	}
+
+	for i, line := range lines {
+		if line.MultilineBacktick.Value == "" && len(line.Bars) == 0 {
+			continue
+		}
+		f.commentsBefore(line.Span.Start.Line)
+		f.gapBefore(line.Span.Start.Line)
+		if line.MultilineBacktick.Value != "" {
+			f.writeLine("```")
+			f.sb.WriteString(line.MultilineBacktick.Value)
+			if !strings.HasSuffix(line.MultilineBacktick.Value, "\n") {
+				f.sb.WriteString("\n")
+			}
+			f.writeLine("```" + f.trailingComment(line.Span.End.Line))
+		} else {
+			if rows[i].note != "" {
+				f.writeLine(`"` + rows[i].note + `"`)
+			}
+			lastBar := line.Bars[len(line.Bars)-1]
+			f.writeLine(strings.TrimRight(rows[i].format(sepWidths[i], cellWidths[i]), " ") + f.trailingComment(lastBar.Span.End.Line))
+			f.lastLine = lastBar.Span.End.Line
+			for j, lyrics := range line.Lyrics {
+				f.commentsBefore(lyrics.Span.Start.Line)
+				f.writeLine(strings.TrimRight(lyricRows[i][j].format(sepWidths[i], cellWidths[i]), " ") + f.trailingComment(lyrics.Span.End.Line))
+				f.lastLine = lyrics.Span.End.Line
+			}
+		}
+		f.lastLine = line.Span.End.Line
+	}
+}
+
+// separated tells whether there are blank lines between two lines in the source.
+func (f *formatter) separated(a *domain.Line, b *domain.Line) bool {
+	for line := a.Span.End.Line + 1; line < b.Span.Start.Line; line++ {
+		isComment := slices.ContainsFunc(f.comments, func(c domain.Comment) bool {
+			return c.Span.Start.Line == line
+		})
+		if !isComment {
+			return true
+		}
+	}
+	return false
+}
+
+// row is a line of bars split in cells, with the bar lines between them: seps[i] goes before
+// cells[i] and the last one closes the line.
+type row struct {
+	seps  []string
+	cells []string
+	// fixed cells are not aligned, inline backticks are usually much longer than the chords
+	fixed []bool
+	// note is the bar note of the first bar when it's written on a line of its own
+	note string
+}
+
+func newRow(line *domain.Line) row {
+	r := row{}
+	bars := line.Bars
+	for i := range bars {
+		bar := &bars[i]
+		opening := ""
+		if bar.RepeatStart {
+			opening = "||:"
+		}
+		if i == 0 {
+			// A chord like #4 at the start of the line would be read as a header
+			if opening == "" && len(bar.Chords) > 0 && strings.HasPrefix(barCell(bar, true), "#") {
+				opening = "|"
+			}
+			r.seps = append(r.seps, opening)
+		} else {
+			r.seps = append(r.seps, barLine(closing(&bars[i-1]), opening))
+		}
+		withNote := true
+		if i == 0 && barNoteOnItsOwnLine(bar) {
+			r.note = bar.BarNote
+			withNote = false
+		}
+		r.cells = append(r.cells, barCell(bar, withNote))
+		r.fixed = append(r.fixed, bar.Backtick.Value != "")
+	}
+	if len(bars) > 0 {
+		r.seps = append(r.seps, closing(&bars[len(bars)-1]))
+	}
+	return r
+}
+
+// newLyricsRow makes a row of a lyric line, with ">" in place of the opening bar line so that the
+// fragments line up with the bars.
+func newLyricsRow(lyrics *domain.Lyrics) row {
+	r := row{}
+	for i, fragment := range lyrics.Fragments {
+		if i == 0 {
+			r.seps = append(r.seps, ">")
+		} else {
+			r.seps = append(r.seps, "|")
+		}
+		r.cells = append(r.cells, fragment)
+		r.fixed = append(r.fixed, false)
+	}
+	r.seps = append(r.seps, "")
+	return r
+}
+
+func closing(bar *domain.Bar) string {
+	if bar.RepeatEnd && bar.RepeatCount > 0 {
+		return ":||x" + strconv.Itoa(bar.RepeatCount)
+	}
+	if bar.RepeatEnd {
+		return ":||"
+	}
+	if bar.DoubleBarEnd {
+		return "||"
+	}
+	return ""
+}
+
+// barLine returns the bar line between two bars, a single one unless the bars end or start a repeat.
+func barLine(closing string, opening string) string {
+	switch {
+	case closing == "" && opening == "":
+		return "|"
+	case closing == "":
+		return opening
+	case opening == "":
+		return closing
+	}
+	return closing + " " + opening
+}
+
+func barNoteOnItsOwnLine(bar *domain.Bar) bool {
+	if bar.BarNote == "" {
+		return false
+	}
+	body := bar.Backtick.Span
+	if len(bar.Chords) > 0 {
+		body = bar.Chords[0].Span
+	}
+	return body.Start.Line > bar.Span.Start.Line
+}
+
+func barCell(bar *domain.Bar, withNote bool) string {
+	parts := []string{}
+	if bar.EndingStart {
+		parts = append(parts, "["+bar.Ending.Label)
+	}
+	if withNote && bar.BarNote != "" {
+		parts = append(parts, `"`+bar.BarNote+`"`)
+	}
+	for _, n := range bar.NavigationAt(true) {
+		parts = append(parts, "!"+string(n)+"!")
+	}
+	if bar.MeterChange {
+		parts = append(parts, "("+bar.Meter.String()+")")
+	}
+	if bar.KeyChange {
+		parts = append(parts, "!key="+bar.Key+"!")
+	}
+	if bar.TempoChange {
+		parts = append(parts, "!tempo="+strconv.Itoa(bar.Tempo)+"!")
+	}
+	if bar.Backtick.Value != "" {
+		parts = append(parts, "`"+bar.Backtick.Value+"`")
+	}
+	for _, c := range bar.Chords {
+		chord := c.Value
+		if c.Annotation != nil && c.Annotation.Value != "" {
+			chord = "!" + c.Annotation.Value + "!" + chord
+		}
+		parts = append(parts, chord)
+	}
+	for _, n := range bar.NavigationAt(false) {
+		parts = append(parts, "!"+string(n)+"!")
+	}
+	return strings.Join(parts, " ")
+}
+
+func columnWidths(rows []row) ([]int, []int) {
+	sepWidths, cellWidths := []int{}, []int{}
+	for _, r := range rows {
+		for i, sep := range r.seps {
+			if i == len(sepWidths) {
+				sepWidths = append(sepWidths, 0)
+			}
+			sepWidths[i] = max(sepWidths[i], utf8.RuneCountInString(sep))
+		}
+		for i, cell := range r.cells {
+			if i == len(cellWidths) {
+				cellWidths = append(cellWidths, 0)
+			}
+			if !r.fixed[i] {
+				cellWidths[i] = max(cellWidths[i], utf8.RuneCountInString(cell))
+			}
+		}
+	}
+	return sepWidths, cellWidths
+}
+
+// format writes the row with the bar lines right aligned and the cells left aligned in their columns.
+func (r row) format(sepWidths []int, cellWidths []int) string {
+	sb := strings.Builder{}
+	for i, cell := range r.cells {
+		if sepWidths[i] > 0 {
+			sb.WriteString(padLeft(r.seps[i], sepWidths[i]) + " ")
+		}
+		if r.fixed[i] {
+			sb.WriteString(cell + " ")
+		} else {
+			sb.WriteString(padRight(cell, cellWidths[i]) + " ")
+		}
+	}
+	sb.WriteString(r.seps[len(r.cells)])
+	return sb.String()
+}
+
+func padLeft(s string, width int) string {
+	return strings.Repeat(" ", max(0, width-utf8.RuneCountInString(s))) + s
+}
+
+func padRight(s string, width int) string {
+	return s + strings.Repeat(" ", max(0, width-utf8.RuneCountInString(s)))
+}
+
+// formatFrontMatter writes the known fields first, in the order of domain.FrontMatterKeys and with
+// their usual case ("Key" becomes "key"), followed by the rest sorted by name.
+func formatFrontMatter(fm map[string]string) (string, error) {
+	names := map[string]string{}
+	known := []string{}
+	others := []string{}
+	for k := range fm {
+		i := slices.IndexFunc(domain.FrontMatterKeys, func(name string) bool { return strings.EqualFold(name, k) })
+		if i < 0 {
+			others = append(others, k)
+			continue
+		}
+		canonical := domain.FrontMatterKeys[i]
+		if _, exists := fm[canonical]; exists && canonical != k {
+			others = append(others, k)
+			continue
+		}
+		names[k] = canonical
+		known = append(known, k)
+	}
+	slices.SortFunc(known, func(a, b string) int {
+		return slices.Index(domain.FrontMatterKeys, names[a]) - slices.Index(domain.FrontMatterKeys, names[b])
+	})
+	slices.Sort(others)
+
+	node := &yaml.Node{Kind: yaml.MappingNode}
+	for _, k := range append(known, others...) {
+		name := k
+		if canonical, ok := names[k]; ok {
+			name = canonical
+		}
+		node.Content = append(node.Content,
+			&yaml.Node{Kind: yaml.ScalarNode, Value: name},
+			&yaml.Node{Kind: yaml.ScalarNode, Value: fm[k]})
+	}
+	yml, err := yaml.Marshal(node)
+	if err != nil {
+		return "", err
+	}
+	return string(yml), nil
+}
@@ -0,0 +1,152 @@
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func format(t *testing.T, input string) string {
+	s, err := ParseSongFromString(input)
+	require.NoError(t, err)
+	output, err := FormatLesheet(s)
+	require.NoError(t, err)
+	return output
+}
+
+func TestFormat(t *testing.T) {
+	testCases := []struct {
+		desc     string
+		input    string
+		expected string
+	}{
+		{
+			desc:     "aligns the bars in columns",
+			input:    "# A\n|C|Dm7|G7|\n| Am7 |D|\n",
+			expected: "# A\n\nC   | Dm7 | G7\nAm7 | D\n",
+		},
+		{
+			desc:     "aligns the repeats",
+			input:    "||: 1 | 1 | 4 | 4\n1 | 1 | 4 | 4 :||\n",
+			expected: "||: 1 | 1 | 4 | 4\n    1 | 1 | 4 | 4 :||\n",
+		},
+		{
+			desc:     "right aligns the bar lines",
+			input:    "C :|| D\nEm | F\n",
+			expected: "C  :|| D\nEm   | F\n",
+		},
+		{
+			desc:     "normalizes the bar lines",
+			input:    "1 :||||: 2 :||3 ||\n6||: 1 :||\n",
+			expected: "1 :|| ||: 2 :|| 3 ||\n6     ||: 1 :||\n",
+		},
+		{
+			desc:     "aligns each block of lines apart",
+			input:    "Cmaj7 Dm7 Em7 Fmaj7\n\nC | D\nEm | F\n",
+			expected: "Cmaj7 Dm7 Em7 Fmaj7\n\nC  | D\nEm | F\n",
+		},
+		{
+			desc:     "keeps backticks out of the columns",
+			input:    "`abc` | C\nDm | E\n",
+			expected: "`abc` | C\nDm | E\n",
+		},
+		{
+			desc:     "keeps sharp degrees at the start of a line apart from headers",
+			input:    " #4 | 5\n1 | 5\n",
+			expected: "| #4 | 5\n  1  | 5\n",
+		},
+		{
+			desc:     "keeps bar notes on their own line",
+			input:    "\"intro\"\nC | D\n\"band\" E | F\n",
+			expected: "\"intro\"\nC        | D\n\"band\" E | F\n",
+		},
+		{
+			desc:     "sorts the front matter",
+			input:    "---\ncolumns: 2\nKey: C#m\ntitle: Song\n---\n# A\nC\n",
+			expected: "---\ntitle: Song\nkey: C#m\ncolumns: 2\n---\n\n# A\n\nC\n",
+		},
+		{
+			desc:     "keeps a single blank line around headers",
+			input:    "# A\nC\n\n\n\n#- B\n\n\n\nD\n# C\n",
+			expected: "# A\n\nC\n\n#- B\n\nD\n\n# C\n",
+		},
+		{
+			desc:     "keeps the comments",
+			input:    "// before\n# A\n// first line\nC | D // trailing\n\n// alone\n\nE\n// end\n",
+			expected: "// before\n\n# A\n\n// first line\nC | D // trailing\n\n// alone\n\nE\n// end\n",
+		},
+		{
+			desc:     "aligns the lyrics with the bars",
+			input:    "||: C | Am7 | F :||\n> Hello|my dear|friend // first\n>la | la\n",
+			expected: "||: C     | Am7     | F      :||\n  > Hello | my dear | friend // first\n  > la    | la\n",
+		},
+		{
+			desc:     "writes the endings at the start of their bar",
+			input:    "||: A |[1 B :||[2 C||\n",
+			expected: "||: A | [1 B :|| [2 C ||\n",
+		},
+		{
+			desc:     "writes the navigation markers around the chords",
+			input:    "!D.C.alfine! A|!segno! B !fine!\n",
+			expected: "A !D.C.alfine! | !segno! B !fine!\n",
+		},
+		{
+			desc:     "aligns the repeat counts",
+			input:    "||: C :|| 3x ||: D :||\nE | F\n",
+			expected: "||: C :||x3 ||: D :||\n    E         | F\n",
+		},
+		{
+			desc:     "writes the meter changes in parentheses",
+			input:    "C | !meter=7/8! D\n",
+			expected: "C | (7/8) D\n",
+		},
+		{
+			desc:     "writes the key and tempo changes",
+			input:    "#  B   !tempo=90!  !key=D!\nC | !tempo=100! !key=Eb! D\n",
+			expected: "# B !key=D! !tempo=90!\n\nC | !key=Eb! !tempo=100! D\n",
+		},
+		{
+			desc:     "writes the bars of a section reusing another one only",
+			input:    "# A\nC|F\n#  B=A\n|G7|\n",
+			expected: "# A\n\nC | F\n\n# B = A\n\nG7\n",
+		},
+		{
+			desc:     "keeps multiline backticks",
+			input:    "# A\n```\nX:1\nK:C\nCDEF|\n```\nC\n",
+			expected: "# A\n\n```\nX:1\nK:C\nCDEF|\n```\nC\n",
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			assert.Equal(t, tC.expected, format(t, tC.input))
+		})
+	}
+}
+
+func TestFormatIsStable(t *testing.T) {
+	files, err := filepath.Glob("../docs/lesheets/*.lesheet")
+	require.NoError(t, err)
+	files = append(files, "testdata/all-features.nns")
+	for _, file := range files {
+		t.Run(filepath.Base(file), func(t *testing.T) {
+			input, err := os.ReadFile(file)
+			require.NoError(t, err)
+			formatted := format(t, string(input))
+			assert.Equal(t, formatted, format(t, formatted))
+
+			// Formatting changes the layout, not the song
+			before, err := ParseSongFromString(string(input))
+			require.NoError(t, err)
+			after, err := ParseSongFromString(formatted)
+			require.NoError(t, err)
+			beforeSections, afterSections := &strings.Builder{}, &strings.Builder{}
+			require.NoError(t, PrintSections(before, beforeSections))
+			require.NoError(t, PrintSections(after, afterSections))
+			assert.Equal(t, beforeSections.String(), afterSections.String())
+		})
+	}
+}
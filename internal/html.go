@@ -117,10 +117,18 @@ func WriteSongHtmlToFile(dev bool, sourceCode string, song *domain.Song, filenam
 	return nil
 }
 
+// RenderError renders an error, or every diagnostic of a domain.Diagnostics error with its position.
 func RenderError(err error) []byte {
 	buf := bytes.Buffer{}
 	buf.WriteString("<pre>")
-	template.HTMLEscape(&buf, []byte(err.Error()))
+	var diagnostics domain.Diagnostics
+	if errors.As(err, &diagnostics) {
+		for _, d := range diagnostics {
+			template.HTMLEscape(&buf, []byte(d.Span.Start.String()+": "+d.Message+"\n"))
+		}
+	} else {
+		template.HTMLEscape(&buf, []byte(err.Error()))
+	}
 	buf.WriteString("</pre>")
 	return buf.Bytes()
 }
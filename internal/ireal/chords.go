@@ -0,0 +1,124 @@
+package ireal
+
+import (
+	"errors"
+	"lesheets/internal/domain"
+	"strings"
+)
+
+// qualities are the chord qualities iReal Pro writes after the root.
+var qualities = []string{
+	"5", "2", "add9", "+", "o", "h", "sus", "^", "-", "^7", "-7", "7", "7sus", "h7", "o7", "^9", "^13",
+	"6", "69", "^7#11", "^9#11", "^7#5", "-6", "-69", "-^7", "-^9", "-9", "-11", "-7b5", "h9", "-b6",
+	"-#5", "9", "7b9", "7#9", "7#11", "7b5", "7#5", "9#11", "9b5", "9#5", "7b13", "7#9#5", "7#9b5",
+	"7#9#11", "7b9#11", "7b9b5", "7b9#5", "7b9#9", "7b9b13", "7alt", "13", "13#11", "13b9", "13#9",
+	"7b9sus", "7susadd3", "9sus", "13sus", "7b13sus", "11",
+}
+
+type chordToken struct {
+	value  string
+	length int
+}
+
+// readChord reads the chord at the start of the text, a root followed by a quality and a bass, and
+// returns it as a lesheets chord: "D-7/C" is "Dm7/C".
+func readChord(text string) chordToken {
+	i := 1
+	if i < len(text) && (text[i] == 'b' || text[i] == '#') {
+		i++
+	}
+	root := text[:i]
+	quality := ""
+	for _, q := range qualities {
+		if strings.HasPrefix(text[i:], q) && len(q) > len(quality) {
+			quality = q
+		}
+	}
+	i += len(quality)
+	bass := ""
+	if i+1 < len(text) && text[i] == '/' && isNote(text[i+1]) {
+		j := i + 2
+		if j < len(text) && (text[j] == 'b' || text[j] == '#') {
+			j++
+		}
+		bass, i = text[i:j], j
+	}
+	return chordToken{value: root + lesheetsQuality(quality) + bass, length: i}
+}
+
+// lesheetsQuality writes a quality of iReal Pro the way lesheets reads it: "^7" is "maj7", "-" is
+// "m", "-^7" is "m(maj7)", "h" is "m7b5" and "o" is "dim".
+func lesheetsQuality(quality string) string {
+	switch {
+	case quality == "^":
+		return "maj7"
+	case strings.HasPrefix(quality, "h"):
+		n := strings.TrimPrefix(quality, "h")
+		if n == "" {
+			n = "7"
+		}
+		return "m" + n + "b5"
+	case strings.HasPrefix(quality, "o"):
+		return "dim" + quality[1:]
+	case strings.HasPrefix(quality, "-^"):
+		return "m(maj" + quality[2:] + ")"
+	case strings.HasPrefix(quality, "-"):
+		quality = "m" + quality[1:]
+	}
+	return strings.NewReplacer("^", "maj", "69", "6/9").Replace(quality)
+}
+
+// irealChord writes a chord the way iReal Pro reads it, in letters. A Nashville number is spelled in
+// the key given.
+func irealChord(value string, key string) (string, error) {
+	symbol, err := domain.ParseChordSymbol(value)
+	if err != nil {
+		return "", err
+	}
+	if symbol.IsNashville() {
+		k, err := domain.ParseKey(key)
+		if key == "" || err != nil {
+			return "", errors.New("cannot write the Nashville number \"" + value + "\" without a key")
+		}
+		if symbol, err = domain.ParseChordSymbol(k.ChordToLetters(value)); err != nil {
+			return "", err
+		}
+	}
+	chord := symbol.Root.String() + irealQuality(symbol)
+	if symbol.Bass != nil {
+		chord += "/" + symbol.Bass.String()
+	}
+	return chord, nil
+}
+
+// irealQuality writes the quality, extensions and alterations of a chord as iReal Pro does: "-" for
+// minor, "^" for the major seventh, "h" for half-diminished and "o" for diminished.
+func irealQuality(symbol *domain.ChordSymbol) string {
+	sb := strings.Builder{}
+	switch symbol.Quality {
+	case domain.QualityMinor:
+		sb.WriteString("-")
+	case domain.QualityDiminished:
+		sb.WriteString("o")
+	case domain.QualityAugmented:
+		sb.WriteString("+")
+	case domain.QualityHalfDiminished:
+		sb.WriteString("h")
+	}
+	for _, extension := range symbol.Extensions {
+		switch {
+		case strings.HasPrefix(extension, "maj"):
+			sb.WriteString("^" + strings.TrimPrefix(extension, "maj"))
+		case extension == "sus4":
+			sb.WriteString("sus")
+		case extension == "sus2":
+			sb.WriteString("2")
+		default:
+			sb.WriteString(extension)
+		}
+	}
+	for _, alteration := range symbol.Alterations {
+		sb.WriteString(alteration)
+	}
+	return sb.String()
+}
@@ -0,0 +1,72 @@
+package ireal
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadChord(t *testing.T) {
+	testCases := []struct {
+		text     string
+		expected string
+		length   int
+	}{
+		{text: "C^7 ", expected: "Cmaj7", length: 3},
+		{text: "C^ ", expected: "Cmaj7", length: 2},
+		{text: "Bb-7|", expected: "Bbm7", length: 4},
+		{text: "F#h7 ", expected: "F#m7b5", length: 4},
+		{text: "Dh ", expected: "Dm7b5", length: 2},
+		{text: "Ebo7 ", expected: "Ebdim7", length: 4},
+		{text: "C-^7 ", expected: "Cm(maj7)", length: 4},
+		{text: "G7b9#5/B ", expected: "G7b9#5/B", length: 8},
+		{text: "A7alt,", expected: "A7alt", length: 5},
+		{text: "D7sus ", expected: "D7sus", length: 5},
+		{text: "F69 ", expected: "F6/9", length: 3},
+		{text: "E-7/D|", expected: "Em7/D", length: 5},
+		{text: "C ", expected: "C", length: 1},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.text, func(t *testing.T) {
+			chord := readChord(tC.text)
+			assert.Equal(t, tC.expected, chord.value)
+			assert.Equal(t, tC.length, chord.length)
+		})
+	}
+}
+
+func TestIrealChord(t *testing.T) {
+	testCases := []struct {
+		value    string
+		key      string
+		expected string
+	}{
+		{value: "Cmaj7", expected: "C^7"},
+		{value: "Bbm7", expected: "Bb-7"},
+		{value: "F#m7b5", expected: "F#-7b5"},
+		{value: "Dø7", expected: "Dh7"},
+		{value: "Ebdim7", expected: "Ebo7"},
+		{value: "Cm(maj7)", expected: "C-^7"},
+		{value: "G7(b9,#5)/B", expected: "G7b9#5/B"},
+		{value: "D7sus4", expected: "D7sus"},
+		{value: "F6/9", expected: "F69"},
+		{value: "Aaug", expected: "A+"},
+		{value: "6m7", key: "C", expected: "A-7"},
+		{value: "5/7", key: "Bb", expected: "F/A"},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.value, func(t *testing.T) {
+			chord, err := irealChord(tC.value, tC.key)
+			require.NoError(t, err)
+			assert.Equal(t, tC.expected, chord)
+		})
+	}
+}
+
+func TestIrealChordErrors(t *testing.T) {
+	_, err := irealChord("6m7", "")
+	assert.ErrorContains(t, err, "without a key")
+	_, err = irealChord("Hm7", "C")
+	assert.Error(t, err)
+}
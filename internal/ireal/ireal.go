@@ -0,0 +1,191 @@
+// Package ireal reads the irealb:// and irealbook:// links of iReal Pro into songs and writes songs
+// as irealb:// links, which open the chart in iReal Pro when followed on a device where it's installed.
+package ireal
+
+import (
+	"errors"
+	"lesheets/internal/domain"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	schemeB    = "irealb://"
+	schemeBook = "irealbook://"
+	// musicPrefix starts the obfuscated chord progressions of the irealb:// links
+	musicPrefix = "1r34LbKcu7"
+)
+
+var linkRegexp = regexp.MustCompile(`irealb(?:ook)?://[^"'<>\s]+`)
+
+// IsLink tells whether the text is an iReal Pro link.
+func IsLink(text string) bool {
+	return strings.HasPrefix(text, schemeB) || strings.HasPrefix(text, schemeBook)
+}
+
+// FindLinks returns the iReal Pro links found in a text, like the HTML pages iReal Pro exports.
+func FindLinks(text string) []string {
+	return linkRegexp.FindAllString(text, -1)
+}
+
+// Decode reads the songs of an iReal Pro link: a single song, or a playlist of songs separated by
+// "===" and followed by the name of the playlist.
+func Decode(link string) ([]*domain.Song, error) {
+	book := strings.HasPrefix(link, schemeBook)
+	if !book && !strings.HasPrefix(link, schemeB) {
+		return nil, errors.New("not an iReal Pro link, expected " + schemeB + " or " + schemeBook)
+	}
+	body, err := url.PathUnescape(strings.TrimPrefix(strings.TrimPrefix(link, schemeBook), schemeB))
+	if err != nil {
+		return nil, errors.New("invalid iReal Pro link: " + err.Error())
+	}
+	parts := strings.Split(body, "===")
+	if len(parts) > 1 && !strings.Contains(parts[len(parts)-1], "=") {
+		parts = parts[:len(parts)-1]
+	}
+	songs := []*domain.Song{}
+	for i, part := range parts {
+		song, err := decodeSong(part, book)
+		if err != nil {
+			return nil, errors.New("song " + strconv.Itoa(i+1) + ": " + err.Error())
+		}
+		songs = append(songs, song)
+	}
+	return songs, nil
+}
+
+// decodeSong reads the fields of a song, separated by "=". They are
+// Title=Composer==Style=Key==Music=Groove=Tempo=Repeats in irealb:// links, and
+// Title=Composer=Style=Key=n=Music in the older irealbook:// links.
+func decodeSong(text string, book bool) (*domain.Song, error) {
+	fields := strings.Split(text, "=")
+	title, composer, style, key, music, tempo := "", "", "", "", "", ""
+	switch {
+	case book && len(fields) >= 6:
+		title, composer, style, key, music = fields[0], fields[1], fields[2], fields[3], fields[5]
+	case !book && len(fields) >= 7:
+		title, composer, style, key, music = fields[0], fields[1], fields[3], fields[4], fields[6]
+		if len(fields) > 8 {
+			tempo = fields[8]
+		}
+	default:
+		return nil, errors.New("missing fields, expected the title, composer, style, key and chords")
+	}
+	if rest, ok := strings.CutPrefix(music, musicPrefix); ok {
+		music = swapBlocks(rest)
+	}
+	music = codes.Replace(music)
+	frontMatter := map[string]string{}
+	for name, value := range map[string]string{"title": title, "composer": composerName(composer), "style": style} {
+		if value != "" {
+			frontMatter[name] = value
+		}
+	}
+	if key != "" {
+		k, err := domain.ParseKey(strings.Replace(key, "-", "m", 1))
+		if err != nil {
+			return nil, err
+		}
+		frontMatter["key"] = k.String()
+	}
+	if n, err := strconv.Atoi(tempo); err == nil && n > 0 {
+		frontMatter["tempo"] = tempo
+	}
+	return readMusic(music, frontMatter)
+}
+
+// composerName writes the "Last First" names of iReal Pro as "First Last".
+func composerName(name string) string {
+	last, first, ok := strings.Cut(strings.TrimSpace(name), " ")
+	if !ok {
+		return last
+	}
+	return first + " " + last
+}
+
+// irealComposer writes a "First Last" name as iReal Pro does, "Last First".
+func irealComposer(name string) string {
+	name = strings.TrimSpace(name)
+	i := strings.LastIndex(name, " ")
+	if i < 0 {
+		return name
+	}
+	return name[i+1:] + " " + name[:i]
+}
+
+// Encode writes the song as an irealb:// link. The chords are written in letters, the Nashville
+// numbers being spelled in the key of their bar.
+func Encode(song *domain.Song) (string, error) {
+	music, err := writeMusic(song)
+	if err != nil {
+		return "", err
+	}
+	key := "C"
+	if value := song.FrontMatter["key"]; value != "" {
+		k, err := domain.ParseKey(value)
+		if err != nil {
+			return "", err
+		}
+		key = k.Root.String()
+		if k.Minor {
+			key += "-"
+		}
+	}
+	tempo := "0"
+	if value := song.FrontMatter["tempo"]; value != "" {
+		t, err := domain.ParseTempo(value)
+		if err != nil {
+			return "", err
+		}
+		tempo = strconv.Itoa(t)
+	}
+	// An empty composer or style would write "===", the separator of the songs of a playlist
+	composer, style := "Unknown", "Medium Swing"
+	if value := song.FrontMatter["composer"]; value != "" {
+		composer = irealComposer(value)
+	}
+	if value := song.FrontMatter["style"]; value != "" {
+		style = value
+	}
+	fields := []string{
+		song.FrontMatter["title"],
+		composer,
+		"",
+		style,
+		key,
+		"",
+		musicPrefix + swapBlocks(music),
+		"",
+		tempo,
+		"0",
+	}
+	for i, field := range fields {
+		// "=" separates the fields, it can't be part of them
+		fields[i] = strings.ReplaceAll(field, "=", "-")
+	}
+	return schemeB + strings.ReplaceAll(url.QueryEscape(strings.Join(fields, "=")), "+", "%20"), nil
+}
+
+// codes are the short codes of common sequences of the chord progressions.
+var codes = strings.NewReplacer("Kcl", "| x", "LZ", " |", "XyQ", "   ")
+
+// swapBlocks obfuscates the chord progressions of the irealb:// links, or reverts it: the characters
+// of each block of 50 are swapped around its middle, except in the last block when it's shorter than
+// 52 characters. Swapping twice gives back the text.
+func swapBlocks(text string) string {
+	sb := strings.Builder{}
+	for len(text) > 51 {
+		block := []byte(text[:50])
+		for i := range 50 {
+			if i < 5 || (i >= 10 && i < 24) {
+				block[i], block[49-i] = text[49-i], text[i]
+			}
+		}
+		sb.Write(block)
+		text = text[50:]
+	}
+	sb.WriteString(text)
+	return sb.String()
+}
@@ -0,0 +1,284 @@
+package ireal
+
+import (
+	"lesheets/internal"
+	"lesheets/internal/domain"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func chords(bar domain.Bar) []string {
+	values := []string{}
+	for _, chord := range bar.Chords {
+		values = append(values, chord.Value)
+	}
+	return values
+}
+
+func bars(song *domain.Song) []domain.Bar {
+	res := []domain.Bar{}
+	for _, section := range song.Sections {
+		for _, line := range section.Lines {
+			res = append(res, line.Bars...)
+		}
+	}
+	return res
+}
+
+func TestDecodeFields(t *testing.T) {
+	testCases := []struct {
+		desc     string
+		link     string
+		expected map[string]string
+	}{
+		{
+			desc: "irealb",
+			link: "irealb://" + url.PathEscape("Blue Bossa=Dorham Kenny==Bossa Nova=C-==1r34LbKcu7*A[T44C-7XyQ|F-7XyQZ=Latin-Brazil: Bossa Acoustic=140=3"),
+			expected: map[string]string{
+				"title":    "Blue Bossa",
+				"composer": "Kenny Dorham",
+				"style":    "Bossa Nova",
+				"key":      "Cm",
+				"tempo":    "140",
+			},
+		},
+		{
+			desc: "irealbook",
+			link: "irealbook://" + url.PathEscape("Solar=Davis Miles=Medium Swing=C-=n=*A[T44C-^7XyQ|G-7 C7 Z"),
+			expected: map[string]string{
+				"title":    "Solar",
+				"composer": "Miles Davis",
+				"style":    "Medium Swing",
+				"key":      "Cm",
+			},
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			songs, err := Decode(tC.link)
+			require.NoError(t, err)
+			require.Len(t, songs, 1)
+			assert.Equal(t, tC.expected, songs[0].FrontMatter)
+			assert.Len(t, bars(songs[0]), 2)
+		})
+	}
+}
+
+func TestDecodePlaylist(t *testing.T) {
+	link := "irealb://" + url.PathEscape("Blue Bossa=Dorham Kenny==Bossa Nova=C-==1r34LbKcu7[C-7XyQZ=Latin=140=3"+
+		"===Solar=Davis Miles==Medium Swing=C-==1r34LbKcu7[C-^7XyQZ=Jazz=160=3===Session")
+	songs, err := Decode(link)
+	require.NoError(t, err)
+	require.Len(t, songs, 2)
+	assert.Equal(t, "Blue Bossa", songs[0].FrontMatter["title"])
+	assert.Equal(t, "Solar", songs[1].FrontMatter["title"])
+	assert.Equal(t, []string{"Cm(maj7)"}, chords(bars(songs[1])[0]))
+}
+
+func TestDecodeStructure(t *testing.T) {
+	music := "*A{T44C^7XyQ|A-7XyQ|N1D-7 G7 }XyQXyQ|N2D-7 G7 Z" +
+		"*B[SKcl LZF^7,Bb7  |r|  |<Fine>nXyQ]" +
+		"*C[T34E-7  |QA7  |D-7 G7 <D.S. al Coda> Z" +
+		"Y*DQ{fC^7   <3x>}"
+	songs, err := Decode("irealbook://" + url.PathEscape("Test=Composer=Swing=C=n="+music))
+	require.NoError(t, err)
+	song := songs[0]
+
+	names := []string{}
+	for _, section := range song.Sections {
+		names = append(names, section.Name)
+	}
+	assert.Equal(t, []string{"", "A", "B", "C", "D"}, names)
+
+	a := song.Sections[1]
+	require.Len(t, a.Lines, 2)
+	first := a.Lines[0].Bars
+	require.Len(t, first, 3)
+	assert.True(t, first[0].RepeatStart)
+	assert.Equal(t, []string{"Cmaj7"}, chords(first[0]))
+	assert.Equal(t, "1", first[2].Ending.Label)
+	assert.True(t, first[2].EndingStart)
+	assert.True(t, first[2].RepeatEnd)
+	second := a.Lines[1].Bars
+	assert.Equal(t, "2", second[0].Ending.Label)
+	assert.True(t, second[0].DoubleBarEnd)
+
+	b := song.Sections[2].Lines[0].Bars
+	require.Len(t, b, 5)
+	assert.Equal(t, []domain.Navigation{domain.Segno}, b[0].Navigation)
+	assert.Equal(t, []string{"%"}, chords(b[0]))
+	assert.Equal(t, []string{"Fmaj7", "Bb7", ".", "."}, chords(b[1]))
+	assert.Equal(t, []string{"%%"}, chords(b[2]))
+	assert.Equal(t, []string{"%%"}, chords(b[3]))
+	assert.Equal(t, []string{"N.C."}, chords(b[4]))
+	assert.Equal(t, []domain.Navigation{domain.Fine}, b[4].Navigation)
+	assert.True(t, b[4].DoubleBarEnd)
+
+	c := song.Sections[3].Lines[0].Bars
+	require.Len(t, c, 3)
+	assert.True(t, c[0].MeterChange)
+	assert.Equal(t, domain.Meter{Beats: 3, Unit: 4}, c[1].Meter)
+	assert.Equal(t, []domain.Navigation{domain.ToCoda}, c[0].Navigation)
+	assert.Equal(t, []domain.Navigation{domain.DalSegnoAlCoda}, c[2].Navigation)
+
+	d := song.Sections[4].Lines[0].Bars
+	require.Len(t, d, 1)
+	assert.Equal(t, []domain.Navigation{domain.Coda}, d[0].Navigation)
+	assert.Equal(t, "fermata", d[0].Chords[0].Annotation.Value)
+	assert.True(t, d[0].RepeatEnd)
+	assert.Equal(t, 3, d[0].RepeatCount)
+}
+
+func TestDecodeBeats(t *testing.T) {
+	testCases := []struct {
+		music    string
+		expected []string
+	}{
+		{music: "C^7XyQ|", expected: []string{"Cmaj7"}},
+		{music: "C^7 G7 |", expected: []string{"Cmaj7", "G7"}},
+		{music: "C,G  |", expected: []string{"C", "G", ".", "."}},
+		{music: "C D E |", expected: []string{"C", "D", "E"}},
+		{music: "C p p p |", expected: []string{"C", "/", "/", "/"}},
+		{music: "C^7(A7) |", expected: []string{"Cmaj7"}},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.music, func(t *testing.T) {
+			songs, err := Decode("irealbook://" + url.PathEscape("Test=Composer=Swing=C=n="+tC.music))
+			require.NoError(t, err)
+			assert.Equal(t, tC.expected, chords(bars(songs[0])[0]))
+		})
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	testCases := []struct {
+		desc string
+		link string
+		err  string
+	}{
+		{desc: "not a link", link: "https://example.com", err: "not an iReal Pro link"},
+		{desc: "bad escape", link: "irealb://Test%zz", err: "invalid iReal Pro link"},
+		{desc: "missing fields", link: "irealb://Test=Composer", err: "song 1: missing fields"},
+		{desc: "bad key", link: "irealbook://Test=Composer=Swing=H=n=C |", err: "invalid key"},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			_, err := Decode(tC.link)
+			assert.ErrorContains(t, err, tC.err)
+		})
+	}
+}
+
+func TestWriteMusic(t *testing.T) {
+	song, err := internal.ParseSongFromString(`---
+key: C
+---
+
+# A
+
+||: "Head" Cmaj7 | Am7 | [1 Dm7 G7 :||[2 !segno! Dm7 . G7 . ||
+
+# Bridge
+
+(3/4) % | !fermata!Em7 A7 . !tocoda! | N.C. !D.S.alcoda! | %% | %% ||
+
+# Coda
+
+!coda! (4/4) 6m7 | 2m7 5 :|| 4x
+`)
+	require.NoError(t, err)
+	music, err := writeMusic(song)
+	require.NoError(t, err)
+	assert.Equal(t, "*A{T44<Head>C^7   |A-7   |N1D-7 G7 }N2SD-7 G7 ]"+
+		"*B[T34 x |fE-7,A7 |Q<D.S. al Coda>n  |r  |   ]"+
+		"*C[T44QA-7   |<4x>D-7 G }", music)
+}
+
+func TestEncode(t *testing.T) {
+	song, err := internal.ParseSongFromString(`---
+title: Blue Bossa
+composer: Kenny Dorham
+style: Bossa Nova
+key: Cm
+tempo: 140
+---
+
+# A
+
+Cm7 | Fm7 | Dm7b5 | G7b9 ||
+`)
+	require.NoError(t, err)
+	link, err := Encode(song)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(link, "irealb://Blue%20Bossa%3DDorham%20Kenny%3D%3DBossa%20Nova%3DC-%3D%3D1r34LbKcu7"))
+	assert.NotContains(t, link, "+")
+
+	songs, err := Decode(link)
+	require.NoError(t, err)
+	require.Len(t, songs, 1)
+	assert.Equal(t, song.FrontMatter, songs[0].FrontMatter)
+	assert.Equal(t, internal.PrintLesheet(song), internal.PrintLesheet(songs[0]))
+}
+
+func TestEncodeDefaults(t *testing.T) {
+	song, err := internal.ParseSongFromString("C | G\n")
+	require.NoError(t, err)
+	link, err := Encode(song)
+	require.NoError(t, err)
+	songs, err := Decode(link)
+	require.NoError(t, err)
+	require.Len(t, songs, 1)
+	assert.Equal(t, map[string]string{"composer": "Unknown", "style": "Medium Swing", "key": "C"}, songs[0].FrontMatter)
+	assert.Equal(t, []string{"G"}, chords(bars(songs[0])[1]))
+}
+
+func TestEncodeRoundTrip(t *testing.T) {
+	source := `---
+composer: Miles Davis
+key: C
+style: Medium Swing
+title: Test
+---
+
+# A
+
+||: Cmaj7 | Am7 | Dm7 G7 | Em7 A7 :||x2
+Dm7 | G7 | % | Cmaj7 ||
+
+# B
+
+!segno! Fmaj7 Bb7 | %% | %% | Em7b5 A7b9 ||
+Dm7 | G7 | Cmaj7 | N.C. !D.S.alfine! ||
+`
+	song, err := internal.ParseSongFromString(source)
+	require.NoError(t, err)
+	link, err := Encode(song)
+	require.NoError(t, err)
+	songs, err := Decode(link)
+	require.NoError(t, err)
+	assert.Equal(t, source, internal.PrintLesheet(songs[0]))
+}
+
+func TestSwapBlocks(t *testing.T) {
+	text := "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
+	swapped := swapBlocks(text)
+	assert.Equal(t, "XWVUTfghijNMLKJIHGFEDCBAyzxwvutsrqponmlkOPQRSedcbaYZ", swapped)
+	assert.Equal(t, text, swapBlocks(swapped))
+	// The last block is left as it is when it's shorter than 52 characters
+	assert.Equal(t, text[:51], swapBlocks(text[:51]))
+}
+
+func TestFindLinks(t *testing.T) {
+	html := `<html><body><a href="irealb://Blue%20Bossa%3DDorham%20Kenny">Blue Bossa</a>
+<a href="irealbook://Solar=Davis%20Miles=Medium%20Swing=C-=n=C">Solar</a></body></html>`
+	assert.Equal(t, []string{
+		"irealb://Blue%20Bossa%3DDorham%20Kenny",
+		"irealbook://Solar=Davis%20Miles=Medium%20Swing=C-=n=C",
+	}, FindLinks(html))
+	assert.True(t, IsLink("irealb://Test"))
+	assert.False(t, IsLink("song.lesheet"))
+}
@@ -0,0 +1,347 @@
+package ireal
+
+import (
+	"lesheets/internal/domain"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// rowCells is the number of cells of a row of an iReal Pro chart.
+const rowCells = 16
+
+// sectionNames are the names of the section marks, *A to *D keep their letter.
+var sectionNames = map[byte]string{'i': "Intro", 'V': "Verse"}
+
+// cell is a cell of a bar: a chord, a sign written in place of one, or "" for an empty cell.
+type cell struct {
+	value    string
+	fermata  bool
+	position int
+}
+
+// pendingBar is the bar being read, with the marks written before its chords.
+type pendingBar struct {
+	cells       []cell
+	repeatStart bool
+	ending      string
+	notes       []string
+	navigation  []domain.Navigation
+	meter       *domain.Meter
+	repeatCount int
+}
+
+func (b *pendingBar) isEmpty() bool {
+	return !slices.ContainsFunc(b.cells, func(c cell) bool { return c.value != "" })
+}
+
+type reader struct {
+	song      *domain.Song
+	meter     domain.Meter
+	key       string
+	tempo     int
+	bar       pendingBar
+	ending    *domain.Ending
+	rowCells  int
+	newLine   bool
+	twoBars   bool // the bar after a "r" repeats the two bars before it too
+	codas     int
+	codaSigns int // the coda signs of the song, a single one is the coda
+	barsCount int
+	fermata   bool
+	started   bool
+}
+
+// readMusic reads the chord progression of a song. The section marks (*A, *i...) start sections, the
+// bar lines ({, }, [, ], |, Z) and the endings (N1...) are the bars and their repeats, "x" and "r"
+// repeat the bars before them and "n" is a N.C. The chords are placed on the beats of their bar when
+// it has a cell for each beat, and spread evenly otherwise. The comments (<...>) are bar notes, except
+// the navigation markers and the repeat counts (<3x>). The lines follow the rows of 16 cells.
+func readMusic(music string, frontMatter map[string]string) (*domain.Song, error) {
+	r := &reader{
+		song:      &domain.Song{FrontMatter: frontMatter, Sections: []domain.Section{{}}},
+		meter:     domain.DefaultMeter,
+		key:       frontMatter["key"],
+		codaSigns: strings.Count(music, "Q"),
+	}
+	if tempo, ok := frontMatter["tempo"]; ok {
+		r.tempo, _ = strconv.Atoi(tempo)
+	}
+	for i := 0; i < len(music); i++ {
+		switch ch := music[i]; ch {
+		case '*':
+			if i+1 < len(music) {
+				i++
+				r.section(music[i])
+			}
+		case '{':
+			r.endBar(false)
+			r.bar.repeatStart = true
+		case '[':
+			r.endBar(false)
+			r.doubleBarBefore()
+		case '|':
+			r.endBar(false)
+		case ']', 'Z':
+			r.endBar(false)
+			r.doubleBarBefore()
+		case '}':
+			r.endBar(true)
+		case 'T':
+			if i+2 < len(music) {
+				r.timeSignature(music[i+1 : i+3])
+				i += 2
+			}
+		case 'N':
+			if i+1 < len(music) && music[i+1] >= '1' && music[i+1] <= '9' {
+				r.bar.ending = music[i+1 : i+2]
+				i++
+			}
+		case '<':
+			end := strings.IndexByte(music[i:], '>')
+			if end < 0 {
+				end = len(music) - i
+			}
+			r.comment(music[i+1 : i+end])
+			i += end
+		case '(':
+			// An alternate chord, written small over the bar, is left out
+			if end := strings.IndexByte(music[i:], ')'); end >= 0 {
+				i += end
+			}
+		case 'S':
+			r.bar.navigation = append(r.bar.navigation, domain.Segno)
+		case 'Q':
+			r.coda()
+		case 'f':
+			r.fermata = true
+		case 'Y':
+			r.newLine = true
+		case ' ':
+			r.addCell("")
+		case 'n':
+			r.addCell("N.C.")
+		case 'p':
+			r.addCell("/")
+		case 'x':
+			r.addCell("%")
+		case 'r':
+			r.addCell("%%")
+		case 'W':
+			// An invisible root, written for a new bass under the chord before it
+			for i+1 < len(music) && (music[i+1] == '/' || isNote(music[i+1]) || music[i+1] == 'b' || music[i+1] == '#') {
+				i++
+			}
+			r.addCell("/")
+		default:
+			if isNote(ch) {
+				chord := readChord(music[i:])
+				r.addCell(chord.value)
+				i += chord.length - 1
+			}
+		}
+	}
+	r.endBar(false)
+	return r.song, nil
+}
+
+func isNote(ch byte) bool {
+	return ch >= 'A' && ch <= 'G'
+}
+
+func (r *reader) addCell(value string) {
+	c := cell{value: value, position: len(r.bar.cells)}
+	if value != "" && r.fermata {
+		c.fermata, r.fermata = true, false
+	}
+	r.bar.cells = append(r.bar.cells, c)
+}
+
+func (r *reader) section(mark byte) {
+	r.endBar(false)
+	name, ok := sectionNames[mark]
+	if !ok {
+		name = string(mark)
+	}
+	r.song.Sections = append(r.song.Sections, domain.Section{Name: name})
+	r.rowCells = 0
+}
+
+// timeSignature reads the digits of a time signature: "T44" is 4/4 and "T12" is 12/8.
+func (r *reader) timeSignature(digits string) {
+	value := digits[:1] + "/" + digits[1:]
+	if digits == "12" {
+		value = "12/8"
+	}
+	if meter, err := domain.ParseMeter(value); err == nil {
+		r.bar.meter = &meter
+	}
+}
+
+// coda reads a coda sign: when there are two, the first one is where the player leaves for the
+// coda, at the end of the bar before it, and the second one starts the coda.
+func (r *reader) coda() {
+	r.codas++
+	last := r.lastBar()
+	if r.codas > 1 || r.codaSigns < 2 || last == nil || !r.bar.isEmpty() {
+		r.bar.navigation = append(r.bar.navigation, domain.Coda)
+		return
+	}
+	last.Navigation = append(last.Navigation, domain.ToCoda)
+}
+
+// comment reads a comment, written "<*74text>" to be placed above the chords.
+func (r *reader) comment(text string) {
+	if len(text) > 3 && text[0] == '*' && text[1] >= '0' && text[1] <= '9' {
+		text = text[3:]
+	}
+	text = strings.TrimSpace(text)
+	normalized := strings.ToLower(strings.ReplaceAll(text, " ", ""))
+	for _, n := range domain.Navigations {
+		if normalized == strings.ToLower(strings.ReplaceAll(n.Text(), " ", "")) {
+			r.bar.navigation = append(r.bar.navigation, n)
+			return
+		}
+	}
+	count := strings.TrimSuffix(strings.TrimPrefix(normalized, "x"), "x")
+	if n, err := strconv.Atoi(count); err == nil && count != normalized && n > 1 {
+		r.bar.repeatCount = n
+		return
+	}
+	if text != "" {
+		r.bar.notes = append(r.bar.notes, text)
+	}
+}
+
+// doubleBarBefore puts a double bar line after the last bar read.
+func (r *reader) doubleBarBefore() {
+	if bar := r.lastBar(); bar != nil && !bar.RepeatEnd {
+		bar.DoubleBarEnd = true
+		r.ending = nil
+	}
+}
+
+// lastBar returns the last bar read, which can be in a section before the current one.
+func (r *reader) lastBar() *domain.Bar {
+	for i := len(r.song.Sections) - 1; i >= 0; i-- {
+		lines := r.song.Sections[i].Lines
+		for j := len(lines) - 1; j >= 0; j-- {
+			if bars := lines[j].Bars; len(bars) > 0 {
+				return &bars[len(bars)-1]
+			}
+		}
+	}
+	return nil
+}
+
+// endBar adds the bar read, if it has chords. The empty bars are left out, they're only there to lay
+// out the chart, except after a "r".
+func (r *reader) endBar(repeatEnd bool) {
+	pending := r.bar
+	r.rowCells += len(pending.cells)
+	rowEnd := r.rowCells >= rowCells
+	if rowEnd {
+		r.rowCells = 0
+	}
+	repeatsTwoBars := r.twoBars && pending.isEmpty()
+	r.twoBars = false
+	if pending.isEmpty() && !repeatsTwoBars {
+		r.newLine = r.newLine || rowEnd
+		if repeatEnd {
+			if bar := r.lastBar(); bar != nil {
+				bar.RepeatEnd = true
+				bar.RepeatCount = max(bar.RepeatCount, pending.repeatCount)
+				r.ending = nil
+			}
+			pending.repeatCount = 0
+		}
+		// The marks of an empty bar go to the next one
+		pending.cells = nil
+		r.bar = pending
+		return
+	}
+	r.bar = pendingBar{}
+	if pending.meter != nil && !r.started && *pending.meter != domain.DefaultMeter {
+		r.song.FrontMatter["time"] = pending.meter.String()
+	}
+	bar := domain.Bar{
+		RepeatStart: pending.repeatStart,
+		RepeatEnd:   repeatEnd,
+		RepeatCount: pending.repeatCount,
+		BarNote:     strings.Join(pending.notes, ", "),
+		Navigation:  pending.navigation,
+		Meter:       r.meter,
+		Key:         r.key,
+		Tempo:       r.tempo,
+		Id:          r.barsCount,
+	}
+	if pending.meter != nil {
+		bar.MeterChange = r.started && *pending.meter != r.meter
+		bar.Meter, r.meter = *pending.meter, *pending.meter
+	}
+	if pending.ending != "" {
+		r.ending, _ = domain.ParseEnding(pending.ending)
+		bar.EndingStart = true
+	} else if pending.repeatStart {
+		r.ending = nil
+	}
+	bar.Ending = r.ending
+	if repeatEnd {
+		r.ending = nil
+	}
+	if repeatsTwoBars {
+		bar.Chords = []domain.Chord{newChord("%%")}
+	} else {
+		bar.Chords = chordsOf(pending.cells, bar.Meter)
+		r.twoBars = bar.RepeatedBars() == 2
+	}
+	bar.PlaceBeats()
+	r.barsCount++
+	r.started = true
+
+	section := &r.song.Sections[len(r.song.Sections)-1]
+	if len(section.Lines) == 0 || r.newLine {
+		section.Lines = append(section.Lines, domain.Line{})
+		r.newLine = false
+	}
+	line := &section.Lines[len(section.Lines)-1]
+	line.Bars = append(line.Bars, bar)
+	r.newLine = r.newLine || rowEnd
+}
+
+func newChord(value string) domain.Chord {
+	return domain.Chord{Value: value, Annotation: &domain.Annotation{}}
+}
+
+// chordsOf returns the chords of the cells of a bar. When the bar has a cell for each beat, the
+// chords are placed on their beats with "." holding them, with as few beats as needed: "C . G .",
+// written on four cells, is "C G". The repeat signs fill their bar, wherever they're drawn.
+func chordsOf(cells []cell, meter domain.Meter) []domain.Chord {
+	filled := slices.DeleteFunc(slices.Clone(cells), func(c cell) bool { return c.value == "" })
+	if i := slices.IndexFunc(filled, func(c cell) bool { return c.value == "%" || c.value == "%%" }); i >= 0 {
+		filled = filled[i : i+1]
+	} else if len(cells) == meter.Beats {
+		step := len(cells)
+		for step > 1 && slices.ContainsFunc(filled, func(c cell) bool { return c.position%step != 0 || len(cells)%step != 0 }) {
+			step--
+		}
+		slots := []cell{}
+		for i := 0; i < len(cells); i += step {
+			if cells[i].value == "" {
+				slots = append(slots, cell{value: "."})
+			} else {
+				slots = append(slots, cells[i])
+			}
+		}
+		filled = slots
+	}
+	chords := []domain.Chord{}
+	for _, c := range filled {
+		chord := newChord(c.value)
+		if c.fermata {
+			chord.Annotation.Value = "fermata"
+		}
+		chords = append(chords, chord)
+	}
+	return chords
+}
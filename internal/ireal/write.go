@@ -0,0 +1,205 @@
+package ireal
+
+import (
+	"errors"
+	"lesheets/internal/domain"
+	"strconv"
+	"strings"
+)
+
+type writer struct {
+	sb      strings.Builder
+	prev    *domain.Bar
+	toCoda  bool // the bar before had a "To Coda", written as a coda sign on the next one
+	twoBars bool // the bar before was the first "%%" bar, the second is written empty
+}
+
+// writeMusic writes the chord progression of the song. Each bar takes a cell for each beat of its
+// meter when its chords fall on the beats, "C . G ." being written "C,G  ", so that the rows of 16
+// cells of iReal Pro hold four bars of 4/4. The sections are marked by their first letter, A to D,
+// or as an intro or a verse, and the bar notes and the jumps are comments. The ABC melodies have no
+// chords to write, their bars are N.C.
+func writeMusic(song *domain.Song) (string, error) {
+	w := &writer{}
+	bars := []*domain.Bar{}
+	marks := map[*domain.Bar]string{}
+	for i := range song.Sections {
+		section := &song.Sections[i]
+		first := true
+		for j := range section.Lines {
+			for k := range section.Lines[j].Bars {
+				bar := &section.Lines[j].Bars[k]
+				if first {
+					marks[bar] = sectionMark(section.Name)
+					first = false
+				}
+				bars = append(bars, bar)
+			}
+		}
+	}
+	for i, bar := range bars {
+		var next *domain.Bar
+		if i+1 < len(bars) {
+			next = bars[i+1]
+		}
+		if err := w.bar(bar, marks[bar], next); err != nil {
+			return "", errors.New("bar " + strconv.Itoa(bar.Number()) + ": " + err.Error())
+		}
+	}
+	return w.sb.String(), nil
+}
+
+// sectionMark returns the mark of a section of iReal Pro from its name, "" when there is none.
+func sectionMark(name string) string {
+	lower := strings.ToLower(name)
+	switch {
+	case name == "":
+		return ""
+	case strings.HasPrefix(lower, "intro"):
+		return "i"
+	case strings.HasPrefix(lower, "verse"):
+		return "V"
+	}
+	if mark := strings.ToUpper(name[:1]); strings.Contains("ABCD", mark) {
+		return mark
+	}
+	return ""
+}
+
+func (w *writer) bar(bar *domain.Bar, mark string, next *domain.Bar) error {
+	if mark != "" {
+		w.sb.WriteString("*" + mark)
+	}
+	switch {
+	case bar.RepeatStart:
+		w.sb.WriteString("{")
+	case w.prev == nil || w.prev.DoubleBarEnd:
+		w.sb.WriteString("[")
+	}
+	if w.prev == nil || bar.MeterChange {
+		w.sb.WriteString(timeSignature(bar.Meter))
+	}
+	if bar.EndingStart && bar.Ending != nil && len(bar.Ending.Label) == 1 {
+		w.sb.WriteString("N" + bar.Ending.Label)
+	}
+	for _, n := range bar.NavigationAt(true) {
+		if n == domain.Segno {
+			w.sb.WriteString("S")
+		} else {
+			w.sb.WriteString("Q")
+		}
+	}
+	if w.toCoda {
+		w.sb.WriteString("Q")
+		w.toCoda = false
+	}
+	if bar.BarNote != "" {
+		w.sb.WriteString("<" + bar.BarNote + ">")
+	}
+	for _, n := range bar.NavigationAt(false) {
+		if n == domain.ToCoda {
+			w.toCoda = true
+		} else {
+			w.sb.WriteString("<" + n.Text() + ">")
+		}
+	}
+	if bar.RepeatEnd && bar.RepeatCount > 0 {
+		w.sb.WriteString("<" + strconv.Itoa(bar.RepeatCount) + "x>")
+	}
+	cells, err := w.cells(bar)
+	if err != nil {
+		return err
+	}
+	for i, c := range cells {
+		switch {
+		case c == "":
+			w.sb.WriteString(" ")
+		case i > 0 && cells[i-1] != "":
+			w.sb.WriteString("," + c)
+		default:
+			w.sb.WriteString(c)
+		}
+	}
+	switch {
+	case bar.RepeatEnd:
+		w.sb.WriteString("}")
+	case next == nil:
+		w.sb.WriteString("Z")
+	case bar.DoubleBarEnd:
+		w.sb.WriteString("]")
+	case !next.RepeatStart:
+		w.sb.WriteString("|")
+	}
+	w.prev = bar
+	return nil
+}
+
+// timeSignature writes a meter as iReal Pro does, "T44" for 4/4 and "T12" for 12/8.
+func timeSignature(meter domain.Meter) string {
+	if meter.Beats == 12 && meter.Unit == 8 {
+		return "T12"
+	}
+	if meter.Beats > 9 || meter.Unit > 9 {
+		return ""
+	}
+	return "T" + strconv.Itoa(meter.Beats) + strconv.Itoa(meter.Unit)
+}
+
+// cells returns the cells of a bar, "" for the empty ones. The chords are on the cells of their beats
+// when they start on different beats, and take a cell each otherwise, without the dots.
+func (w *writer) cells(bar *domain.Bar) ([]string, error) {
+	beats := max(bar.Meter.Beats, 1)
+	cells := make([]string, beats)
+	switch {
+	case bar.Backtick.Value != "" || len(bar.Chords) == 0:
+		cells[0] = "n"
+		return cells, nil
+	case bar.RepeatedBars() == 1:
+		// The sign is drawn in the middle of the bar
+		cells[min(1, beats-1)] = "x"
+		return cells, nil
+	case bar.RepeatedBars() == 2:
+		if !w.twoBars {
+			cells[0] = "r"
+		}
+		w.twoBars = !w.twoBars
+		return cells, nil
+	}
+	w.twoBars = false
+	values := []string{}
+	onBeats := true
+	for _, chord := range bar.Chords {
+		value := ""
+		switch chord.Kind() {
+		case domain.KindPlaceholder:
+		case domain.KindSlash:
+			value = "p"
+		case domain.KindNoChord:
+			value = "n"
+		case domain.KindRepeatBar, domain.KindRepeatTwoBars:
+			value = "x"
+		default:
+			c, err := irealChord(chord.Value, bar.Key)
+			if err != nil {
+				return nil, err
+			}
+			value = c
+		}
+		if value != "" && chord.Annotation != nil && chord.Annotation.Value == "fermata" {
+			value = "f" + value
+		}
+		if value != "" {
+			values = append(values, value)
+		}
+		beat := int(chord.Beat)
+		if float64(beat) != chord.Beat || beat >= beats || (value != "" && cells[beat] != "") {
+			onBeats = false
+		} else if value != "" {
+			cells[beat] = value
+		}
+	}
+	if !onBeats {
+		return values, nil
+	}
+	return cells, nil
+}
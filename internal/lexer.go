@@ -4,16 +4,28 @@ import (
 	"errors"
 	"lesheets/internal/domain"
 	"lesheets/internal/logger"
-	"strconv"
+	"regexp"
 	"strings"
 	"unicode"
 )
 
+var (
+	repeatCount = regexp.MustCompile(`^(?:[xX][0-9]+|[0-9]+[xX])$`)
+	meterChange = regexp.MustCompile(`^\([0-9]+/[0-9]+\)`)
+)
+
 type Lexer struct {
 	source string
 	input  string
 	pos    int
 	line   int
+	col    int
+	// err is the last error found, and errorSpan where it was found
+	err       error
+	errorSpan domain.Span
+	// lastEnd is where the last token consumed ends, the text from there to the next token is its
+	// leading trivia
+	lastEnd domain.Position
 }
 
 func NewLexer(input string) *Lexer {
@@ -46,15 +58,63 @@ func (l *Lexer) eof() bool {
 }
 
 func (l *Lexer) advance() {
+	if l.nextChar() == '\n' {
+		l.line++
+		l.col = 0
+	} else {
+		l.col++
+	}
 	l.pos++
 }
 
+func (l *Lexer) advanceN(n int) {
+	for range n {
+		l.advance()
+	}
+}
+
+// Position returns the position of the next character to be read.
+func (l *Lexer) Position() domain.Position {
+	return domain.Position{Offset: l.pos, Line: l.line, Column: l.col}
+}
+
+func (l *Lexer) setPosition(p domain.Position) {
+	l.pos = p.Offset
+	l.line = p.Line
+	l.col = p.Column
+}
+
+// repeatCountLength returns the length of the repeat count written at the current position, like x3
+// or 3x, or 0 when there is none. A count only follows a repeat end ":||".
+func (l *Lexer) repeatCountLength() int {
+	before := strings.TrimRight(l.input[:l.pos], " \t")
+	if !strings.HasSuffix(before, ":||") {
+		return 0
+	}
+	end := l.pos
+	for end < len(l.input) && !unicode.IsSpace(rune(l.input[end])) && l.input[end] != '|' {
+		end++
+	}
+	if !repeatCount.MatchString(l.input[l.pos:end]) {
+		return 0
+	}
+	return end - l.pos
+}
+
+// atLineStart tells whether there is only whitespace between the start of the line and the next
+// character.
+func (l *Lexer) atLineStart() bool {
+	for i := l.pos - 1; i >= 0 && l.input[i] != '\n'; i-- {
+		if l.input[i] != ' ' && l.input[i] != '\t' {
+			return false
+		}
+	}
+	return true
+}
+
 func (l *Lexer) consumeWhitespaces() {
 	ch := l.nextChar()
 	for ch == ' ' || ch == '\t' || ch == '\r' {
-		if ch == '\n' || ch == '\r' {
-			l.line++
-		}
 		l.advance()
 		ch = l.nextChar()
 	}
@@ -63,20 +123,23 @@ func (l *Lexer) consumeWhitespaces() {
 func (l *Lexer) consumeWhitespacesAndNewLines() {
 	ch := l.nextChar()
 	for ch == ' ' || ch == '\t' || ch == '\r' || ch == '\n' {
-		if ch == '\n' || ch == '\r' {
-			l.line++
-		}
 		l.advance()
 		ch = l.nextChar()
 	}
 }
 
-func ErrGeneric(context string, want string, got string) error {
-	return errors.New("unexpected string " + context + "Want: <" + want + "> Got: <" + got + ">")
+// ErrGeneric is the error of a string the lexer can't read. The message holds on one line, the
+// position of the string goes to the span of its diagnostic.
+func ErrGeneric(want string, got string) error {
+	return errors.New("unexpected string, want <" + want + "> got <" + escapeNewLines(got) + ">")
+}
+
+func ErrInvalidFrontmatter(want string, got string) error {
+	return errors.New("invalid frontmatter, want <" + want + "> got <" + escapeNewLines(got) + ">")
 }
 
-func ErrInvalidFrontmatter(context string, want string, got string) error {
-	return errors.New("invalid frontmatter " + context + "Want: <" + want + "> Got: <" + got + "> ")
+func escapeNewLines(s string) string {
+	return strings.ReplaceAll(s, "\n", "\\n")
 }
 
 func (l *Lexer) consumeFrontmatter() (*domain.Token, error) {
@@ -86,15 +149,12 @@ func (l *Lexer) consumeFrontmatter() (*domain.Token, error) {
 		l.advance()
 	}
 	if l.getPos(start, 3) != "---" {
-		return nil, ErrInvalidFrontmatter(l.SurroundingString(), "Opening ---", l.getPos(start, 3))
+		return nil, ErrInvalidFrontmatter("Opening ---", l.getPos(start, 3))
 	}
 
 	// body
 	start = l.pos
 	for !l.eof() && l.nextChar() != '-' {
-		if l.nextChar() == '\n' || l.nextChar() == '\r' {
-			l.line++
-		}
 		l.advance()
 	}
 	value := l.input[start:l.pos]
@@ -105,7 +165,7 @@ func (l *Lexer) consumeFrontmatter() (*domain.Token, error) {
 		l.advance()
 	}
 	if l.input[start:l.pos] != "---" {
-		return nil, ErrInvalidFrontmatter(l.SurroundingString(), "Closing ---", l.getPos(start, 3))
+		return nil, ErrInvalidFrontmatter("Closing ---", l.getPos(start, 3))
 	}
 
 	return &domain.Token{
@@ -115,11 +175,10 @@ func (l *Lexer) consumeFrontmatter() (*domain.Token, error) {
 }
 
 func (l *Lexer) Lookahead() (*domain.Token, error) {
-	prev := l.pos
-	line := l.line
+	prev, prevEnd := l.Position(), l.lastEnd
 	tok, err := l.ConsumeNextToken()
-	l.pos = prev
-	l.line = line
+	l.setPosition(prev)
+	l.lastEnd = prevEnd
 	if err != nil {
 		return nil, err
 	}
@@ -128,6 +187,129 @@ func (l *Lexer) Lookahead() (*domain.Token, error) {
 
 func (l *Lexer) ConsumeNextToken() (*domain.Token, error) {
 	l.consumeWhitespaces()
+	// Comments
+	for l.getPos(l.pos, 2) == "//" {
+		l.consumeComment()
+		l.consumeWhitespaces()
+	}
+	start := l.Position()
+	tok, err := l.consumeToken()
+	if err != nil {
+		l.err = err
+		l.errorSpan = domain.Span{Start: start, End: l.Position()}
+		return nil, err
+	}
+	tok.Span = domain.Span{Start: start, End: l.Position()}
+	if tok.Type == domain.TokenEof {
+		tok.Span.End = start
+	}
+	tok.Text = l.slice(start.Offset, tok.Span.End.Offset)
+	tok.Leading = l.trivia(l.lastEnd, start.Offset)
+	l.lastEnd = tok.Span.End
+	return tok, nil
+}
+
+// EofToken returns the end of file token with all the text not consumed yet as leading trivia, to
+// close the syntax tree when parsing stops before the end.
+func (l *Lexer) EofToken() domain.Token {
+	end := l.lastEnd
+	for end.Offset < len(l.input) {
+		if l.input[end.Offset] == '\n' {
+			end.Line++
+			end.Column = 0
+		} else {
+			end.Column++
+		}
+		end.Offset++
+	}
+	return domain.Token{
+		Type:    domain.TokenEof,
+		Span:    domain.Span{Start: end, End: end},
+		Leading: l.trivia(l.lastEnd, len(l.input)),
+	}
+}
+
+// slice returns the input between two offsets, which can be past the end after the EOF token.
+func (l *Lexer) slice(start int, end int) string {
+	end = min(end, len(l.input))
+	start = min(start, end)
+	return l.input[start:end]
+}
+
+// trivia splits the text from a position up to an offset in whitespace, comments and skipped text.
+func (l *Lexer) trivia(from domain.Position, to int) []domain.Trivia {
+	var res []domain.Trivia
+	text := l.slice(from.Offset, to)
+	pos := from
+	for i := 0; i < len(text); {
+		start, kind := i, domain.TriviaSkipped
+		switch {
+		case strings.IndexByte(" \t\r\n", text[i]) >= 0:
+			kind = domain.TriviaWhitespace
+			for i < len(text) && strings.IndexByte(" \t\r\n", text[i]) >= 0 {
+				i++
+			}
+		case strings.HasPrefix(text[i:], "//"):
+			kind = domain.TriviaComment
+			for i < len(text) && text[i] != '\n' {
+				i++
+			}
+		default:
+			for i < len(text) && strings.IndexByte(" \t\r\n", text[i]) < 0 && !strings.HasPrefix(text[i:], "//") {
+				i++
+			}
+		}
+		startPos := pos
+		for _, ch := range []byte(text[start:i]) {
+			if ch == '\n' {
+				pos.Line++
+				pos.Column = 0
+			} else {
+				pos.Column++
+			}
+			pos.Offset++
+		}
+		res = append(res, domain.Trivia{Kind: kind, Text: text[start:i], Span: domain.Span{Start: startPos, End: pos}})
+	}
+	return res
+}
+
+// ErrorSpan returns the source span of the last error returned by the lexer.
+func (l *Lexer) ErrorSpan() domain.Span {
+	return l.errorSpan
+}
+
+// skipToBarBoundary skips the input up to the next bar line or line break, so that parsing can go
+// on after an error.
+func (l *Lexer) skipToBarBoundary() {
+	if !l.eof() && l.nextChar() != '\n' {
+		l.advance()
+	}
+	for !l.eof() && l.nextChar() != '|' && l.nextChar() != '\n' {
+		l.advance()
+	}
+	// A bar line closing the line belongs to the skipped bar, there is no bar after it
+	end := l.pos
+	for end < len(l.input) && strings.IndexByte("|: \t\r", l.input[end]) >= 0 {
+		end++
+	}
+	if end == len(l.input) || l.input[end] == '\n' {
+		l.advanceN(end - l.pos)
+	}
+}
+
+func (l *Lexer) consumeComment() {
+	start := l.pos
+	for l.pos < len(l.input) && l.input[l.pos] != '\n' {
+		l.advance()
+	}
+	// consume newline only if the comment started in a new line
+	if l.getPos(start-1, 1) == "\n" {
+		l.advance()
+	}
+}
+
+func (l *Lexer) consumeToken() (*domain.Token, error) {
 	if l.eof() {
 		l.pos++
 		return &domain.Token{
@@ -148,13 +330,13 @@ func (l *Lexer) ConsumeNextToken() (*domain.Token, error) {
 	}
 	if ch == ':' {
 		if l.getPos(l.pos, 3) != ":||" {
-			return nil, ErrGeneric(l.SurroundingString(), ":||", l.getPos(l.pos, 3))
+			return nil, ErrGeneric(":||", l.getPos(l.pos, 3))
 		}
 		tok := domain.Token{
 			Type:  domain.TokenBar,
 			Value: ":||",
 		}
-		l.pos += 3
+		l.advanceN(3)
 		return &tok, nil
 	}
 	// Single bar
@@ -164,14 +346,14 @@ func (l *Lexer) ConsumeNextToken() (*domain.Token, error) {
 				Type:  domain.TokenBar,
 				Value: "||:",
 			}
-			l.pos += 3
+			l.advanceN(3)
 			return &tok, nil
 		} else if l.getPos(l.pos, 2) == "||" {
 			tok := domain.Token{
 				Type:  domain.TokenBar,
 				Value: "||",
 			}
-			l.pos += 2
+			l.advanceN(2)
 			return &tok, nil
 		} else {
 			tok := domain.Token{
@@ -183,18 +365,6 @@ func (l *Lexer) ConsumeNextToken() (*domain.Token, error) {
 		}
 	}
 
-	// Comment
-	if l.getPos(l.pos, 2) == "//" {
-		start := l.pos
-		for l.pos < len(l.input) && l.input[l.pos] != '\n' {
-			l.advance()
-		}
-		// consume newline only if the comment started in a new line
-		if l.getPos(start-1, 1) == "\n" {
-			l.advance()
-		}
-		return l.ConsumeNextToken()
-	}
 	// Annotation
 	if ch == '!' {
 		l.advance()
@@ -203,7 +373,7 @@ func (l *Lexer) ConsumeNextToken() (*domain.Token, error) {
 			l.advance()
 		}
 		if l.nextChar() != '!' {
-			return nil, ErrGeneric(l.SurroundingString(), "!", string(l.nextChar()))
+			return nil, ErrGeneric("!", l.getPos(l.pos, 1))
 		}
 		tok := domain.Token{
 			Type:  domain.TokenAnnotation,
@@ -226,7 +396,7 @@ func (l *Lexer) ConsumeNextToken() (*domain.Token, error) {
 		}
 
 		if l.pos >= len(l.input) || l.input[l.pos] != '"' {
-			return nil, ErrGeneric(l.SurroundingString(), "\"", l.getPos(l.pos, 1))
+			return nil, ErrGeneric("\"", l.getPos(l.pos, 1))
 		}
 		// consume closing "
 		l.advance() // skip closing "
@@ -237,20 +407,20 @@ func (l *Lexer) ConsumeNextToken() (*domain.Token, error) {
 	if ch == '`' {
 		// Backtick multiline
 		if l.pos+3 < len(l.input) && l.getPos(l.pos, 3) == "```" {
-			l.pos += 3
+			l.advanceN(3)
 			l.consumeWhitespacesAndNewLines()
 			start := l.pos
 			for l.pos < len(l.input) && l.input[l.pos] != '`' {
 				l.advance()
 			}
 			if l.pos+3 > len(l.input) || l.getPos(l.pos, 3) != "```" {
-				return nil, ErrGeneric(l.SurroundingString(), "Closing ```", l.getPos(l.pos, 3))
+				return nil, ErrGeneric("Closing ```", l.getPos(l.pos, 3))
 			}
 			tok := domain.Token{
 				Type:  domain.TokenBacktickMultiline,
 				Value: l.input[start:l.pos],
 			}
-			l.pos += 3
+			l.advanceN(3)
 			return &tok, nil
 		} else {
 			// Backtick inline
@@ -265,7 +435,7 @@ func (l *Lexer) ConsumeNextToken() (*domain.Token, error) {
 			}
 
 			if l.pos >= len(l.input) || l.input[l.pos] != '`' {
-				return nil, ErrGeneric(l.SurroundingString(), "`", l.getPos(l.pos, 1))
+				return nil, ErrGeneric("`", l.getPos(l.pos, 1))
 			}
 			l.advance()
 			return &tok, nil
@@ -287,9 +457,6 @@ func (l *Lexer) ConsumeNextToken() (*domain.Token, error) {
 		for l.pos < len(l.input) && l.input[l.pos] != '\n' {
 			l.advance()
 		}
-		if l.nextChar() == '\n' {
-			l.line++
-		}
 		tok := domain.Token{
 			Type:  tokenType,
 			Value: strings.TrimSpace(l.input[start:l.pos]),
@@ -298,6 +465,54 @@ func (l *Lexer) ConsumeNextToken() (*domain.Token, error) {
 		return &tok, nil
 	}
 
+	// Repeat count after a repeat end, x3 or 3x
+	if n := l.repeatCountLength(); n > 0 {
+		tok := domain.Token{
+			Type:  domain.TokenRepeatCount,
+			Value: strings.Trim(l.input[l.pos:l.pos+n], "xX"),
+		}
+		l.advanceN(n)
+		return &tok, nil
+	}
+
+	// Meter change, (3/4)
+	if m := meterChange.FindString(l.input[l.pos:]); ch == '(' && m != "" {
+		tok := domain.Token{
+			Type:  domain.TokenMeter,
+			Value: m[1 : len(m)-1],
+		}
+		l.advanceN(len(m))
+		return &tok, nil
+	}
+
+	// Ending, [1 or [1,2 or [1-3
+	if ch == '[' && l.pos+1 < len(l.input) && unicode.IsDigit(rune(l.input[l.pos+1])) {
+		l.advance()
+		start := l.pos
+		for l.pos < len(l.input) && (unicode.IsDigit(rune(l.input[l.pos])) || l.input[l.pos] == ',' || l.input[l.pos] == '-') {
+			l.advance()
+		}
+		tok := domain.Token{
+			Type:  domain.TokenEnding,
+			Value: l.input[start:l.pos],
+		}
+		return &tok, nil
+	}
+
+	// Lyrics, a line starting with >
+	if ch == '>' && l.atLineStart() {
+		l.advance()
+		start := l.pos
+		for l.pos < len(l.input) && l.input[l.pos] != '\n' && l.getPos(l.pos, 2) != "//" {
+			l.advance()
+		}
+		tok := domain.Token{
+			Type:  domain.TokenLyrics,
+			Value: strings.TrimRight(l.input[start:l.pos], " \t\r"),
+		}
+		return &tok, nil
+	}
+
 	// If after a chord there is a \n, close the bar, and start new line
 	if l.nextChar() == '\n' {
 		l.consumeWhitespacesAndNewLines()
@@ -331,37 +546,26 @@ func (l *Lexer) Lex() ([]domain.Token, error) {
 	return tokens, nil
 }
 
-func (l *Lexer) replaceNewLine(r rune) string {
-	if r == '\n' {
-		return "\\n"
-	} else {
-		return string(r)
-	}
-}
-
-func (l *Lexer) SurroundingString() string {
-	context := SURROUNDING_CONTEXT
-	start := max(0, l.pos-context)
-	end := min(len(l.input), l.pos+context)
-	sb := strings.Builder{}
-	sb.WriteString("at pos " + strconv.Itoa(l.pos) + " ")
-	sb.WriteString("line " + strconv.Itoa(l.line) + " ")
-	sb.WriteString("near:\n")
-	pos := start
-	for i := start; i < end; i++ {
-		str := l.replaceNewLine(rune(l.input[i]))
-		sb.WriteString(str)
-		if i < l.pos {
-			pos += len(str)
+// Tokens scans all the tokens in the input, skipping the text that can't be read instead of stopping
+// at the first error, as editors need the tokens of songs still being written.
+func (l *Lexer) Tokens() []domain.Token {
+	var tokens []domain.Token
+	for {
+		start := l.Position()
+		tok, err := l.ConsumeNextToken()
+		if err != nil {
+			l.setPosition(start)
+			l.skipToBarBoundary()
+			if l.pos == start.Offset {
+				l.advance()
+			}
+			continue
 		}
+		if tok.Type == domain.TokenEof {
+			return tokens
+		}
+		tokens = append(tokens, *tok)
 	}
-	sb.WriteString("\n")
-	for i := start; i < pos; i++ {
-		sb.WriteString(" ")
-	}
-	sb.WriteString("^")
-	sb.WriteString("\n")
-	return sb.String()
 }
 
 func (l *Lexer) PrintTokens() {
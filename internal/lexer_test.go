@@ -87,7 +87,7 @@ func TestLexBacktick(t *testing.T) {
 func TestLexBacktickUnclosed(t *testing.T) {
 	lex := NewLexer("`backtick")
 	_, err := lex.ConsumeNextToken()
-	assert.Equal(t, ErrGeneric(lex.SurroundingString(), "`", "EndOfFile"), err)
+	assert.Equal(t, ErrGeneric("`", "EndOfFile"), err)
 }
 
 func TestLexMultilineBacktick(t *testing.T) {
@@ -101,7 +101,7 @@ func TestLexMultilineBacktick(t *testing.T) {
 func TestLexBacktickMultilineUnclosed(t *testing.T) {
 	lex := NewLexer("```backtick``")
 	_, err := lex.ConsumeNextToken()
-	assert.Equal(t, ErrGeneric(lex.SurroundingString(), "Closing ```", "EndOfFile"), err)
+	assert.Equal(t, ErrGeneric("Closing ```", "EndOfFile"), err)
 }
 
 func TestLexIgnoresComments(t *testing.T) {
@@ -188,3 +188,54 @@ func TestLexChord(t *testing.T) {
 	tok, _ = lex.ConsumeNextToken()
 	assert.Equal(t, domain.TokenChord, tok.Type)
 }
+
+func TestLexTokenSpans(t *testing.T) {
+	lex := NewLexer("# Verse\n// a comment\nCmaj7 | !push!D\n`ab`")
+	toks, err := lex.Lex()
+	assert.NoError(t, err)
+
+	expected := []struct {
+		typ   domain.TokenType
+		start domain.Position
+		end   domain.Position
+	}{
+		{domain.TokenHeader, domain.Position{Offset: 0, Line: 0, Column: 0}, domain.Position{Offset: 8, Line: 1, Column: 0}},
+		{domain.TokenChord, domain.Position{Offset: 21, Line: 2, Column: 0}, domain.Position{Offset: 26, Line: 2, Column: 5}},
+		{domain.TokenBar, domain.Position{Offset: 27, Line: 2, Column: 6}, domain.Position{Offset: 28, Line: 2, Column: 7}},
+		{domain.TokenAnnotation, domain.Position{Offset: 29, Line: 2, Column: 8}, domain.Position{Offset: 35, Line: 2, Column: 14}},
+		{domain.TokenChord, domain.Position{Offset: 35, Line: 2, Column: 14}, domain.Position{Offset: 36, Line: 2, Column: 15}},
+		{domain.TokenReturn, domain.Position{Offset: 36, Line: 2, Column: 15}, domain.Position{Offset: 37, Line: 3, Column: 0}},
+		{domain.TokenBacktick, domain.Position{Offset: 37, Line: 3, Column: 0}, domain.Position{Offset: 41, Line: 3, Column: 4}},
+	}
+	assert.Equal(t, len(expected), len(toks))
+	for i, e := range expected {
+		assert.Equal(t, e.typ, toks[i].Type)
+		assert.Equal(t, e.start, toks[i].Span.Start, "start of token %d", i)
+		assert.Equal(t, e.end, toks[i].Span.End, "end of token %d", i)
+	}
+}
+
+func TestLexTokensSkipsErrors(t *testing.T) {
+	tokens := NewLexer("| C : D | !push E |\n| F |").Tokens()
+	values := []string{}
+	for _, tok := range tokens {
+		values = append(values, string(tok.Type)+" "+tok.Value)
+	}
+	assert.Equal(t, []string{"Bar |", "Chord C", "Bar |", "Return \n", "Bar |", "Chord F", "Bar |"}, values)
+}
+
+func TestLexRecordsComments(t *testing.T) {
+	p := NewParser(NewLexer("// first\nD | E // second\r\nF\n"))
+	song, err := p.ParseSong()
+	assert.NoError(t, err)
+	assert.Equal(t, []domain.Comment{
+		{Value: " first", Span: domain.Span{
+			Start: domain.Position{Offset: 0, Line: 0, Column: 0},
+			End:   domain.Position{Offset: 8, Line: 0, Column: 8},
+		}},
+		{Value: " second", Span: domain.Span{
+			Start: domain.Position{Offset: 15, Line: 1, Column: 6},
+			End:   domain.Position{Offset: 25, Line: 1, Column: 16},
+		}},
+	}, song.Comments)
+}
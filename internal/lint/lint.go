@@ -0,0 +1,209 @@
+package lint
+
+import (
+	"lesheets/internal"
+	"lesheets/internal/domain"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Lint parses a song and checks it, returning the parse errors along with the problems found by the
+// checks, sorted by position.
+func Lint(filename string, sourceCode string) domain.Diagnostics {
+	diagnostics := domain.Diagnostics{}
+	song, err := internal.ParseSongFromStringWithFileName(filename, sourceCode)
+	if parseDiagnostics, ok := err.(domain.Diagnostics); ok {
+		diagnostics = append(diagnostics, parseDiagnostics...)
+	} else if err != nil {
+		diagnostics = append(diagnostics, domain.Diagnostic{
+			Severity: domain.SeverityError,
+			Code:     "syntax-error",
+			Message:  err.Error(),
+		})
+	}
+	if song != nil {
+		diagnostics = append(diagnostics, Check(song)...)
+	}
+	slices.SortStableFunc(diagnostics, func(a, b domain.Diagnostic) int {
+		return a.Span.Start.Offset - b.Span.Start.Offset
+	})
+	return diagnostics
+}
+
+// Check runs the music-aware checks on a parsed song.
+func Check(song *domain.Song) domain.Diagnostics {
+	c := checker{}
+	c.checkFrontMatter(song)
+	c.checkChords(song)
+	c.checkRepeats(song)
+	c.checkSections(song)
+	c.checkLyrics(song)
+	c.checkNavigation(song)
+	c.checkSimiles(song)
+	return c.diagnostics
+}
+
+type checker struct {
+	diagnostics domain.Diagnostics
+}
+
+func (c *checker) report(severity domain.Severity, code string, message string, span domain.Span) {
+	c.diagnostics = append(c.diagnostics, domain.Diagnostic{
+		Severity: severity,
+		Code:     code,
+		Message:  message,
+		Span:     span,
+	})
+}
+
+func (c *checker) checkFrontMatter(song *domain.Song) {
+	if strings.TrimSpace(song.FrontMatter["title"]) == "" {
+		c.report(domain.SeverityWarning, "missing-title", "the song has no title in the front matter", domain.Span{})
+	}
+	key := song.Key()
+	if key == "" {
+		c.report(domain.SeverityWarning, "missing-key", "the song has no key in the front matter", domain.Span{})
+	} else if _, err := domain.ParseKey(key); err != nil {
+		c.report(domain.SeverityError, "invalid-key", err.Error(), domain.Span{})
+	}
+	if _, err := song.Meter(); err != nil {
+		c.report(domain.SeverityError, "invalid-time", err.Error(), domain.Span{})
+	}
+	if _, err := song.Tempo(); err != nil {
+		c.report(domain.SeverityError, "invalid-tempo", err.Error(), domain.Span{})
+	}
+}
+
+// checkChords reports unknown annotations and invalid chords, and warns when Nashville numbers and
+// letter chords are mixed: the first notation found is taken as the one of the song.
+func (c *checker) checkChords(song *domain.Song) {
+	var nashville *bool
+	for _, chord := range chords(song) {
+		if chord.Annotation != nil && !chord.Annotation.IsKnown() {
+			c.report(domain.SeverityWarning, "unknown-annotation",
+				"unknown annotation \"!"+chord.Annotation.Value+"!\", use one of "+strings.Join(domain.KnownAnnotations, ", "),
+				domain.Span{Start: chord.Span.Start, End: chord.ValueSpan().Start})
+		}
+		if !chord.IsChordSymbol() {
+			continue
+		}
+		symbol, err := chord.Symbol()
+		if err != nil {
+			c.report(domain.SeverityError, "invalid-chord", err.Error(), chord.ValueSpan())
+			continue
+		}
+		isNashville := symbol.IsNashville()
+		if nashville == nil {
+			nashville = &isNashville
+		} else if *nashville != isNashville {
+			c.report(domain.SeverityWarning, "mixed-notation",
+				"the chord \""+chord.Value+"\" mixes "+notationName(isNashville)+" with the "+notationName(*nashville)+" used before",
+				chord.ValueSpan())
+		}
+	}
+}
+
+func notationName(nashville bool) string {
+	if nashville {
+		return "Nashville numbers"
+	}
+	return "letter chords"
+}
+
+// checkRepeats pairs every repeat start with the next repeat end of the song. A repeat end without a
+// start is fine, it's played again from the start of the song or from the previous repeat end, as in
+// domain.PlaybackOrder.
+func (c *checker) checkRepeats(song *domain.Song) {
+	var open *domain.Bar
+	for _, bar := range song.Bars() {
+		if bar.RepeatStart {
+			if open != nil {
+				c.report(domain.SeverityError, "unbalanced-repeat", "repeat start \"||:\" before the previous repeat was closed", bar.Span)
+			}
+			open = bar
+		}
+		if bar.RepeatEnd {
+			open = nil
+		}
+	}
+	if open != nil {
+		c.report(domain.SeverityError, "unbalanced-repeat", "repeat start \"||:\" is never closed with \":||\"", open.Span)
+	}
+}
+
+// checkSections warns about the sections without bars, and about the headers written as a reference,
+// "# Chorus 2 = Chorus", that name no section before them: the parser keeps them as a plain name.
+func (c *checker) checkSections(song *domain.Song) {
+	for _, section := range song.Sections {
+		if section.Name != "" && len(section.Lines) == 0 {
+			c.report(domain.SeverityWarning, "empty-section", "the section \""+section.Name+"\" has no bars", section.Span)
+		}
+		if _, ref, ok := strings.Cut(section.Name, "="); ok && section.Ref == "" {
+			c.report(domain.SeverityWarning, "unknown-section",
+				"there is no section \""+strings.TrimSpace(ref)+"\" before this one to reuse, \""+section.Name+"\" is read as the name of the section",
+				section.Span)
+		}
+	}
+}
+
+// checkLyrics warns about lyric lines with more fragments than bars, the ones left over are joined
+// to the last bar.
+func (c *checker) checkLyrics(song *domain.Song) {
+	for _, section := range song.Sections {
+		for _, line := range section.WrittenLines() {
+			for _, lyrics := range line.Lyrics {
+				if len(lyrics.Fragments) > len(line.Bars) {
+					c.report(domain.SeverityWarning, "lyrics-mismatch",
+						"the lyrics have "+strconv.Itoa(len(lyrics.Fragments))+" fragments for "+strconv.Itoa(len(line.Bars))+" bars",
+						lyrics.Span)
+				}
+			}
+		}
+	}
+}
+
+// checkNavigation reports the D.S. without a segno to go back to, and the al Coda jumps without a
+// "To Coda" or a coda.
+func (c *checker) checkNavigation(song *domain.Song) {
+	has := map[domain.Navigation]bool{}
+	for _, bar := range song.Bars() {
+		for _, n := range bar.Navigation {
+			has[n] = true
+		}
+	}
+	for _, bar := range song.Bars() {
+		jump := bar.Jump()
+		if jump.IsDalSegno() && !has[domain.Segno] {
+			c.report(domain.SeverityWarning, "unresolved-navigation", "\""+jump.Text()+"\" without a segno, it goes back to the start", bar.Span)
+		}
+		if jump.IsAlCoda() && (!has[domain.ToCoda] || !has[domain.Coda]) {
+			c.report(domain.SeverityWarning, "unresolved-navigation", "\""+jump.Text()+"\" needs a \"To Coda\" (!tocoda!) and a coda (!coda!)", bar.Span)
+		}
+	}
+}
+
+// checkSimiles reports the "%" and "%%" bars without enough bars before them to repeat.
+func (c *checker) checkSimiles(song *domain.Song) {
+	for i, bar := range song.Bars() {
+		if n := bar.RepeatedBars(); n > i {
+			c.report(domain.SeverityWarning, "dangling-simile",
+				"\""+bar.Chords[0].Value+"\" repeats "+strconv.Itoa(n)+" bars but there are "+strconv.Itoa(i)+" before it", bar.Span)
+		}
+	}
+}
+
+// chords returns the chords written in the song, the ones of the bars copied from another section
+// are left out.
+func chords(song *domain.Song) []*domain.Chord {
+	res := []*domain.Chord{}
+	for _, bar := range song.Bars() {
+		if bar.Reused {
+			continue
+		}
+		for c := range bar.Chords {
+			res = append(res, &bar.Chords[c])
+		}
+	}
+	return res
+}
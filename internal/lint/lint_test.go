@@ -0,0 +1,78 @@
+package lint
+
+import (
+	"lesheets/internal/domain"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const frontMatter = "---\ntitle: Song\nkey: C\n---\n"
+
+func codes(diagnostics domain.Diagnostics) []string {
+	res := []string{}
+	for _, d := range diagnostics {
+		res = append(res, d.Code)
+	}
+	return res
+}
+
+func TestLint(t *testing.T) {
+	testCases := []struct {
+		desc  string
+		input string
+		codes []string
+	}{
+		{desc: "clean song", input: frontMatter + "# A\n| C | !push!Dm7 | G7/B | % | N.C. |\n", codes: []string{}},
+		{desc: "missing title and key", input: "| C |\n", codes: []string{"missing-title", "missing-key"}},
+		{desc: "invalid key", input: "---\ntitle: Song\nkey: H\n---\n| C |\n", codes: []string{"invalid-key"}},
+		{desc: "unknown annotation", input: frontMatter + "| !staccato!C |\n", codes: []string{"unknown-annotation"}},
+		{desc: "invalid chord", input: frontMatter + "| C | Cmaj7#x |\n", codes: []string{"invalid-chord"}},
+		{desc: "mixed notation", input: frontMatter + "| 1 | 4 | G |\n", codes: []string{"mixed-notation"}},
+		{desc: "balanced repeats", input: frontMatter + "||: C | G :||\n||: F :||\n", codes: []string{}},
+		{desc: "unclosed repeat", input: frontMatter + "||: C | G |\n", codes: []string{"unbalanced-repeat"}},
+		{desc: "nested repeat", input: frontMatter + "||: C ||: G :||\n", codes: []string{"unbalanced-repeat"}},
+		{desc: "repeat end without start", input: frontMatter + "| C | G :|| F |\n", codes: []string{}},
+		{desc: "repeat ends without starts", input: frontMatter + "| C :|| G :|| ||: F :||\n", codes: []string{}},
+		{desc: "empty section", input: frontMatter + "# Intro\n# Verse\n| C |\n", codes: []string{"empty-section"}},
+		{desc: "lyrics", input: frontMatter + "| C | G |\n> la | la\n", codes: []string{}},
+		{desc: "lyrics with more fragments than bars", input: frontMatter + "| C | G |\n> la | la | la\n", codes: []string{"lyrics-mismatch"}},
+		{desc: "navigation", input: frontMatter + "| !segno! C !tocoda! | G !D.S.alcoda! |\n| !coda! F |\n", codes: []string{}},
+		{desc: "dal segno without segno", input: frontMatter + "| C | G !D.S.! |\n", codes: []string{"unresolved-navigation"}},
+		{desc: "al coda without coda", input: frontMatter + "| C !tocoda! | G !D.C.alcoda! |\n", codes: []string{"unresolved-navigation"}},
+		{desc: "invalid time", input: "---\ntitle: Song\nkey: C\ntime: four\n---\n| C |\n", codes: []string{"invalid-time"}},
+		{desc: "time too long", input: "---\ntitle: Song\nkey: C\ntime: 900000000/4\n---\n| C |\n", codes: []string{"invalid-time"}},
+		{desc: "invalid tempo", input: "---\ntitle: Song\nkey: C\ntempo: fast\n---\n| C |\n", codes: []string{"invalid-tempo"}},
+		{desc: "tempo too slow", input: "---\ntitle: Song\nkey: C\ntempo: 3\n---\n| C |\n", codes: []string{"invalid-tempo"}},
+		{desc: "tempo too fast", input: "---\ntitle: Song\nkey: C\ntempo: 100000000\n---\n| C |\n", codes: []string{"invalid-tempo"}},
+		{desc: "tempo change out of range", input: frontMatter + "| C | !tempo=1000! G |\n", codes: []string{"invalid-tempo"}},
+		{desc: "similes", input: frontMatter + "| C | G | %% | %% | % |\n", codes: []string{}},
+		{desc: "simile without bars to repeat", input: frontMatter + "| C | %% |\n", codes: []string{"dangling-simile"}},
+		{desc: "reused section", input: frontMatter + "# A\n| C | Hm |\n> la | la | la\n# B = A\n", codes: []string{"invalid-chord", "lyrics-mismatch"}},
+		{desc: "unknown section", input: frontMatter + "# Chorus\n| C |\n# Chorus 2 = Chorsu\n", codes: []string{"empty-section", "unknown-section"}},
+		{desc: "heading with an equal sign", input: frontMatter + "# Intro (drums = 4 bars)\n| C |\n", codes: []string{"unknown-section"}},
+		{desc: "syntax error", input: frontMatter + "| C | D : |\n", codes: []string{"syntax-error"}},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			assert.Equal(t, tC.codes, codes(Lint("song.lesheet", tC.input)))
+		})
+	}
+}
+
+func TestLintUnknownSection(t *testing.T) {
+	diagnostics := Lint("song.lesheet", frontMatter+"# Chorus\n| C |\n# Chorus 2 = Chorsu\n| G |\n")
+	require.Len(t, diagnostics, 1)
+	assert.Equal(t, "7:1: warning: there is no section \"Chorsu\" before this one to reuse, \"Chorus 2 = Chorsu\" is read as "+
+		"the name of the section [unknown-section]", diagnostics[0].String())
+}
+
+func TestLintSpans(t *testing.T) {
+	diagnostics := Lint("song.lesheet", frontMatter+"| C | !foo!Dm7 | Hm |\n")
+	assert.Equal(t, []string{
+		"5:7: warning: unknown annotation \"!foo!\", use one of marcato, push, pull, hold, fermata, diamond, diamond-fermata [unknown-annotation]",
+		"5:18: error: invalid chord \"Hm\": expected a note (A-G) or a degree (1-7) at position 0 [invalid-chord]",
+	}, []string{diagnostics[0].String(), diagnostics[1].String()})
+	assert.Equal(t, 19, diagnostics[1].Span.End.Column)
+}
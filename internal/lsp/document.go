@@ -0,0 +1,84 @@
+package lsp
+
+import (
+	"lesheets/internal/domain"
+	"strings"
+	"unicode/utf8"
+)
+
+// document is an open text document. The parser counts columns in bytes, while the protocol counts
+// them in UTF-16 code units, so positions are converted using the text of each line.
+type document struct {
+	uri  string
+	text string
+	// lineStarts holds the offset of the first character of each line
+	lineStarts []int
+}
+
+func newDocument(uri string, text string) *document {
+	d := &document{uri: uri, text: text, lineStarts: []int{0}}
+	for i := 0; i < len(text); i++ {
+		if text[i] == '\n' {
+			d.lineStarts = append(d.lineStarts, i+1)
+		}
+	}
+	return d
+}
+
+// line returns the text of a line, without its line break.
+func (d *document) line(n int) string {
+	if n < 0 || n >= len(d.lineStarts) {
+		return ""
+	}
+	end := len(d.text)
+	if n+1 < len(d.lineStarts) {
+		end = d.lineStarts[n+1] - 1
+	}
+	return strings.TrimSuffix(d.text[d.lineStarts[n]:end], "\r")
+}
+
+// position converts a byte offset into a protocol position.
+func (d *document) position(offset int) Position {
+	offset = max(0, min(offset, len(d.text)))
+	line := 0
+	for line+1 < len(d.lineStarts) && d.lineStarts[line+1] <= offset {
+		line++
+	}
+	return Position{Line: line, Character: utf16Length(d.text[d.lineStarts[line]:offset])}
+}
+
+func (d *document) rangeOf(span domain.Span) Range {
+	return Range{Start: d.position(span.Start.Offset), End: d.position(span.End.Offset)}
+}
+
+// offset converts a protocol position into a byte offset.
+func (d *document) offset(p Position) int {
+	if p.Line >= len(d.lineStarts) {
+		return len(d.text)
+	}
+	start := d.lineStarts[max(0, p.Line)]
+	line := d.line(p.Line)
+	units := 0
+	for i, r := range line {
+		if units >= p.Character {
+			return start + i
+		}
+		units += utf16RuneLength(r)
+	}
+	return start + len(line)
+}
+
+func utf16Length(s string) int {
+	n := 0
+	for _, r := range s {
+		n += utf16RuneLength(r)
+	}
+	return n
+}
+
+func utf16RuneLength(r rune) int {
+	if r >= 0x10000 && r <= utf8.MaxRune {
+		return 2
+	}
+	return 1
+}
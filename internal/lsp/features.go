@@ -0,0 +1,209 @@
+package lsp
+
+import (
+	"lesheets/internal"
+	"lesheets/internal/domain"
+	"lesheets/internal/lint"
+	"regexp"
+	"strings"
+)
+
+// htmlTag matches the markup of the pretty chords, which editors show as plain text.
+var htmlTag = regexp.MustCompile(`<[^>]*>`)
+
+var severities = map[domain.Severity]int{
+	domain.SeverityError:   SeverityError,
+	domain.SeverityWarning: SeverityWarning,
+	domain.SeverityInfo:    SeverityInformation,
+}
+
+func diagnostics(doc *document) []Diagnostic {
+	res := []Diagnostic{}
+	for _, d := range lint.Lint(doc.uri, doc.text) {
+		res = append(res, Diagnostic{
+			Range:    doc.rangeOf(d.Span),
+			Severity: severities[d.Severity],
+			Code:     d.Code,
+			Source:   "lesheets",
+			Message:  d.Message,
+		})
+	}
+	return res
+}
+
+// semanticTokens encodes the tokens as the protocol expects: five numbers per token, with the line
+// and the column relative to the previous token.
+func semanticTokens(doc *document) SemanticTokens {
+	data := []int{}
+	prev := Position{}
+	for _, tok := range internal.NewLexerFromSource(doc.uri, doc.text).Tokens() {
+		tokenType, ok := semanticTokenTypes[tok.Type]
+		if !ok {
+			continue
+		}
+		start := doc.position(tok.Span.Start.Offset)
+		end := doc.position(tok.Span.End.Offset)
+		// Tokens can't span several lines, headers for instance end with their line break
+		if end.Line != start.Line {
+			end = Position{Line: start.Line, Character: utf16Length(doc.line(start.Line))}
+		}
+		length := end.Character - start.Character
+		if length <= 0 {
+			continue
+		}
+		deltaChar := start.Character
+		if start.Line == prev.Line {
+			deltaChar -= prev.Character
+		}
+		data = append(data, start.Line-prev.Line, deltaChar, length, tokenType, 0)
+		prev = start
+	}
+	return SemanticTokens{Data: data}
+}
+
+// completion offers the annotation and navigation marker names after a "!" and the front matter keys at the start of a
+// front matter line.
+func completion(doc *document, pos Position) []CompletionItem {
+	items := []CompletionItem{}
+	offset := doc.offset(pos)
+	lineStart := doc.offset(Position{Line: pos.Line})
+	before := doc.text[lineStart:offset]
+
+	if inFrontMatter(doc, pos.Line) {
+		if strings.Contains(before, ":") {
+			return items
+		}
+		for _, key := range domain.FrontMatterKeys {
+			items = append(items, CompletionItem{
+				Label:    key,
+				Kind:     CompletionItemKindProperty,
+				TextEdit: &TextEdit{Range: Range{Start: Position{Line: pos.Line}, End: pos}, NewText: key + ": "},
+			})
+		}
+		return items
+	}
+
+	word := before[strings.LastIndexAny(before, " \t|")+1:]
+	if !strings.HasPrefix(word, "!") || strings.Contains(word[1:], "!") {
+		return items
+	}
+	closing := "!"
+	if strings.HasPrefix(doc.text[offset:], "!") {
+		closing = ""
+	}
+	start := Position{Line: pos.Line, Character: pos.Character - utf16Length(word) + 1}
+	for _, name := range domain.KnownAnnotations {
+		items = append(items, CompletionItem{
+			Label:    name,
+			Kind:     CompletionItemKindKeyword,
+			Detail:   "annotation",
+			TextEdit: &TextEdit{Range: Range{Start: start, End: pos}, NewText: name + closing},
+		})
+	}
+	for _, n := range domain.Navigations {
+		items = append(items, CompletionItem{
+			Label:    string(n),
+			Kind:     CompletionItemKindKeyword,
+			Detail:   n.Text(),
+			TextEdit: &TextEdit{Range: Range{Start: start, End: pos}, NewText: string(n) + closing},
+		})
+	}
+	return items
+}
+
+// inFrontMatter tells whether a line is between the opening and the closing "---" of the front
+// matter.
+func inFrontMatter(doc *document, line int) bool {
+	if line == 0 || !strings.HasPrefix(doc.line(0), "---") {
+		return false
+	}
+	for i := 1; i < line; i++ {
+		if strings.HasPrefix(doc.line(i), "---") {
+			return false
+		}
+	}
+	return !strings.HasPrefix(doc.line(line), "---")
+}
+
+// hover shows the chord as it's rendered and, when the song has a key, in the other notation in the
+// key of its bar.
+func hover(doc *document, pos Position) *Hover {
+	song, _ := internal.ParseSongFromStringWithFileName(doc.uri, doc.text)
+	if song == nil {
+		return nil
+	}
+	bar, chord := chordAt(song, doc.offset(pos))
+	if chord == nil || !chord.IsChordSymbol() {
+		return nil
+	}
+	contents := "**" + htmlTag.ReplaceAllString(chord.PrettyPrint(), "") + "**"
+	symbol, err := chord.Symbol()
+	if err != nil {
+		contents += "\n\n" + err.Error()
+	} else if key, err := domain.ParseKey(bar.Key); err == nil {
+		converted := key.ChordToNashville(chord.Value)
+		if symbol.IsNashville() {
+			converted = key.ChordToLetters(chord.Value)
+		}
+		contents += "\n\n`" + chord.Value + "` is `" + converted + "` in " + key.String()
+	}
+	return &Hover{
+		Contents: MarkupContent{Kind: "markdown", Value: contents},
+		Range:    doc.rangeOf(chord.ValueSpan()),
+	}
+}
+
+func chordAt(song *domain.Song, offset int) (*domain.Bar, *domain.Chord) {
+	for _, bar := range song.Bars() {
+		for i := range bar.Chords {
+			if bar.Chords[i].Span.Contains(offset) {
+				return bar, &bar.Chords[i]
+			}
+		}
+	}
+	return nil, nil
+}
+
+// documentSymbols lists the sections of the song as the outline of the document.
+func documentSymbols(doc *document) []DocumentSymbol {
+	symbols := []DocumentSymbol{}
+	song, _ := internal.ParseSongFromStringWithFileName(doc.uri, doc.text)
+	if song == nil {
+		return symbols
+	}
+	for _, section := range song.Sections {
+		if section.Name == "" {
+			continue
+		}
+		r := doc.rangeOf(section.Span)
+		header := Position{Line: r.Start.Line, Character: utf16Length(doc.line(r.Start.Line))}
+		symbols = append(symbols, DocumentSymbol{
+			Name:           section.Name,
+			Kind:           SymbolKindNamespace,
+			Range:          r,
+			SelectionRange: Range{Start: r.Start, End: header},
+			Children:       []DocumentSymbol{},
+		})
+	}
+	return symbols
+}
+
+// formatting replaces the document with the song formatted like the fmt command does. Songs with
+// errors are left alone, since the bars that can't be parsed would be lost.
+func formatting(doc *document) []TextEdit {
+	song, err := internal.ParseSongFromStringWithFileName(doc.uri, doc.text)
+	if err != nil {
+		return nil
+	}
+	formatted, err := internal.FormatLesheet(song)
+	if err != nil {
+		return nil
+	}
+	if formatted == doc.text {
+		return []TextEdit{}
+	}
+	return []TextEdit{{
+		Range:   Range{End: doc.position(len(doc.text))},
+		NewText: formatted,
+	}}
+}
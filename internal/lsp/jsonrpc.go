@@ -0,0 +1,79 @@
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// conn reads and writes JSON-RPC messages framed with a Content-Length header.
+type conn struct {
+	in  *bufio.Reader
+	out io.Writer
+}
+
+func (c *conn) read() (*message, error) {
+	length := -1
+	for {
+		line, err := c.in.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			break
+		}
+		name, value, found := strings.Cut(line, ":")
+		if found && strings.EqualFold(name, "Content-Length") {
+			length, err = strconv.Atoi(strings.TrimSpace(value))
+			if err != nil {
+				return nil, errors.New("invalid Content-Length header: " + line)
+			}
+		}
+	}
+	if length < 0 {
+		return nil, errors.New("missing Content-Length header")
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(c.in, body); err != nil {
+		return nil, err
+	}
+	msg := &message{}
+	if err := json.Unmarshal(body, msg); err != nil {
+		return nil, errors.New("invalid message: " + err.Error())
+	}
+	return msg, nil
+}
+
+func (c *conn) write(msg *message) error {
+	msg.JSONRPC = "2.0"
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(c.out, "Content-Length: "+strconv.Itoa(len(body))+"\r\n\r\n"+string(body))
+	return err
+}
+
+func (c *conn) reply(id *json.RawMessage, result any) error {
+	raw, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+	return c.write(&message{ID: id, Result: raw})
+}
+
+func (c *conn) replyError(id *json.RawMessage, code int, text string) error {
+	return c.write(&message{ID: id, Error: &responseError{Code: code, Message: text}})
+}
+
+func (c *conn) notify(method string, params any) error {
+	raw, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	return c.write(&message{Method: method, Params: raw})
+}
@@ -0,0 +1,203 @@
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"lesheets/internal/domain"
+	"log"
+)
+
+// Server is a language server for lesheets files. It keeps the open documents in memory and answers
+// the requests of the editor by lexing and parsing them again.
+type Server struct {
+	conn      conn
+	documents map[string]*document
+}
+
+func NewServer(in io.Reader, out io.Writer) *Server {
+	return &Server{
+		conn:      conn{in: bufio.NewReader(in), out: out},
+		documents: map[string]*document{},
+	}
+}
+
+// Run serves the messages of the client until it sends "exit" or closes the input. A request that
+// fails gets an error response and a notification that fails is logged, the server goes on with the
+// next message: only the errors reading the input stop it.
+func (s *Server) Run() error {
+	for {
+		msg, err := s.conn.read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if msg.Method == "exit" {
+			return nil
+		}
+		if msg.ID == nil {
+			err = s.handleNotification(msg.Method, msg.Params)
+		} else {
+			err = s.handleRequest(msg)
+		}
+		if err != nil {
+			log.Printf("%s: %v", msg.Method, err)
+		}
+	}
+}
+
+func (s *Server) handleRequest(msg *message) error {
+	result, rerr := s.answer(msg)
+	if rerr != nil {
+		return s.conn.replyError(msg.ID, rerr.Code, rerr.Message)
+	}
+	return s.conn.reply(msg.ID, result)
+}
+
+// answer returns the result of a request, or the error to reply with. A panic while answering is an
+// internal error.
+func (s *Server) answer(msg *message) (result any, rerr *responseError) {
+	defer func() {
+		if r := recover(); r != nil {
+			result, rerr = nil, &responseError{Code: errorInternal, Message: fmt.Sprint("internal error: ", r)}
+		}
+	}()
+	var err error
+	switch msg.Method {
+	case "initialize":
+		result = initializeResult()
+	case "shutdown":
+		result = nil
+	case "textDocument/semanticTokens/full":
+		result, err = withDocument(s, msg.Params, semanticTokens)
+	case "textDocument/documentSymbol":
+		result, err = withDocument(s, msg.Params, documentSymbols)
+	case "textDocument/formatting":
+		result, err = withDocument(s, msg.Params, formatting)
+	case "textDocument/completion":
+		result, err = atPosition(s, msg.Params, completion)
+	case "textDocument/hover":
+		result, err = atPosition(s, msg.Params, hover)
+	default:
+		return nil, &responseError{Code: errorMethodNotFound, Message: "method not found: " + msg.Method}
+	}
+	if err != nil {
+		return nil, &responseError{Code: errorInvalidParams, Message: err.Error()}
+	}
+	return result, nil
+}
+
+func (s *Server) handleNotification(method string, raw json.RawMessage) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("internal error: %v", r)
+		}
+	}()
+	switch method {
+	case "textDocument/didOpen":
+		params := DidOpenTextDocumentParams{}
+		if err := json.Unmarshal(raw, &params); err != nil {
+			log.Printf("invalid didOpen params: %v", err)
+			return nil
+		}
+		return s.update(params.TextDocument.URI, params.TextDocument.Text)
+	case "textDocument/didChange":
+		params := DidChangeTextDocumentParams{}
+		if err := json.Unmarshal(raw, &params); err != nil || len(params.ContentChanges) == 0 {
+			log.Printf("invalid didChange params: %v", err)
+			return nil
+		}
+		// The server asks for full document sync, so the last change holds the whole text
+		changes := params.ContentChanges
+		return s.update(params.TextDocument.URI, changes[len(changes)-1].Text)
+	case "textDocument/didClose":
+		params := DidCloseTextDocumentParams{}
+		if err := json.Unmarshal(raw, &params); err != nil {
+			log.Printf("invalid didClose params: %v", err)
+			return nil
+		}
+		delete(s.documents, params.TextDocument.URI)
+		return s.conn.notify("textDocument/publishDiagnostics", PublishDiagnosticsParams{
+			URI:         params.TextDocument.URI,
+			Diagnostics: []Diagnostic{},
+		})
+	}
+	return nil
+}
+
+// update stores the new text of a document and publishes its diagnostics.
+func (s *Server) update(uri string, text string) error {
+	doc := newDocument(uri, text)
+	s.documents[uri] = doc
+	return s.conn.notify("textDocument/publishDiagnostics", PublishDiagnosticsParams{
+		URI:         uri,
+		Diagnostics: diagnostics(doc),
+	})
+}
+
+// withDocument decodes the params of a request about a whole document and calls f with it. Requests
+// about documents that are not open are invalid.
+func withDocument[T any](s *Server, raw json.RawMessage, f func(*document) T) (any, error) {
+	params := DocumentParams{}
+	if err := json.Unmarshal(raw, &params); err != nil {
+		return nil, err
+	}
+	doc, ok := s.documents[params.TextDocument.URI]
+	if !ok {
+		return nil, errors.New("document not open: " + params.TextDocument.URI)
+	}
+	return f(doc), nil
+}
+
+// atPosition is like withDocument, for requests about a position in the document.
+func atPosition[T any](s *Server, raw json.RawMessage, f func(*document, Position) T) (any, error) {
+	params := TextDocumentPositionParams{}
+	if err := json.Unmarshal(raw, &params); err != nil {
+		return nil, err
+	}
+	doc, ok := s.documents[params.TextDocument.URI]
+	if !ok {
+		return nil, errors.New("document not open: " + params.TextDocument.URI)
+	}
+	return f(doc, params.Position), nil
+}
+
+// tokenTypes is the legend of the semantic tokens: the index of each type is its code.
+var tokenTypes = []string{"namespace", "type", "decorator", "string", "comment"}
+
+var semanticTokenTypes = map[domain.TokenType]int{
+	domain.TokenHeader:      0,
+	domain.TokenHeaderBreak: 0,
+	domain.TokenChord:       1,
+	domain.TokenAnnotation:  2,
+	domain.TokenEnding:      2,
+	domain.TokenRepeatCount: 2,
+	domain.TokenMeter:       2,
+	domain.TokenBarNote:     3,
+	domain.TokenLyrics:      4,
+}
+
+func initializeResult() map[string]any {
+	return map[string]any{
+		"capabilities": map[string]any{
+			// full document sync
+			"textDocumentSync": 1,
+			"semanticTokensProvider": map[string]any{
+				"legend": map[string]any{
+					"tokenTypes":     tokenTypes,
+					"tokenModifiers": []string{},
+				},
+				"full": true,
+			},
+			"completionProvider":         map[string]any{"triggerCharacters": []string{"!"}},
+			"hoverProvider":              true,
+			"documentSymbolProvider":     true,
+			"documentFormattingProvider": true,
+		},
+		"serverInfo": map[string]any{"name": "lesheets"},
+	}
+}
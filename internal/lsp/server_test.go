@@ -0,0 +1,218 @@
+package lsp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"lesheets/internal/domain"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const uri = "file:///song.lesheet"
+
+const song = `---
+title: Song
+key: C
+---
+# Intro
+| !push!Cmaj7 | "band" Am7 |
+# Verse
+| !foo!G |
+`
+
+func frame(t *testing.T, msgs ...map[string]any) *bytes.Buffer {
+	buf := &bytes.Buffer{}
+	for _, m := range msgs {
+		m["jsonrpc"] = "2.0"
+		body, err := json.Marshal(m)
+		require.NoError(t, err)
+		buf.WriteString("Content-Length: " + strconv.Itoa(len(body)) + "\r\n\r\n")
+		buf.Write(body)
+	}
+	return buf
+}
+
+func request(id int, method string, params any) map[string]any {
+	return map[string]any{"id": id, "method": method, "params": params}
+}
+
+func notification(method string, params any) map[string]any {
+	return map[string]any{"method": method, "params": params}
+}
+
+func open(text string) map[string]any {
+	return notification("textDocument/didOpen", map[string]any{
+		"textDocument": map[string]any{"uri": uri, "languageId": "lesheet", "version": 1, "text": text},
+	})
+}
+
+func at(line int, character int) map[string]any {
+	return map[string]any{
+		"textDocument": map[string]any{"uri": uri},
+		"position":     map[string]any{"line": line, "character": character},
+	}
+}
+
+// run feeds the messages to a server and returns the messages it wrote.
+func run(t *testing.T, msgs ...map[string]any) []message {
+	out := &bytes.Buffer{}
+	require.NoError(t, NewServer(frame(t, msgs...), out).Run())
+	c := conn{in: bufio.NewReader(out)}
+	res := []message{}
+	for out.Len() > 0 || c.in.Buffered() > 0 {
+		msg, err := c.read()
+		require.NoError(t, err)
+		res = append(res, *msg)
+	}
+	return res
+}
+
+func result[T any](t *testing.T, msg message) T {
+	var res T
+	require.Nil(t, msg.Error)
+	require.NoError(t, json.Unmarshal(msg.Result, &res))
+	return res
+}
+
+func TestInitialize(t *testing.T) {
+	msgs := run(t, request(1, "initialize", map[string]any{}), notification("initialized", map[string]any{}),
+		request(2, "shutdown", nil), notification("exit", nil))
+	require.Len(t, msgs, 2)
+	capabilities := result[map[string]map[string]any](t, msgs[0])["capabilities"]
+	assert.Equal(t, true, capabilities["hoverProvider"])
+	assert.Equal(t, float64(1), capabilities["textDocumentSync"])
+	assert.Equal(t, "null", string(msgs[1].Result))
+}
+
+func TestUnknownMethod(t *testing.T) {
+	msgs := run(t, request(1, "textDocument/rename", map[string]any{}))
+	require.Len(t, msgs, 1)
+	assert.Equal(t, errorMethodNotFound, msgs[0].Error.Code)
+}
+
+func TestRequestErrors(t *testing.T) {
+	other := map[string]any{"textDocument": map[string]any{"uri": "file:///other.lesheet"}}
+	msgs := run(t, request(1, "textDocument/hover", "not params"), request(2, "textDocument/formatting", other),
+		notification("textDocument/didOpen", "not params"), open(song),
+		request(3, "textDocument/documentSymbol", map[string]any{"textDocument": map[string]any{"uri": uri}}))
+	require.Len(t, msgs, 4)
+	assert.Equal(t, errorInvalidParams, msgs[0].Error.Code)
+	assert.Equal(t, errorInvalidParams, msgs[1].Error.Code)
+	assert.Equal(t, "document not open: file:///other.lesheet", msgs[1].Error.Message)
+	assert.Equal(t, "textDocument/publishDiagnostics", msgs[2].Method)
+	assert.Len(t, result[[]DocumentSymbol](t, msgs[3]), 2)
+}
+
+func TestPublishDiagnostics(t *testing.T) {
+	msgs := run(t, open(song), notification("textDocument/didChange", map[string]any{
+		"textDocument":   map[string]any{"uri": uri, "version": 2},
+		"contentChanges": []map[string]any{{"text": "| C | D : |\n"}},
+	}))
+	require.Len(t, msgs, 2)
+	assert.Equal(t, "textDocument/publishDiagnostics", msgs[0].Method)
+
+	params := PublishDiagnosticsParams{}
+	require.NoError(t, json.Unmarshal(msgs[0].Params, &params))
+	assert.Equal(t, []Diagnostic{{
+		Range:    Range{Start: Position{Line: 7, Character: 2}, End: Position{Line: 7, Character: 7}},
+		Severity: SeverityWarning,
+		Code:     "unknown-annotation",
+		Source:   "lesheets",
+		Message:  params.Diagnostics[0].Message,
+	}}, params.Diagnostics)
+
+	require.NoError(t, json.Unmarshal(msgs[1].Params, &params))
+	codes := []string{}
+	for _, d := range params.Diagnostics {
+		codes = append(codes, d.Code)
+	}
+	assert.Equal(t, []string{"missing-title", "missing-key", "syntax-error"}, codes)
+}
+
+func TestSemanticTokens(t *testing.T) {
+	msgs := run(t, open("# Intro\n| !push!C | G \"band\" |\n"),
+		request(1, "textDocument/semanticTokens/full", map[string]any{"textDocument": map[string]any{"uri": uri}}))
+	assert.Equal(t, []int{
+		0, 0, 7, 0, 0, // # Intro
+		1, 2, 6, 2, 0, // !push!
+		0, 6, 1, 1, 0, // C
+		0, 4, 1, 1, 0, // G
+		0, 2, 6, 3, 0, // "band"
+	}, result[SemanticTokens](t, msgs[1]).Data)
+}
+
+func TestCompletion(t *testing.T) {
+	msgs := run(t, open(song+"| !pu"), request(1, "textDocument/completion", at(8, 5)),
+		request(2, "textDocument/completion", at(2, 0)), request(3, "textDocument/completion", at(5, 2)))
+
+	items := result[[]CompletionItem](t, msgs[1])
+	require.Len(t, items, len(domain.KnownAnnotations)+len(domain.Navigations))
+	assert.Equal(t, "D.S. al Coda", items[len(items)-1].Detail)
+	assert.Equal(t, CompletionItem{
+		Label:  "marcato",
+		Kind:   CompletionItemKindKeyword,
+		Detail: "annotation",
+		TextEdit: &TextEdit{
+			Range:   Range{Start: Position{Line: 8, Character: 3}, End: Position{Line: 8, Character: 5}},
+			NewText: "marcato!",
+		},
+	}, items[0])
+
+	items = result[[]CompletionItem](t, msgs[2])
+	assert.Equal(t, "title", items[0].Label)
+	assert.Equal(t, "title: ", items[0].TextEdit.NewText)
+
+	assert.Empty(t, result[[]CompletionItem](t, msgs[3]))
+}
+
+func TestHover(t *testing.T) {
+	msgs := run(t, open(song), request(1, "textDocument/hover", at(5, 9)),
+		request(2, "textDocument/hover", at(5, 24)), request(3, "textDocument/hover", at(5, 0)),
+		open("---\nkey: Eb\n---\n| 6m7 | Hm |\n"), request(4, "textDocument/hover", at(3, 2)),
+		request(5, "textDocument/hover", at(3, 9)))
+
+	hover := result[*Hover](t, msgs[1])
+	assert.Equal(t, "**C△⁷**\n\n`Cmaj7` is `1maj7` in C", hover.Contents.Value)
+	assert.Equal(t, Range{Start: Position{Line: 5, Character: 8}, End: Position{Line: 5, Character: 13}}, hover.Range)
+	assert.Equal(t, "**Am⁷**\n\n`Am7` is `6m7` in C", result[*Hover](t, msgs[2]).Contents.Value)
+	assert.Equal(t, "null", string(msgs[3].Result))
+	assert.Equal(t, "**6m⁷**\n\n`6m7` is `Cm7` in Eb", result[*Hover](t, msgs[5]).Contents.Value)
+	assert.Equal(t, "**Hm**\n\ninvalid chord \"Hm\": expected a note (A-G) or a degree (1-7) at position 0", result[*Hover](t, msgs[6]).Contents.Value)
+}
+
+func TestDocumentSymbols(t *testing.T) {
+	msgs := run(t, open(song), request(1, "textDocument/documentSymbol", map[string]any{"textDocument": map[string]any{"uri": uri}}))
+	symbols := result[[]DocumentSymbol](t, msgs[1])
+	require.Len(t, symbols, 2)
+	assert.Equal(t, "Intro", symbols[0].Name)
+	assert.Equal(t, Range{Start: Position{Line: 4}, End: Position{Line: 5, Character: 28}}, symbols[0].Range)
+	assert.Equal(t, Range{Start: Position{Line: 4}, End: Position{Line: 4, Character: 7}}, symbols[0].SelectionRange)
+	assert.Equal(t, "Verse", symbols[1].Name)
+}
+
+func TestFormatting(t *testing.T) {
+	params := map[string]any{"textDocument": map[string]any{"uri": uri}}
+	msgs := run(t, open("# A\n|C|D| // comment\n"), request(1, "textDocument/formatting", params),
+		open("| C : |\n"), request(2, "textDocument/formatting", params))
+
+	edits := result[[]TextEdit](t, msgs[1])
+	require.Len(t, edits, 1)
+	assert.Equal(t, Range{End: Position{Line: 2}}, edits[0].Range)
+	assert.Equal(t, "# A\n\nC | D // comment\n", edits[0].NewText)
+
+	assert.Equal(t, "null", string(msgs[3].Result))
+}
+
+func TestDocumentPositions(t *testing.T) {
+	doc := newDocument(uri, "| C♯ | 𝄋 D |\n| E |")
+	assert.Equal(t, Position{Line: 0, Character: 7}, doc.position(strings.Index(doc.text, "𝄋")))
+	assert.Equal(t, Position{Line: 0, Character: 10}, doc.position(strings.Index(doc.text, "D")))
+	assert.Equal(t, Position{Line: 1, Character: 2}, doc.position(strings.Index(doc.text, "E")))
+	assert.Equal(t, strings.Index(doc.text, "D"), doc.offset(Position{Line: 0, Character: 10}))
+	assert.Equal(t, len(doc.text), doc.offset(Position{Line: 1, Character: 20}))
+}
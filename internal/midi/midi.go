@@ -0,0 +1,255 @@
+// Package midi writes songs as Standard MIDI Files to rehearse with: the chords on one track and a
+// click on another one, following the bars in the order they are played.
+package midi
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"lesheets/internal/domain"
+	"math/bits"
+	"slices"
+	"strings"
+)
+
+// Division is the number of ticks of a quarter note.
+const Division = 480
+
+// DefaultTempo is the tempo of the songs without one, in quarter notes per minute.
+const DefaultTempo = 120
+
+const (
+	chordChannel   = 0
+	clickChannel   = 9 // the General MIDI drums
+	clickAccent    = 76
+	clickBeat      = 77
+	chordVelocity  = 80
+	bassVelocity   = 90
+	accentVelocity = 100
+	beatVelocity   = 70
+)
+
+// Style is the way the chords are played.
+type Style string
+
+const (
+	// StyleBlock holds every chord for its whole duration.
+	StyleBlock Style = "block"
+	// StyleComp holds the bass and strikes the chord short on every beat.
+	StyleComp Style = "comp"
+)
+
+// Styles are the styles accepted by ParseStyle.
+var Styles = []Style{StyleBlock, StyleComp}
+
+func ParseStyle(value string) (Style, error) {
+	style := Style(strings.ToLower(strings.TrimSpace(value)))
+	if !slices.Contains(Styles, style) {
+		return "", errors.New("unknown style \"" + value + "\": use block or comp")
+	}
+	return style, nil
+}
+
+// Write writes the song as a format 1 MIDI file with three tracks: the tempo and meter changes, the
+// chords with their bass, and the click. The tempo is the one of the front matter, DefaultTempo when
+// it has none, and the bars are played as unrolled by domain.Song.Unroll. Nashville numbers are
+// played in the key of their bar, the bars written with ABC backticks only have the click.
+func Write(w io.Writer, song *domain.Song, style Style) error {
+	conductor := newTrack(song.FrontMatter["title"])
+	chords := newTrack("Chords")
+	click := newTrack("Click")
+	chords.add(0, 0xc0|chordChannel, 0) // Acoustic Grand Piano
+
+	tick := 0
+	tempo, meter := 0, domain.Meter{}
+	var sounding *voicing
+	for _, played := range song.Unroll().Bars {
+		bpm := played.Tempo
+		if bpm <= 0 {
+			bpm = DefaultTempo
+		}
+		if bpm != tempo {
+			tempo = bpm
+			conductor.tempo(tick, bpm)
+		}
+		if played.Meter != meter {
+			meter = played.Meter
+			conductor.meter(tick, meter)
+		}
+		beat := Division * 4 / meter.Unit
+		for i := range meter.Beats {
+			note, velocity := byte(clickBeat), byte(beatVelocity)
+			if i == 0 {
+				note, velocity = clickAccent, accentVelocity
+			}
+			click.note(clickChannel, tick+i*beat, beat/4, note, velocity)
+		}
+		key, _ := domain.ParseKey(played.Key)
+		for _, chord := range played.Sounding.Chords {
+			switch chord.Kind() {
+			case domain.KindPlaceholder:
+				continue
+			case domain.KindNoChord:
+				sounding = nil
+				continue
+			case domain.KindChord:
+				sounding = voice(chord.Value, key)
+			}
+			if sounding == nil {
+				continue
+			}
+			start := tick + int(chord.Beat*float64(beat))
+			length := int(chord.Duration * float64(beat))
+			chords.chord(*sounding, style, start, length, beat)
+		}
+		tick += meter.Beats * beat
+	}
+	return writeFile(w, tick, conductor, chords, click)
+}
+
+// voicing is a chord as MIDI notes: the bass in the second octave and the chord in root position
+// around the third one.
+type voicing struct {
+	bass  byte
+	notes []byte
+}
+
+// voice returns the notes of a chord, nil when it can't be read or when it's a Nashville number
+// without a key.
+func voice(value string, key *domain.Key) *voicing {
+	symbol, err := domain.ParseChordSymbol(value)
+	if err != nil {
+		return nil
+	}
+	root, bass := symbol.Root, symbol.Root
+	if symbol.Bass != nil {
+		bass = *symbol.Bass
+	}
+	if symbol.IsNashville() || bass.IsNashville() {
+		if key == nil {
+			return nil
+		}
+		root, bass = key.ToLetter(root), key.ToLetter(bass)
+	}
+	base := 48 + root.PitchClass()
+	if base > 54 {
+		base -= 12
+	}
+	v := &voicing{bass: byte(36 + bass.PitchClass())}
+	for _, interval := range symbol.Intervals() {
+		v.notes = append(v.notes, byte(base+interval))
+	}
+	return v
+}
+
+type event struct {
+	tick int
+	// off events go first among the events of a tick, so that a note can be struck again
+	off  bool
+	data []byte
+}
+
+type track struct {
+	events []event
+}
+
+func newTrack(name string) *track {
+	t := &track{}
+	if name != "" {
+		t.meta(0, 0x03, []byte(name))
+	}
+	return t
+}
+
+func (t *track) add(tick int, data ...byte) {
+	t.events = append(t.events, event{tick: tick, data: data})
+}
+
+func (t *track) meta(tick int, kind byte, data []byte) {
+	t.add(tick, append([]byte{0xff, kind}, append(varint(len(data)), data...)...)...)
+}
+
+func (t *track) tempo(tick int, bpm int) {
+	us := 60_000_000 / bpm
+	t.meta(tick, 0x51, []byte{byte(us >> 16), byte(us >> 8), byte(us)})
+}
+
+func (t *track) meter(tick int, m domain.Meter) {
+	t.meta(tick, 0x58, []byte{byte(m.Beats), byte(bits.TrailingZeros(uint(m.Unit))), 24, 8})
+}
+
+func (t *track) note(channel byte, tick int, length int, note byte, velocity byte) {
+	t.add(tick, 0x90|channel, note, velocity)
+	t.events = append(t.events, event{tick: tick + length, off: true, data: []byte{0x80 | channel, note, 0}})
+}
+
+// chord plays a chord from start for length ticks, struck once or on every beat with StyleComp.
+func (t *track) chord(v voicing, style Style, start int, length int, beat int) {
+	if length <= 0 {
+		return
+	}
+	t.note(chordChannel, start, length, v.bass, bassVelocity)
+	if style == StyleBlock {
+		for _, n := range v.notes {
+			t.note(chordChannel, start, length, n, chordVelocity)
+		}
+		return
+	}
+	for strike := start; strike < start+length; strike += beat {
+		for _, n := range v.notes {
+			t.note(chordChannel, strike, min(beat/2, start+length-strike), n, chordVelocity)
+		}
+	}
+}
+
+// bytes encodes the events of the track with their delta times, ending it at the given tick.
+func (t *track) bytes(end int) []byte {
+	events := slices.Clone(t.events)
+	slices.SortStableFunc(events, func(a, b event) int {
+		if a.tick != b.tick {
+			return a.tick - b.tick
+		}
+		if a.off != b.off {
+			if a.off {
+				return -1
+			}
+			return 1
+		}
+		return 0
+	})
+	buf := bytes.Buffer{}
+	last := 0
+	for _, e := range events {
+		buf.Write(varint(e.tick - last))
+		buf.Write(e.data)
+		last = e.tick
+	}
+	buf.Write(varint(max(end-last, 0)))
+	buf.Write([]byte{0xff, 0x2f, 0})
+	return buf.Bytes()
+}
+
+func writeFile(w io.Writer, end int, tracks ...*track) error {
+	buf := bytes.Buffer{}
+	buf.WriteString("MThd")
+	_ = binary.Write(&buf, binary.BigEndian, []uint32{6})
+	_ = binary.Write(&buf, binary.BigEndian, []uint16{1, uint16(len(tracks)), Division})
+	for _, t := range tracks {
+		data := t.bytes(end)
+		buf.WriteString("MTrk")
+		_ = binary.Write(&buf, binary.BigEndian, uint32(len(data)))
+		buf.Write(data)
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// varint encodes a number as a MIDI variable length quantity, 7 bits per byte.
+func varint(n int) []byte {
+	res := []byte{byte(n & 0x7f)}
+	for n >>= 7; n > 0; n >>= 7 {
+		res = append([]byte{byte(n&0x7f) | 0x80}, res...)
+	}
+	return res
+}
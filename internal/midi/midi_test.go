@@ -0,0 +1,159 @@
+package midi
+
+import (
+	"bytes"
+	"encoding/binary"
+	"lesheets/internal"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type midiEvent struct {
+	tick int
+	data []byte
+}
+
+// readFile decodes the tracks written by Write, which doesn't use running status.
+func readFile(t *testing.T, data []byte) (uint16, [][]midiEvent) {
+	require.Equal(t, "MThd", string(data[:4]))
+	format := binary.BigEndian.Uint16(data[8:])
+	count := int(binary.BigEndian.Uint16(data[10:]))
+	require.Equal(t, uint16(Division), binary.BigEndian.Uint16(data[12:]))
+	data = data[14:]
+	tracks := [][]midiEvent{}
+	for range count {
+		require.Equal(t, "MTrk", string(data[:4]))
+		length := int(binary.BigEndian.Uint32(data[4:]))
+		chunk := data[8 : 8+length]
+		data = data[8+length:]
+		events := []midiEvent{}
+		tick := 0
+		for len(chunk) > 0 {
+			delta, n := readVarint(chunk)
+			tick += delta
+			chunk = chunk[n:]
+			size := 3
+			if chunk[0] == 0xff {
+				length, n := readVarint(chunk[2:])
+				size = 2 + n + length
+			} else if chunk[0]&0xf0 == 0xc0 {
+				size = 2
+			}
+			events = append(events, midiEvent{tick: tick, data: chunk[:size]})
+			chunk = chunk[size:]
+		}
+		tracks = append(tracks, events)
+	}
+	return format, tracks
+}
+
+func readVarint(data []byte) (int, int) {
+	n := 0
+	for i, b := range data {
+		n = n<<7 | int(b&0x7f)
+		if b&0x80 == 0 {
+			return n, i + 1
+		}
+	}
+	return n, len(data)
+}
+
+func write(t *testing.T, source string, style Style) [][]midiEvent {
+	song, err := internal.ParseSongFromString(source)
+	require.NoError(t, err)
+	buf := bytes.Buffer{}
+	require.NoError(t, Write(&buf, song, style))
+	format, tracks := readFile(t, buf.Bytes())
+	assert.Equal(t, uint16(1), format)
+	require.Len(t, tracks, 3)
+	return tracks
+}
+
+// notesOn returns the ticks and the notes struck on a channel.
+func notesOn(events []midiEvent, channel byte) ([]int, []byte) {
+	ticks, notes := []int{}, []byte{}
+	for _, e := range events {
+		if e.data[0] == 0x90|channel && e.data[2] > 0 {
+			ticks = append(ticks, e.tick)
+			notes = append(notes, e.data[1])
+		}
+	}
+	return ticks, notes
+}
+
+func metas(events []midiEvent, kind byte) []midiEvent {
+	res := []midiEvent{}
+	for _, e := range events {
+		if e.data[0] == 0xff && e.data[1] == kind {
+			res = append(res, e)
+		}
+	}
+	return res
+}
+
+func TestWriteFollowsTheRepeats(t *testing.T) {
+	tracks := write(t, "---\ntitle: Song\n---\n||: C | G7/B :||\n", StyleBlock)
+	ticks, notes := notesOn(tracks[1], chordChannel)
+	assert.Equal(t, []int{0, 0, 0, 0, 1920, 1920, 1920, 1920, 1920, 3840, 3840, 3840, 3840, 5760, 5760, 5760, 5760, 5760}, ticks)
+	assert.Equal(t, []byte{36, 48, 52, 55, 47, 43, 47, 50, 53, 36, 48, 52, 55, 47, 43, 47, 50, 53}, notes)
+	assert.Equal(t, "Song", string(metas(tracks[0], 0x03)[0].data[3:]))
+	end := tracks[1][len(tracks[1])-1]
+	assert.Equal(t, 7680, end.tick)
+	assert.Equal(t, []byte{0xff, 0x2f, 0}, end.data)
+}
+
+func TestWriteBeats(t *testing.T) {
+	tracks := write(t, "C . / . | N.C. | A / / /\n", StyleBlock)
+	ticks, notes := notesOn(tracks[1], chordChannel)
+	assert.Equal(t, []int{0, 0, 0, 0, 960, 960, 960, 960, 3840, 3840, 3840, 3840, 4320, 4320, 4320, 4320}, ticks[:16])
+	assert.Equal(t, []byte{36, 48, 52, 55}, notes[:4])
+	assert.Equal(t, []byte{45, 45, 49, 52}, notes[8:12])
+	assert.Len(t, ticks, 24)
+}
+
+func TestWriteComp(t *testing.T) {
+	tracks := write(t, "(3/4) Am\n", StyleComp)
+	ticks, notes := notesOn(tracks[1], chordChannel)
+	assert.Equal(t, []int{0, 0, 0, 0, 480, 480, 480, 960, 960, 960}, ticks)
+	assert.Equal(t, []byte{45, 45, 48, 52, 45, 48, 52, 45, 48, 52}, notes)
+}
+
+func TestWriteNashville(t *testing.T) {
+	tracks := write(t, "---\nkey: D\n---\n1 | !key=E! 5/7\n", StyleBlock)
+	_, notes := notesOn(tracks[1], chordChannel)
+	assert.Equal(t, []byte{38, 50, 54, 57, 39, 47, 51, 54}, notes)
+
+	tracks = write(t, "1 | 5\n", StyleBlock)
+	_, notes = notesOn(tracks[1], chordChannel)
+	assert.Empty(t, notes)
+}
+
+func TestWriteTempoAndMeters(t *testing.T) {
+	tracks := write(t, "---\ntempo: 100\ntime: 6/8\n---\nC | !tempo=150! (3/4) G | D\n", StyleBlock)
+	tempos := metas(tracks[0], 0x51)
+	require.Len(t, tempos, 2)
+	assert.Equal(t, 0, tempos[0].tick)
+	assert.Equal(t, []byte{0xff, 0x51, 3, 0x09, 0x27, 0xc0}, tempos[0].data) // 600000 µs
+	assert.Equal(t, 1440, tempos[1].tick)
+	meters := metas(tracks[0], 0x58)
+	require.Len(t, meters, 2)
+	assert.Equal(t, []byte{0xff, 0x58, 4, 6, 3, 24, 8}, meters[0].data)
+	assert.Equal(t, []byte{0xff, 0x58, 4, 3, 2, 24, 8}, meters[1].data)
+
+	ticks, notes := notesOn(tracks[2], clickChannel)
+	assert.Equal(t, []int{0, 240, 480, 720, 960, 1200, 1440, 1920, 2400, 2880, 3360, 3840}, ticks)
+	assert.Equal(t, []byte{clickAccent, clickBeat, clickBeat}, notes[:3])
+
+	tracks = write(t, "C\n", StyleBlock)
+	assert.Equal(t, []byte{0xff, 0x51, 3, 0x07, 0xa1, 0x20}, metas(tracks[0], 0x51)[0].data) // 120 bpm
+}
+
+func TestParseStyle(t *testing.T) {
+	style, err := ParseStyle("Comp")
+	assert.NoError(t, err)
+	assert.Equal(t, StyleComp, style)
+	_, err = ParseStyle("swing")
+	assert.EqualError(t, err, "unknown style \"swing\": use block or comp")
+}
@@ -0,0 +1,397 @@
+package musicxml
+
+import (
+	"encoding/xml"
+	"lesheets/internal/domain"
+	"strconv"
+	"strings"
+)
+
+const abcLetters = "CDEFGAB"
+
+// abcMeasure is a bar of an ABC fragment as MusicXML harmonies and notes, with the key and meter set
+// by the fields written before its notes.
+type abcMeasure struct {
+	key   *domain.Key
+	meter *domain.Meter
+	notes []any
+}
+
+// abcReader reads the notes of an ABC fragment: pitches with their accidentals, lengths, rests,
+// chords, ties, broken rhythms, triplets and chord symbols. The decorations, grace notes, annotations
+// and the other fields are skipped.
+type abcReader struct {
+	scanner *domain.AbcScanner
+	// unit is the duration of the unit note length
+	unit      int
+	meter     domain.Meter
+	key       *domain.Key
+	signature [7]int
+	// accidentals written in the current bar, by letter and octave
+	accidentals map[int]int
+	measures    []*abcMeasure
+	current     *abcMeasure
+	// last is the last note or chord read, tied to the next one when tie is set
+	last    []*note
+	tie     bool
+	broken  int // the time added to the next note by a broken rhythm, negative to shorten it
+	tuplet  timeModification
+	inTuple int // the notes left in the tuplet
+}
+
+// maxRestBars bounds the bars of a multi-bar rest, "Z4".
+const maxRestBars = 100
+
+// readAbc reads an ABC fragment written with the default length given, in bars of the meter given.
+// Quoted Nashville numbers are spelled in the key given. Fragments without a K: field are read
+// without key signature, as inline backticks are rendered.
+func readAbc(abc string, defaultLength string, meter domain.Meter, key *domain.Key) []*abcMeasure {
+	r := &abcReader{scanner: domain.NewAbcScanner(abc), meter: meter, key: key, accidentals: map[int]int{}, current: &abcMeasure{}}
+	r.unit = Divisions / 2
+	r.setUnit(defaultLength)
+	for !r.scanner.Done() {
+		r.next(r.scanner.Next())
+	}
+	r.endMeasure()
+	return r.measures
+}
+
+// skipPast skips the tokens up to and including the given text.
+func (r *abcReader) skipPast(text string) {
+	for !r.scanner.Done() {
+		if r.scanner.Next().Text == text {
+			return
+		}
+	}
+}
+
+func (r *abcReader) next(tok domain.AbcToken) {
+	switch tok.Kind {
+	case domain.AbcField:
+		r.field(tok.Value)
+	case domain.AbcQuoted:
+		r.quoted(tok.Value)
+	case domain.AbcBarLine:
+		r.endMeasure()
+	case domain.AbcNote:
+		n := r.note(tok)
+		n.Duration = r.length()
+		r.add([]*note{n})
+	case domain.AbcText:
+		switch tok.Text {
+		case "{":
+			r.skipPast("}")
+		case "-":
+			r.tie = true
+		case ">", "<":
+			r.brokenRhythm(tok.Text[0])
+		case "(":
+			if r.scanner.Peek(0) >= '2' && r.scanner.Peek(0) <= '9' {
+				r.tupletStart()
+			}
+		case "[":
+			r.chord()
+		case "z", "x":
+			r.add([]*note{newNote(nil, r.length())})
+		case "Z":
+			num, den := r.scanner.Length()
+			for range min(max(num/den, 1), maxRestBars) {
+				r.current.notes = append(r.current.notes, &note{Rest: &rest{Measure: "yes"}, Duration: measureDuration(r.meter)})
+				r.endMeasure()
+			}
+		}
+	}
+}
+
+// field reads the key, meter and unit note length fields, like "K:Bb", and skips the others.
+func (r *abcReader) field(field string) {
+	name, value, _ := strings.Cut(field, ":")
+	value = strings.TrimSpace(value)
+	switch name {
+	case "K":
+		first, _, _ := strings.Cut(value, " ")
+		if key, ok := domain.AbcKeySignature(value); ok {
+			r.key = key
+			r.current.key = key
+			r.setSignature(key.Fifths())
+		} else if first == "none" || first == "" {
+			r.setSignature(0)
+		}
+	case "M":
+		if value == "C" {
+			value = "4/4"
+		} else if value == "C|" {
+			value = "2/2"
+		}
+		if meter, err := domain.ParseMeter(value); err == nil {
+			r.meter = meter
+			r.current.meter = &meter
+		}
+	case "L":
+		r.setUnit(value)
+	}
+}
+
+// setSignature sets the alteration of each letter from the sharps, or the flats when negative, of
+// the key signature.
+func (r *abcReader) setSignature(fifths int) {
+	r.signature = [7]int{}
+	for i := range min(max(fifths, -fifths), 7) {
+		if fifths > 0 {
+			r.signature[strings.IndexByte(abcLetters, "FCGDAEB"[i])] = 1
+		} else {
+			r.signature[strings.IndexByte(abcLetters, "BEADGCF"[i])] = -1
+		}
+	}
+}
+
+// setUnit sets the unit note length, "1/8". The lengths that can't be read, or that are shorter than
+// a division or longer than a breve, are left out.
+func (r *abcReader) setUnit(length string) {
+	num, den, _ := strings.Cut(length, "/")
+	n, errNum := strconv.Atoi(strings.TrimSpace(num))
+	d, errDen := strconv.Atoi(strings.TrimSpace(den))
+	if errNum != nil || errDen != nil || n < 1 || d < 1 || n > 2*d || Divisions*4*n/d < 1 {
+		return
+	}
+	r.unit = Divisions * 4 * n / d
+}
+
+// quoted adds the chord symbols as harmonies, the annotations ("^text", "<text", ...) are skipped.
+func (r *abcReader) quoted(value string) {
+	chord := domain.Chord{Value: value}
+	if chord.Kind() == domain.KindNoChord {
+		r.current.notes = append(r.current.notes, noChord())
+	} else if h := harmonyOf(value, r.key); h != nil {
+		r.current.notes = append(r.current.notes, h)
+	}
+}
+
+// note returns the note of a pitch, with the accidentals of the bar and of the key signature.
+func (r *abcReader) note(tok domain.AbcToken) *note {
+	alteration, accidental := tok.Alteration, ""
+	diatonic := tok.Octave*7 + tok.Letter
+	if tok.Explicit {
+		r.accidentals[diatonic] = alteration
+		accidental = accidentalNames[alteration]
+	} else if alt, ok := r.accidentals[diatonic]; ok {
+		alteration = alt
+	} else {
+		alteration = r.signature[tok.Letter]
+	}
+	return &note{Pitch: &pitch{Step: abcLetters[tok.Letter : tok.Letter+1], Alter: alteration, Octave: tok.Octave}, Accidental: accidental}
+}
+
+var accidentalNames = map[int]string{-2: "flat-flat", -1: "flat", 0: "natural", 1: "sharp", 2: "double-sharp"}
+
+// chord reads the notes of a chord up to its closing "]", they last as long as the first one.
+func (r *abcReader) chord() {
+	notes := []*note{}
+	for !r.scanner.Done() {
+		tok := r.scanner.Next()
+		if tok.Text == "]" {
+			break
+		}
+		if tok.Kind != domain.AbcNote {
+			continue
+		}
+		n := r.note(tok)
+		n.Duration = r.length()
+		if len(notes) > 0 {
+			n.Chord = &empty{}
+		}
+		notes = append(notes, n)
+	}
+	length := r.length()
+	if len(notes) == 0 {
+		return
+	}
+	duration := notes[0].Duration * length / r.unit
+	for _, n := range notes {
+		n.Duration = duration
+	}
+	r.add(notes)
+}
+
+// length reads the length after a note, as a number of divisions.
+func (r *abcReader) length() int {
+	num, den := r.scanner.Length()
+	return r.unit * num / den
+}
+
+// brokenRhythm dots the last note and shortens the next one, "A>B" being "A3/2B/2", the sign given
+// being already read.
+func (r *abcReader) brokenRhythm(shorter byte) {
+	n := 1
+	for r.scanner.Peek(0) == shorter {
+		n++
+		r.scanner.Skip(1)
+	}
+	if len(r.last) == 0 {
+		return
+	}
+	first := r.last[0].Duration
+	for _, last := range r.last {
+		if shorter == '>' {
+			last.Duration = last.Duration * (2<<n - 1) >> n
+		} else {
+			last.Duration = last.Duration >> n
+		}
+	}
+	// the next note gets the time the last one lost, or loses the time it gained
+	r.broken = first - r.last[0].Duration
+}
+
+// tupletStart reads "(p", "(p:q" or "(p:q:r", the "(" being already read: the next r notes, p by
+// default, play p in the time of q.
+func (r *abcReader) tupletStart() {
+	s := r.scanner
+	p := int(s.Peek(0) - '0')
+	s.Skip(1)
+	q, notes := 3, p
+	if p%2 == 1 || p == 6 {
+		q = 2
+	}
+	if s.Peek(0) == ':' && s.Peek(1) >= '1' && s.Peek(1) <= '9' {
+		q = int(s.Peek(1) - '0')
+		s.Skip(2)
+		if s.Peek(0) == ':' && s.Peek(1) >= '1' && s.Peek(1) <= '9' {
+			notes = int(s.Peek(1) - '0')
+			s.Skip(2)
+		}
+	}
+	r.tuplet = timeModification{Actual: p, Normal: q}
+	r.inTuple = notes
+}
+
+// add adds a note, or the notes of a chord, applying the tie, the broken rhythm and the tuplet
+// pending.
+func (r *abcReader) add(notes []*note) {
+	if r.broken != 0 {
+		for _, n := range notes {
+			n.Duration += r.broken
+		}
+		r.broken = 0
+	}
+	if r.inTuple > 0 {
+		for _, n := range notes {
+			n.Duration = n.Duration * r.tuplet.Normal / r.tuplet.Actual
+			tm := r.tuplet
+			n.TimeModification = &tm
+		}
+		r.inTuple--
+	}
+	if r.tie {
+		for _, n := range notes {
+			for _, last := range r.last {
+				if n.Pitch != nil && last.Pitch != nil && *n.Pitch == *last.Pitch {
+					last.tied("start")
+					n.tied("stop")
+				}
+			}
+		}
+		r.tie = false
+	}
+	for _, n := range notes {
+		n.setType()
+		r.current.notes = append(r.current.notes, n)
+	}
+	r.last = notes
+}
+
+// endMeasure ends the current measure if it has anything, the accidentals only last for their bar.
+func (r *abcReader) endMeasure() {
+	clear(r.accidentals)
+	if len(r.current.notes) == 0 && r.current.key == nil && r.current.meter == nil {
+		return
+	}
+	r.measures = append(r.measures, r.current)
+	r.current = &abcMeasure{}
+}
+
+type note struct {
+	XMLName          xml.Name          `xml:"note"`
+	Chord            *empty            `xml:"chord"`
+	Pitch            *pitch            `xml:"pitch"`
+	Rest             *rest             `xml:"rest"`
+	Duration         int               `xml:"duration"`
+	Ties             []tie             `xml:"tie"`
+	Type             string            `xml:"type,omitempty"`
+	Dots             []empty           `xml:"dot"`
+	Accidental       string            `xml:"accidental,omitempty"`
+	TimeModification *timeModification `xml:"time-modification"`
+	Notations        *notations        `xml:"notations"`
+}
+
+// newNote returns a note of the duration given, a rest when there is no pitch.
+func newNote(p *pitch, duration int) *note {
+	n := &note{Pitch: p, Duration: duration}
+	if p == nil {
+		n.Rest = &rest{}
+	}
+	n.setType()
+	return n
+}
+
+// noteTypes are the note types by their number of divisions.
+var noteTypes = []struct {
+	divisions int
+	name      string
+}{
+	{Divisions * 8, "breve"}, {Divisions * 4, "whole"}, {Divisions * 2, "half"}, {Divisions, "quarter"},
+	{Divisions / 2, "eighth"}, {Divisions / 4, "16th"}, {Divisions / 8, "32nd"}, {Divisions / 16, "64th"},
+}
+
+// setType sets the type and the dots of the note from its duration, the notes of a tuplet taking the
+// type of their written length. Notes of other lengths are written without type.
+func (n *note) setType() {
+	duration := n.Duration
+	if tm := n.TimeModification; tm != nil {
+		duration = duration * tm.Actual / tm.Normal
+	}
+	n.Type, n.Dots = "", nil
+	for _, t := range noteTypes {
+		switch duration {
+		case t.divisions:
+			n.Type = t.name
+		case t.divisions * 3 / 2:
+			n.Type, n.Dots = t.name, []empty{{}}
+		case t.divisions * 7 / 4:
+			n.Type, n.Dots = t.name, []empty{{}, {}}
+		default:
+			continue
+		}
+		return
+	}
+}
+
+func (n *note) tied(tieType string) {
+	n.Ties = append(n.Ties, tie{Type: tieType})
+	if n.Notations == nil {
+		n.Notations = &notations{}
+	}
+	n.Notations.Tied = append(n.Notations.Tied, tie{Type: tieType})
+}
+
+type pitch struct {
+	Step   string `xml:"step"`
+	Alter  int    `xml:"alter,omitempty"`
+	Octave int    `xml:"octave"`
+}
+
+type rest struct {
+	Measure string `xml:"measure,attr,omitempty"`
+}
+
+type tie struct {
+	Type string `xml:"type,attr"`
+}
+
+type timeModification struct {
+	Actual int `xml:"actual-notes"`
+	Normal int `xml:"normal-notes"`
+}
+
+type notations struct {
+	Tied []tie `xml:"tied"`
+}
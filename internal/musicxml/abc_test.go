@@ -0,0 +1,105 @@
+package musicxml
+
+import (
+	"lesheets/internal/domain"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// pitches returns the notes of the measures as "F#4:480", rests as "z:480" and the notes of a chord
+// after a "+".
+func pitches(measures []*abcMeasure) [][]string {
+	res := [][]string{}
+	for _, m := range measures {
+		notes := []string{}
+		for _, element := range m.notes {
+			n, ok := element.(*note)
+			if !ok {
+				continue
+			}
+			name := "z"
+			if n.Pitch != nil {
+				name = n.Pitch.Step + map[int]string{-1: "b", 1: "#"}[n.Pitch.Alter] + string(rune('0'+n.Pitch.Octave))
+			}
+			if n.Chord != nil {
+				name = "+" + name
+			}
+			notes = append(notes, name+":"+strconv.Itoa(n.Duration))
+		}
+		res = append(res, notes)
+	}
+	return res
+}
+
+func TestReadAbc(t *testing.T) {
+	testCases := []struct {
+		desc string
+		abc  string
+		out  [][]string
+	}{
+		{desc: "lengths", abc: "C D2 E/ F/2 G3/2 A//", out: [][]string{{"C4:240", "D4:480", "E4:120", "F4:120", "G4:360", "A4:60"}}},
+		{desc: "octaves", abc: "C, c c' C,,", out: [][]string{{"C3:240", "C5:240", "C6:240", "C2:240"}}},
+		{desc: "rests", abc: "z2 x", out: [][]string{{"z:480", "z:240"}}},
+		{desc: "bars", abc: "C4 | D4 |] E4", out: [][]string{{"C4:960"}, {"D4:960"}, {"E4:960"}}},
+		{desc: "accidentals last for the bar", abc: "^F F =F | F _B", out: [][]string{{"F#4:240", "F#4:240", "F4:240"}, {"F4:240", "Bb4:240"}}},
+		{desc: "key signature", abc: "K:Eb\nE A B =B", out: [][]string{{"Eb4:240", "Ab4:240", "Bb4:240", "B4:240"}}},
+		{desc: "modes", abc: "K:Dmix\nF C [K:A minor] F", out: [][]string{{"F#4:240", "C4:240", "F4:240"}}},
+		{desc: "inline fields", abc: "C [L:1/4] C [K:G] F", out: [][]string{{"C4:240", "C4:480", "F#4:480"}}},
+		{desc: "chords", abc: "[CEG]2 [C2E2]", out: [][]string{{"C4:480", "+E4:480", "+G4:480", "C4:480", "+E4:480"}}},
+		{desc: "broken rhythm", abc: "C>D E<F G>>A", out: [][]string{{"C4:360", "D4:120", "E4:120", "F4:360", "G4:420", "A4:60"}}},
+		{desc: "triplets", abc: "(3CDE F", out: [][]string{{"C4:160", "D4:160", "E4:160", "F4:240"}}},
+		{desc: "skipped", abc: "!trill!C {g}D \"^text\"E % comment\nF", out: [][]string{{"C4:240", "D4:240", "E4:240", "F4:240"}}},
+		{desc: "endings", abc: "[1 C4 :|[2 \"G\"D4", out: [][]string{{"C4:960"}, {"D4:960"}}},
+		{desc: "chord after a bar line", abc: "C4 |[CE]4", out: [][]string{{"C4:960"}, {"C4:960", "+E4:960"}}},
+		{desc: "unit too short", abc: "L:1/4096\nC D2", out: [][]string{{"C4:240", "D4:480"}}},
+		{desc: "unit too long", abc: "L:900000000/1\nC", out: [][]string{{"C4:240"}}},
+		{desc: "length too long", abc: "C99999999999999999999", out: [][]string{{"C4:15728640"}}},
+		{desc: "length too short", abc: "C/////////////////////////////////////////////////////////////////", out: [][]string{{"C4:0"}}},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			assert.Equal(t, tC.out, pitches(readAbc(tC.abc, "1/8", domain.DefaultMeter, nil)))
+		})
+	}
+}
+
+func TestReadAbcMultiBarRests(t *testing.T) {
+	testCases := []struct {
+		abc  string
+		bars int
+	}{
+		{abc: "Z", bars: 1},
+		{abc: "Z4", bars: 4},
+		{abc: "Z900000000", bars: 100},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.abc, func(t *testing.T) {
+			measures := readAbc(tC.abc, "1/8", domain.DefaultMeter, nil)
+			require.Len(t, measures, tC.bars)
+			assert.Equal(t, "yes", measures[0].notes[0].(*note).Rest.Measure)
+			assert.Equal(t, Divisions*4, measures[0].notes[0].(*note).Duration)
+		})
+	}
+}
+
+func TestReadAbcTies(t *testing.T) {
+	measures := readAbc("C2- | C2 D", "1/8", domain.DefaultMeter, nil)
+	require.Len(t, measures, 2)
+	first, second := measures[0].notes[0].(*note), measures[1].notes[0].(*note)
+	assert.Equal(t, []tie{{Type: "start"}}, first.Ties)
+	assert.Equal(t, []tie{{Type: "stop"}}, second.Ties)
+	assert.Empty(t, measures[1].notes[1].(*note).Ties)
+}
+
+func TestReadAbcChordSymbols(t *testing.T) {
+	key, err := domain.ParseKey("G")
+	require.NoError(t, err)
+	measures := readAbc("\"4\"C \"N.C.\"z \"<left\"D", "1/8", domain.DefaultMeter, key)
+	require.Len(t, measures, 1)
+	assert.Len(t, measures[0].notes, 5)
+	assert.Equal(t, "C", measures[0].notes[0].(*harmony).Root.Step.Value)
+	assert.Equal(t, "none", measures[0].notes[2].(*harmony).Kind.Value)
+}
@@ -0,0 +1,235 @@
+package musicxml
+
+import (
+	"encoding/xml"
+	"lesheets/internal/domain"
+	"strconv"
+	"strings"
+)
+
+// harmonyOf returns the harmony of a chord symbol, nil when it can't be read. The kind is the closest
+// one of MusicXML, with the suffix as written for its text and the added or altered notes as degrees.
+// Nashville numbers are spelled in the key given, or written as numerals without their bass when
+// there is no key.
+func harmonyOf(value string, key *domain.Key) *harmony {
+	symbol, err := domain.ParseChordSymbol(value)
+	if err != nil {
+		return nil
+	}
+	h := &harmony{}
+	chordRoot, bass := symbol.Root, symbol.Bass
+	switch {
+	case symbol.IsNashville() && key == nil:
+		h.Numeral = &numeral{Root: numeralRoot{Text: chordRoot.String(), Value: chordRoot.Degree}, Alter: alter(chordRoot.Accidental)}
+		bass = nil
+	case symbol.IsNashville():
+		chordRoot = key.ToLetter(chordRoot)
+		fallthrough
+	default:
+		h.Root = &root{Step: step{Value: chordRoot.Letter}, Alter: alter(chordRoot.Accidental)}
+	}
+	if bass != nil && bass.IsNashville() {
+		if key == nil {
+			bass = nil
+		} else {
+			b := key.ToLetter(*bass)
+			bass = &b
+		}
+	}
+	value, degrees := chordKind(symbol)
+	h.Kind = kind{Text: symbol.Suffix, Value: value}
+	if bass != nil {
+		h.Bass = &bassNote{Step: bass.Letter, Alter: alter(bass.Accidental)}
+	}
+	h.Degrees = degrees
+	return h
+}
+
+// noChord is the harmony of "N.C.", MusicXML needs a root even when there is no chord.
+func noChord() *harmony {
+	text := ""
+	return &harmony{Root: &root{Step: step{Text: &text, Value: "C"}}, Kind: kind{Text: "N.C.", Value: "none"}}
+}
+
+// chordKind returns the MusicXML kind of a chord with the degrees it adds to it or alters. The
+// degrees are altered from the major scale: a minor seventh is a 7 altered by -1.
+func chordKind(symbol *domain.ChordSymbol) (string, []degree) {
+	seventh, top := 0, 0 // seventh is 1 for a minor seventh, 2 for a major one
+	sixth, power := false, false
+	sus := ""
+	numbers := []int{}
+	var degrees []degree
+	for _, ext := range symbol.Extensions {
+		switch {
+		case ext == "5":
+			power = true
+		case ext == "sus2" || ext == "sus4":
+			sus = ext
+		case ext == "6":
+			sixth = true
+		case strings.HasPrefix(ext, "maj"):
+			seventh = 2
+			n, _ := strconv.Atoi(ext[3:])
+			top = max(top, n)
+		case strings.HasPrefix(ext, "add"):
+			if d, ok := newDegree(ext[3:], "add"); ok {
+				degrees = append(degrees, d)
+			}
+		default:
+			if n, err := strconv.Atoi(ext); err == nil && n >= 7 {
+				numbers = append(numbers, n)
+			}
+		}
+	}
+	for _, n := range numbers {
+		if sixth {
+			// 6/9
+			degrees = append(degrees, degree{Value: n, Type: "add"})
+			continue
+		}
+		if seventh == 0 {
+			seventh = 1
+		}
+		top = max(top, n)
+	}
+	for _, alt := range symbol.Alterations {
+		d, ok := newDegree(alt, "add")
+		if !ok {
+			continue
+		}
+		if d.Value == 5 || d.Value <= top {
+			d.Type = "alter"
+		}
+		degrees = append(degrees, d)
+	}
+
+	extended := func(names ...string) string {
+		switch top {
+		case 9:
+			return names[1]
+		case 11:
+			return names[2]
+		case 13:
+			return names[3]
+		}
+		return names[0]
+	}
+	switch {
+	case power:
+		return "power", degrees
+	case sus != "":
+		if seventh > 0 {
+			degrees = append([]degree{{Value: 7, Alter: seventh - 2, Type: "add"}}, degrees...)
+		}
+		if top > 7 {
+			degrees = append(degrees, degree{Value: top, Type: "add"})
+		}
+		if sus == "sus2" {
+			return "suspended-second", degrees
+		}
+		return "suspended-fourth", degrees
+	}
+	switch symbol.Quality {
+	case domain.QualityMinor:
+		switch {
+		case seventh == 2:
+			return "major-minor", degrees
+		case seventh == 1:
+			return extended("minor-seventh", "minor-ninth", "minor-11th", "minor-13th"), degrees
+		case sixth:
+			return "minor-sixth", degrees
+		}
+		return "minor", degrees
+	case domain.QualityDiminished:
+		if seventh > 0 {
+			return "diminished-seventh", degrees
+		}
+		return "diminished", degrees
+	case domain.QualityAugmented:
+		if seventh == 1 {
+			return "augmented-seventh", degrees
+		}
+		return "augmented", degrees
+	case domain.QualityHalfDiminished:
+		return "half-diminished", degrees
+	}
+	switch {
+	case seventh == 2:
+		return extended("major-seventh", "major-ninth", "major-11th", "major-13th"), degrees
+	case seventh == 1:
+		return extended("dominant", "dominant-ninth", "dominant-11th", "dominant-13th"), degrees
+	case sixth:
+		return "major-sixth", degrees
+	}
+	return "major", degrees
+}
+
+// newDegree reads a degree with an optional accidental, like "9" or "#11".
+func newDegree(value string, degreeType string) (degree, bool) {
+	d := degree{Type: degreeType}
+	if strings.HasPrefix(value, "b") || strings.HasPrefix(value, "#") {
+		d.Alter = alter(value[:1])
+		value = value[1:]
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return degree{}, false
+	}
+	d.Value = n
+	return d, true
+}
+
+func alter(accidental string) int {
+	switch accidental {
+	case "#":
+		return 1
+	case "b":
+		return -1
+	}
+	return 0
+}
+
+type harmony struct {
+	XMLName xml.Name  `xml:"harmony"`
+	Root    *root     `xml:"root"`
+	Numeral *numeral  `xml:"numeral"`
+	Kind    kind      `xml:"kind"`
+	Bass    *bassNote `xml:"bass"`
+	Degrees []degree  `xml:"degree"`
+}
+
+type root struct {
+	Step  step `xml:"root-step"`
+	Alter int  `xml:"root-alter,omitempty"`
+}
+
+type step struct {
+	Text  *string `xml:"text,attr,omitempty"`
+	Value string  `xml:",chardata"`
+}
+
+type numeral struct {
+	Root  numeralRoot `xml:"numeral-root"`
+	Alter int         `xml:"numeral-alter,omitempty"`
+}
+
+type numeralRoot struct {
+	Text  string `xml:"text,attr"`
+	Value int    `xml:",chardata"`
+}
+
+type kind struct {
+	Text  string `xml:"text,attr"`
+	Value string `xml:",chardata"`
+}
+
+type bassNote struct {
+	Step  string `xml:"bass-step"`
+	Alter int    `xml:"bass-alter,omitempty"`
+}
+
+type degree struct {
+	Value int    `xml:"degree-value"`
+	Alter int    `xml:"degree-alter"`
+	Type  string `xml:"degree-type"`
+}
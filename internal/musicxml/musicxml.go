@@ -0,0 +1,455 @@
+// Package musicxml writes songs as MusicXML scores, to go on working on them in notation software
+// like MuseScore or Dorico: the chords as harmonies over slashes, the sections as rehearsal marks, the
+// repeats, endings and navigation markers as in the chart, and the ABC backticks as notes.
+package musicxml
+
+import (
+	"encoding/xml"
+	"io"
+	"lesheets/internal/domain"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Divisions is the number of divisions of a quarter note, the unit of the durations.
+const Divisions = 480
+
+const header = `<?xml version="1.0" encoding="UTF-8" standalone="no"?>
+<!DOCTYPE score-partwise PUBLIC "-//Recordare//DTD MusicXML 4.0 Partwise//EN" "http://www.musicxml.org/dtds/partwise.dtd">
+`
+
+// Write writes the song as a partwise MusicXML 4.0 score with a single part. The bars are written in
+// the order of the chart, each line of the chart starting a new system. The bars with chords have
+// slash notation, a rest of the length of each chord under its harmony, and the bars written with
+// ABC backticks have their notes, as far as they can be read.
+func Write(w io.Writer, song *domain.Song) error {
+	sw := &writer{}
+	for _, section := range song.Sections {
+		rehearsal := section.Name
+		for _, line := range section.Lines {
+			if line.MultilineBacktick.Value != "" {
+				sw.multilineBacktick(line.MultilineBacktick, rehearsal)
+				rehearsal = ""
+			}
+			for i := range line.Bars {
+				sw.bar(line.Bars, i, rehearsal)
+				rehearsal = ""
+			}
+		}
+	}
+	if len(sw.measures) == 0 {
+		sw.rest(sw.measure(domain.DefaultMeter, ""), domain.DefaultMeter)
+	}
+	score := score{
+		Version:        "4.0",
+		Identification: identification{Software: "lesheets"},
+		PartList:       partList{ScorePart: scorePart{ID: "P1", Name: "Chords"}},
+		Part:           part{ID: "P1", Measures: sw.measures},
+	}
+	if title := song.FrontMatter["title"]; title != "" {
+		score.Work = &work{Title: title}
+	}
+	if _, err := io.WriteString(w, header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(score); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// writer holds what is in effect on the last measure written, to write the changes only.
+type writer struct {
+	measures []*measure
+	meter    domain.Meter
+	key      string
+	tempo    int
+	// newSystem is set at the start of a line of the chart
+	newSystem bool
+	// slashes tells whether the measures have slash notation, and repeated the number of bars of the
+	// measure repeat in progress
+	slashes  bool
+	repeated int
+}
+
+// measure starts a measure with the meter and key given, writing them when they change.
+func (w *writer) measure(meter domain.Meter, key string) *measure {
+	m := &measure{Number: strconv.Itoa(len(w.measures) + 1)}
+	if w.newSystem && len(w.measures) > 0 {
+		m.add(&print{NewSystem: "yes"})
+	}
+	w.newSystem = false
+	attrs := &attributes{}
+	if len(w.measures) == 0 {
+		attrs.Divisions = Divisions
+		attrs.Key = &keySignature{}
+		attrs.Clef = &clef{Sign: "G", Line: 2}
+	}
+	if key != w.key {
+		if k, err := domain.ParseKey(key); err == nil {
+			attrs.Key = &keySignature{Fifths: k.Fifths(), Mode: "major"}
+			if k.Minor {
+				attrs.Key.Mode = "minor"
+			}
+			w.key = key
+		}
+	}
+	if meter != w.meter {
+		attrs.Time = &timeSignature{Beats: meter.Beats, BeatType: meter.Unit}
+		w.meter = meter
+	}
+	m.attributes = attrs
+	m.add(attrs)
+	w.measures = append(w.measures, m)
+	return m
+}
+
+// style starts or stops the slash notation and the measure repeats on the measure.
+func (w *writer) style(m *measure, slashes bool, repeated int) {
+	if w.repeated != repeated {
+		if w.repeated > 0 {
+			m.attributes.MeasureStyles = append(m.attributes.MeasureStyles, measureStyle{MeasureRepeat: &measureRepeat{Type: "stop"}})
+		}
+		if repeated > 0 {
+			m.attributes.MeasureStyles = append(m.attributes.MeasureStyles, measureStyle{
+				MeasureRepeat: &measureRepeat{Type: "start", Slashes: repeated, Value: strconv.Itoa(repeated)},
+			})
+		}
+		w.repeated = repeated
+	}
+	if w.slashes != slashes {
+		slashType := "stop"
+		if slashes {
+			slashType = "start"
+		}
+		m.attributes.MeasureStyles = append(m.attributes.MeasureStyles, measureStyle{Slash: &slash{Type: slashType, UseStems: "no"}})
+		w.slashes = slashes
+	}
+}
+
+func (w *writer) bar(bars []domain.Bar, i int, rehearsal string) {
+	bar := &bars[i]
+	if i == 0 {
+		w.newSystem = true
+	}
+	m := w.measure(bar.Meter, bar.Key)
+	if bar.RepeatStart || bar.EndingStart {
+		left := &barline{Location: "left"}
+		if bar.EndingStart {
+			left.Ending = &ending{Number: endingNumber(bar.Ending), Type: "start", Value: bar.Ending.Label + "."}
+		}
+		if bar.RepeatStart {
+			left.Repeat = &repeat{Direction: "forward"}
+		}
+		m.add(left)
+	}
+	if rehearsal != "" {
+		m.add(&direction{Placement: "above", Types: []directionType{{Rehearsal: rehearsal}}})
+	}
+	if bar.Tempo > 0 && bar.Tempo != w.tempo {
+		m.add(&direction{
+			Placement: "above",
+			Types:     []directionType{{Metronome: &metronome{BeatUnit: "quarter", PerMinute: bar.Tempo}}},
+			Sound:     &sound{Tempo: bar.Tempo},
+		})
+		w.tempo = bar.Tempo
+	}
+	for _, n := range bar.NavigationAt(true) {
+		m.add(navigation(n))
+	}
+	if bar.BarNote != "" {
+		m.add(&direction{Placement: "above", Types: []directionType{{Words: bar.BarNote}}})
+	}
+
+	key, _ := domain.ParseKey(bar.Key)
+	switch {
+	case bar.RepeatedBars() > 0:
+		w.style(m, w.slashes, bar.RepeatedBars())
+		w.rest(m, bar.Meter)
+	case bar.Backtick.Value != "":
+		w.style(m, false, 0)
+		notes := []any{}
+		for _, am := range readAbc(bar.Backtick.Value, bar.Backtick.DefaultLength, bar.Meter, key) {
+			notes = append(notes, am.notes...)
+		}
+		if len(notes) == 0 {
+			w.rest(m, bar.Meter)
+		}
+		m.add(notes...)
+	default:
+		w.style(m, true, 0)
+		w.chords(m, bar, key)
+	}
+
+	for _, n := range bar.NavigationAt(false) {
+		m.add(navigation(n))
+	}
+	right := &barline{Location: "right"}
+	if bar.Ending != nil && endsEnding(bars, i) {
+		right.Ending = &ending{Number: endingNumber(bar.Ending), Type: "discontinue"}
+		if bar.RepeatEnd {
+			right.Ending.Type = "stop"
+		}
+	}
+	if bar.RepeatEnd {
+		right.Style = "light-heavy"
+		right.Repeat = &repeat{Direction: "backward", Times: bar.RepeatCount}
+	} else if bar.DoubleBarEnd {
+		right.Style = "light-light"
+	}
+	if right.Ending != nil || right.Repeat != nil || right.Style != "" {
+		m.add(right)
+	}
+}
+
+// chords writes a rest for each chord of the bar, under its harmony. The "/" beats have no harmony,
+// and the "." beats lengthen the chord before them.
+func (w *writer) chords(m *measure, bar *domain.Bar, key *domain.Key) {
+	beat := float64(Divisions*4) / float64(bar.Meter.Unit)
+	written := false
+	for _, chord := range bar.Chords {
+		duration := int(math.Round(chord.Duration * beat))
+		if chord.IsPlaceholder() || duration <= 0 {
+			continue
+		}
+		switch chord.Kind() {
+		case domain.KindNoChord:
+			m.add(noChord())
+		case domain.KindChord:
+			if h := harmonyOf(chord.Value, key); h != nil {
+				m.add(h)
+			}
+		}
+		if chord.Duration == float64(bar.Meter.Beats) {
+			w.rest(m, bar.Meter)
+		} else {
+			m.add(newNote(nil, duration))
+		}
+		written = true
+	}
+	if !written {
+		w.rest(m, bar.Meter)
+	}
+}
+
+// rest writes a rest of the whole measure.
+func (w *writer) rest(m *measure, meter domain.Meter) {
+	m.add(&note{Rest: &rest{Measure: "yes"}, Duration: measureDuration(meter)})
+}
+
+// multilineBacktick writes a measure for each bar of the ABC tune, with the key and meter of its
+// fields.
+func (w *writer) multilineBacktick(mb domain.MultilineBacktick, rehearsal string) {
+	w.newSystem = true
+	meter, key := w.meter, w.key
+	if meter.Beats == 0 {
+		meter = domain.DefaultMeter
+	}
+	parsedKey, _ := domain.ParseKey(key)
+	for _, am := range readAbc(mb.Value, mb.DefaultLength, meter, parsedKey) {
+		if am.meter != nil {
+			meter = *am.meter
+		}
+		if am.key != nil {
+			key = am.key.String()
+		}
+		m := w.measure(meter, key)
+		w.style(m, false, 0)
+		if rehearsal != "" {
+			m.add(&direction{Placement: "above", Types: []directionType{{Rehearsal: rehearsal}}})
+			rehearsal = ""
+		}
+		m.add(am.notes...)
+	}
+}
+
+func navigation(n domain.Navigation) *direction {
+	d := &direction{Placement: "above", Types: []directionType{{Words: n.Text()}}, Sound: &sound{}}
+	switch {
+	case n == domain.Segno:
+		d.Types[0] = directionType{Segno: &empty{}}
+		d.Sound.Segno = "segno"
+	case n == domain.Coda:
+		d.Types[0] = directionType{Coda: &empty{}}
+		d.Sound.Coda = "coda"
+	case n == domain.Fine:
+		d.Sound.Fine = "yes"
+	case n == domain.ToCoda:
+		d.Sound.ToCoda = "coda"
+	case n.IsDalSegno():
+		d.Sound.DalSegno = "segno"
+	case n.IsJump():
+		d.Sound.DaCapo = "yes"
+	}
+	return d
+}
+
+func endingNumber(e *domain.Ending) string {
+	passes := []string{}
+	for _, r := range e.Passes {
+		for pass := r.First; pass <= r.Last; pass++ {
+			passes = append(passes, strconv.Itoa(pass))
+		}
+	}
+	return strings.Join(passes, ", ")
+}
+
+// endsEnding tells whether the bar is the last one of the bracket of its ending.
+func endsEnding(bars []domain.Bar, i int) bool {
+	return i == len(bars)-1 || bars[i+1].Ending != bars[i].Ending || bars[i+1].EndingStart
+}
+
+func measureDuration(meter domain.Meter) int {
+	return meter.Beats * Divisions * 4 / meter.Unit
+}
+
+type score struct {
+	XMLName        xml.Name       `xml:"score-partwise"`
+	Version        string         `xml:"version,attr"`
+	Work           *work          `xml:"work"`
+	Identification identification `xml:"identification"`
+	PartList       partList       `xml:"part-list"`
+	Part           part           `xml:"part"`
+}
+
+type work struct {
+	Title string `xml:"work-title"`
+}
+
+type identification struct {
+	Software string `xml:"encoding>software"`
+}
+
+type partList struct {
+	ScorePart scorePart `xml:"score-part"`
+}
+
+type scorePart struct {
+	ID   string `xml:"id,attr"`
+	Name string `xml:"part-name"`
+}
+
+type part struct {
+	ID       string     `xml:"id,attr"`
+	Measures []*measure `xml:"measure"`
+}
+
+// measure holds its elements in order: print, barline, attributes, direction, harmony and note.
+type measure struct {
+	Number     string `xml:"number,attr"`
+	Content    []any
+	attributes *attributes
+}
+
+func (m *measure) add(elements ...any) {
+	m.Content = append(m.Content, elements...)
+}
+
+type empty struct{}
+
+type print struct {
+	XMLName   xml.Name `xml:"print"`
+	NewSystem string   `xml:"new-system,attr,omitempty"`
+}
+
+type attributes struct {
+	XMLName       xml.Name       `xml:"attributes"`
+	Divisions     int            `xml:"divisions,omitempty"`
+	Key           *keySignature  `xml:"key"`
+	Time          *timeSignature `xml:"time"`
+	Clef          *clef          `xml:"clef"`
+	MeasureStyles []measureStyle `xml:"measure-style"`
+}
+
+// MarshalXML leaves out the attributes without any element.
+func (a *attributes) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	if a.Divisions == 0 && a.Key == nil && a.Time == nil && a.Clef == nil && len(a.MeasureStyles) == 0 {
+		return nil
+	}
+	type plain attributes
+	return e.EncodeElement((*plain)(a), xml.StartElement{Name: xml.Name{Local: "attributes"}})
+}
+
+type keySignature struct {
+	Fifths int    `xml:"fifths"`
+	Mode   string `xml:"mode,omitempty"`
+}
+
+type timeSignature struct {
+	Beats    int `xml:"beats"`
+	BeatType int `xml:"beat-type"`
+}
+
+type clef struct {
+	Sign string `xml:"sign"`
+	Line int    `xml:"line"`
+}
+
+type measureStyle struct {
+	MeasureRepeat *measureRepeat `xml:"measure-repeat"`
+	Slash         *slash         `xml:"slash"`
+}
+
+type measureRepeat struct {
+	Type    string `xml:"type,attr"`
+	Slashes int    `xml:"slashes,attr,omitempty"`
+	Value   string `xml:",chardata"`
+}
+
+type slash struct {
+	Type     string `xml:"type,attr"`
+	UseStems string `xml:"use-stems,attr,omitempty"`
+}
+
+type barline struct {
+	XMLName  xml.Name `xml:"barline"`
+	Location string   `xml:"location,attr"`
+	Style    string   `xml:"bar-style,omitempty"`
+	Ending   *ending  `xml:"ending"`
+	Repeat   *repeat  `xml:"repeat"`
+}
+
+type ending struct {
+	Number string `xml:"number,attr"`
+	Type   string `xml:"type,attr"`
+	Value  string `xml:",chardata"`
+}
+
+type repeat struct {
+	Direction string `xml:"direction,attr"`
+	Times     int    `xml:"times,attr,omitempty"`
+}
+
+type direction struct {
+	XMLName   xml.Name        `xml:"direction"`
+	Placement string          `xml:"placement,attr,omitempty"`
+	Types     []directionType `xml:"direction-type"`
+	Sound     *sound          `xml:"sound"`
+}
+
+type directionType struct {
+	Rehearsal string     `xml:"rehearsal,omitempty"`
+	Segno     *empty     `xml:"segno"`
+	Coda      *empty     `xml:"coda"`
+	Words     string     `xml:"words,omitempty"`
+	Metronome *metronome `xml:"metronome"`
+}
+
+type metronome struct {
+	BeatUnit  string `xml:"beat-unit"`
+	PerMinute int    `xml:"per-minute"`
+}
+
+type sound struct {
+	Tempo    int    `xml:"tempo,attr,omitempty"`
+	Segno    string `xml:"segno,attr,omitempty"`
+	Coda     string `xml:"coda,attr,omitempty"`
+	Fine     string `xml:"fine,attr,omitempty"`
+	ToCoda   string `xml:"tocoda,attr,omitempty"`
+	DaCapo   string `xml:"dacapo,attr,omitempty"`
+	DalSegno string `xml:"dalsegno,attr,omitempty"`
+}
@@ -0,0 +1,257 @@
+package musicxml
+
+import (
+	"bytes"
+	"encoding/xml"
+	"lesheets/internal"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type xmlScore struct {
+	Title    string       `xml:"work>work-title"`
+	Measures []xmlMeasure `xml:"part>measure"`
+}
+
+type xmlMeasure struct {
+	Number    string        `xml:"number,attr"`
+	Print     *xmlPrint     `xml:"print"`
+	Fifths    []int         `xml:"attributes>key>fifths"`
+	Beats     []int         `xml:"attributes>time>beats"`
+	Slashes   []xmlSlash    `xml:"attributes>measure-style>slash"`
+	Repeats   []xmlRepeat   `xml:"attributes>measure-style>measure-repeat"`
+	Rehearsal []string      `xml:"direction>direction-type>rehearsal"`
+	Words     []string      `xml:"direction>direction-type>words"`
+	Tempo     []int         `xml:"direction>direction-type>metronome>per-minute"`
+	Harmonies []xmlHarmony  `xml:"harmony"`
+	Notes     []xmlNote     `xml:"note"`
+	Barlines  []xmlBarline  `xml:"barline"`
+	Sounds    []xmlSoundTag `xml:"direction>sound"`
+}
+
+type xmlPrint struct {
+	NewSystem string `xml:"new-system,attr"`
+}
+
+type xmlSlash struct {
+	Type string `xml:"type,attr"`
+}
+
+type xmlRepeat struct {
+	Type    string `xml:"type,attr"`
+	Slashes int    `xml:"slashes,attr"`
+}
+
+type xmlHarmony struct {
+	Root    string  `xml:"root>root-step"`
+	Alter   int     `xml:"root>root-alter"`
+	Numeral int     `xml:"numeral>numeral-root"`
+	Kind    xmlKind `xml:"kind"`
+	Bass    string  `xml:"bass>bass-step"`
+}
+
+type xmlKind struct {
+	Value string `xml:",chardata"`
+	Text  string `xml:"text,attr"`
+}
+
+type xmlNote struct {
+	Rest     *struct{} `xml:"rest"`
+	Step     string    `xml:"pitch>step"`
+	Alter    int       `xml:"pitch>alter"`
+	Octave   int       `xml:"pitch>octave"`
+	Duration int       `xml:"duration"`
+	Type     string    `xml:"type"`
+}
+
+type xmlBarline struct {
+	Location string     `xml:"location,attr"`
+	Style    string     `xml:"bar-style"`
+	Ending   *xmlEnding `xml:"ending"`
+	Repeat   *repeat    `xml:"repeat"`
+}
+
+type xmlEnding struct {
+	Number string `xml:"number,attr"`
+	Type   string `xml:"type,attr"`
+}
+
+type xmlSoundTag struct {
+	Tempo    int    `xml:"tempo,attr"`
+	Segno    string `xml:"segno,attr"`
+	DalSegno string `xml:"dalsegno,attr"`
+	Fine     string `xml:"fine,attr"`
+}
+
+func write(t *testing.T, source string) xmlScore {
+	song, err := internal.ParseSongFromString(source)
+	require.NoError(t, err)
+	buf := bytes.Buffer{}
+	require.NoError(t, Write(&buf, song))
+	require.True(t, strings.HasPrefix(buf.String(), "<?xml"))
+	score := xmlScore{}
+	require.NoError(t, xml.Unmarshal(buf.Bytes(), &score))
+	return score
+}
+
+func TestWriteChords(t *testing.T) {
+	score := write(t, "---\ntitle: Blue\n---\nC . . F/A | Bbmaj7 | Em7b5 / A7(b9) | N.C. |\n")
+	assert.Equal(t, "Blue", score.Title)
+	require.Len(t, score.Measures, 4)
+
+	first := score.Measures[0]
+	assert.Equal(t, []int{0}, first.Fifths)
+	assert.Equal(t, []int{4}, first.Beats)
+	assert.Equal(t, []xmlSlash{{Type: "start"}}, first.Slashes)
+	assert.Equal(t, []xmlHarmony{
+		{Root: "C", Kind: xmlKind{Value: "major"}},
+		{Root: "F", Kind: xmlKind{Value: "major"}, Bass: "A"},
+	}, first.Harmonies)
+	assert.Equal(t, []int{1440, 480}, []int{first.Notes[0].Duration, first.Notes[1].Duration})
+	assert.Equal(t, []string{"half", "quarter"}, []string{first.Notes[0].Type, first.Notes[1].Type})
+	assert.NotNil(t, first.Notes[0].Rest)
+
+	assert.Equal(t, []xmlHarmony{{Root: "B", Alter: -1, Kind: xmlKind{"major-seventh", "maj7"}}}, score.Measures[1].Harmonies)
+	assert.Equal(t, 1920, score.Measures[1].Notes[0].Duration)
+
+	third := score.Measures[2]
+	assert.Equal(t, []xmlHarmony{
+		{Root: "E", Kind: xmlKind{"minor-seventh", "m7b5"}},
+		{Root: "A", Kind: xmlKind{"dominant", "7(b9)"}},
+	}, third.Harmonies)
+	assert.Len(t, third.Notes, 3, "the slash beat is a rest without harmony")
+
+	assert.Equal(t, []xmlHarmony{{Root: "C", Kind: xmlKind{"none", "N.C."}}}, score.Measures[3].Harmonies)
+}
+
+func TestWriteStructure(t *testing.T) {
+	score := write(t, "---\nkey: F\ntempo: 90\n---\n"+
+		"# Verse\n"+
+		"||: \"Fill\" F | C !segno! :|| x3\n"+
+		"[1 Dm | %% | %% :||\n"+
+		"[2 Bb !D.S.alfine! ||\n"+
+		"# Bridge !key=D! !tempo=120!\n"+
+		"(3/4) D !fine! | G\n")
+	require.Len(t, score.Measures, 8)
+
+	verse := score.Measures[0]
+	assert.Nil(t, verse.Print)
+	assert.Equal(t, []int{-1}, verse.Fifths)
+	assert.Equal(t, []string{"Verse"}, verse.Rehearsal)
+	assert.Equal(t, []int{90}, verse.Tempo)
+	assert.Equal(t, []string{"Fill"}, verse.Words)
+	assert.Equal(t, []xmlBarline{{Location: "left", Repeat: &repeat{Direction: "forward"}}}, verse.Barlines)
+
+	assert.Equal(t, "segno", score.Measures[1].Sounds[0].Segno)
+	assert.Equal(t, []xmlBarline{{Location: "right", Style: "light-heavy", Repeat: &repeat{Direction: "backward", Times: 3}}}, score.Measures[1].Barlines)
+
+	firstEnding := score.Measures[2]
+	assert.Equal(t, "yes", firstEnding.Print.NewSystem)
+	assert.Equal(t, []xmlBarline{{Location: "left", Ending: &xmlEnding{"1", "start"}}}, firstEnding.Barlines)
+	assert.Equal(t, []xmlRepeat{{Type: "start", Slashes: 2}}, score.Measures[3].Repeats)
+	assert.Empty(t, score.Measures[3].Harmonies)
+	assert.Equal(t, []xmlBarline{{Location: "right", Style: "light-heavy", Repeat: &repeat{Direction: "backward"}, Ending: &xmlEnding{"1", "stop"}}}, score.Measures[4].Barlines)
+
+	secondEnding := score.Measures[5]
+	assert.Equal(t, []xmlRepeat{{Type: "stop"}}, secondEnding.Repeats)
+	assert.Equal(t, []string{"D.S. al Fine"}, secondEnding.Words)
+	assert.Equal(t, "segno", secondEnding.Sounds[0].DalSegno)
+	assert.Equal(t, []xmlBarline{
+		{Location: "left", Ending: &xmlEnding{"2", "start"}},
+		{Location: "right", Style: "light-light", Ending: &xmlEnding{"2", "discontinue"}},
+	}, secondEnding.Barlines)
+
+	bridge := score.Measures[6]
+	assert.Equal(t, []string{"Bridge"}, bridge.Rehearsal)
+	assert.Equal(t, []int{2}, bridge.Fifths)
+	assert.Equal(t, []int{3}, bridge.Beats)
+	assert.Equal(t, []int{120}, bridge.Tempo)
+	assert.Equal(t, "yes", bridge.Sounds[1].Fine)
+	assert.Equal(t, 1440, bridge.Notes[0].Duration)
+	assert.Empty(t, score.Measures[7].Fifths)
+	assert.Empty(t, score.Measures[7].Beats)
+}
+
+func TestWriteNashville(t *testing.T) {
+	score := write(t, "---\nkey: Eb\n---\n1 4/6 | b7 |\n")
+	assert.Equal(t, []xmlHarmony{
+		{Root: "E", Alter: -1, Kind: xmlKind{Value: "major"}},
+		{Root: "A", Alter: -1, Kind: xmlKind{Value: "major"}, Bass: "C"},
+	}, score.Measures[0].Harmonies)
+
+	score = write(t, "2m7 | b7 |\n")
+	assert.Equal(t, []xmlHarmony{{Numeral: 2, Kind: xmlKind{"minor-seventh", "m7"}}}, score.Measures[0].Harmonies)
+	assert.Equal(t, []xmlHarmony{{Numeral: 7, Kind: xmlKind{Value: "major"}}}, score.Measures[1].Harmonies)
+}
+
+func TestWriteBackticks(t *testing.T) {
+	score := write(t, "---\nL: 1/8\n---\nC | `\"G7\"B2 d2 f4` | F |\n```\nK:D\nL:1/4\nF A d2 | =F4 |]\n```\n")
+	require.Len(t, score.Measures, 5)
+
+	abc := score.Measures[1]
+	assert.Equal(t, []xmlSlash{{Type: "stop"}}, abc.Slashes)
+	assert.Equal(t, []xmlHarmony{{Root: "G", Kind: xmlKind{"dominant", "7"}}}, abc.Harmonies)
+	assert.Equal(t, []xmlNote{
+		{Step: "B", Octave: 4, Duration: 480, Type: "quarter"},
+		{Step: "D", Octave: 5, Duration: 480, Type: "quarter"},
+		{Step: "F", Octave: 5, Duration: 960, Type: "half"},
+	}, abc.Notes)
+	assert.Equal(t, []xmlSlash{{Type: "start"}}, score.Measures[2].Slashes)
+
+	tune := score.Measures[3]
+	assert.Equal(t, "yes", tune.Print.NewSystem)
+	assert.Equal(t, []int{2}, tune.Fifths)
+	assert.Equal(t, []xmlSlash{{Type: "stop"}}, tune.Slashes)
+	assert.Equal(t, []xmlNote{
+		{Step: "F", Alter: 1, Octave: 4, Duration: 480, Type: "quarter"},
+		{Step: "A", Octave: 4, Duration: 480, Type: "quarter"},
+		{Step: "D", Octave: 5, Duration: 960, Type: "half"},
+	}, tune.Notes)
+	assert.Equal(t, []xmlNote{{Step: "F", Octave: 4, Duration: 1920, Type: "whole"}}, score.Measures[4].Notes)
+}
+
+func TestChordKind(t *testing.T) {
+	testCases := []struct {
+		chord   string
+		kind    string
+		degrees []degree
+	}{
+		{chord: "C", kind: "major"},
+		{chord: "Cm", kind: "minor"},
+		{chord: "C7", kind: "dominant"},
+		{chord: "C9", kind: "dominant-ninth"},
+		{chord: "C13", kind: "dominant-13th"},
+		{chord: "Cmaj7", kind: "major-seventh"},
+		{chord: "Cmaj9", kind: "major-ninth"},
+		{chord: "Cm7", kind: "minor-seventh"},
+		{chord: "Cm11", kind: "minor-11th"},
+		{chord: "Cm(maj7)", kind: "major-minor"},
+		{chord: "C6", kind: "major-sixth"},
+		{chord: "Cm6", kind: "minor-sixth"},
+		{chord: "C6/9", kind: "major-sixth", degrees: []degree{{Value: 9, Type: "add"}}},
+		{chord: "Cdim", kind: "diminished"},
+		{chord: "Cdim7", kind: "diminished-seventh"},
+		{chord: "Cø", kind: "half-diminished"},
+		{chord: "Caug", kind: "augmented"},
+		{chord: "C+7", kind: "augmented-seventh"},
+		{chord: "C5", kind: "power"},
+		{chord: "Csus4", kind: "suspended-fourth"},
+		{chord: "Csus2", kind: "suspended-second"},
+		{chord: "C7sus4", kind: "suspended-fourth", degrees: []degree{{Value: 7, Alter: -1, Type: "add"}}},
+		{chord: "Cadd9", kind: "major", degrees: []degree{{Value: 9, Type: "add"}}},
+		{chord: "Cm7b5", kind: "minor-seventh", degrees: []degree{{Value: 5, Alter: -1, Type: "alter"}}},
+		{chord: "C7#11", kind: "dominant", degrees: []degree{{Value: 11, Alter: 1, Type: "add"}}},
+		{chord: "C13b9", kind: "dominant-13th", degrees: []degree{{Value: 9, Alter: -1, Type: "alter"}}},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.chord, func(t *testing.T) {
+			h := harmonyOf(tC.chord, nil)
+			require.NotNil(t, h)
+			assert.Equal(t, tC.kind, h.Kind.Value)
+			assert.Equal(t, tC.degrees, h.Degrees)
+		})
+	}
+}
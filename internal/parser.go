@@ -5,7 +5,9 @@ import (
 	"lesheets/internal/domain"
 	"lesheets/internal/logger"
 	"os"
+	"regexp"
 	"strconv"
+	"strings"
 
 	"github.com/stretchr/testify/assert/yaml"
 )
@@ -16,16 +18,92 @@ type Parser struct {
 	mutilineBacktickId int
 	song               *domain.Song
 	barsCount          int
+	lastEnd            domain.Position
+	diagnostics        domain.Diagnostics
+	// sections parsed so far, the ones a section can reuse
+	sections []domain.Section
+	// meter, key and tempo are the ones of the next bar
+	meter domain.Meter
+	key   string
+	tempo int
+	// tokens consumed so far, they make the syntax tree of the song
+	tokens []domain.Token
 }
 
 func (p *Parser) SourceFile() string {
 	return p.Lexer.source
 }
 
+// next consumes the next token, remembering where it ends to compute the spans of the nodes.
+func (p *Parser) next() (*domain.Token, error) {
+	tok, err := p.Lexer.ConsumeNextToken()
+	if err != nil {
+		return nil, err
+	}
+	p.lastEnd = tok.Span.End
+	p.tokens = append(p.tokens, *tok)
+	return tok, nil
+}
+
+func (p *Parser) report(severity domain.Severity, code string, message string, span domain.Span) {
+	p.diagnostics = append(p.diagnostics, domain.Diagnostic{
+		Severity: severity,
+		Code:     code,
+		Message:  message,
+		Span:     span,
+	})
+}
+
+// reportError records an error found at the next token. Errors coming from the lexer are syntax
+// errors, the rest are tokens the parser didn't expect.
+func (p *Parser) reportError(err error) {
+	if err == p.Lexer.err {
+		p.report(domain.SeverityError, "syntax-error", err.Error(), p.Lexer.ErrorSpan())
+		return
+	}
+	span := domain.Span{Start: p.lastEnd, End: p.lastEnd}
+	if tok, lexErr := p.Lexer.Lookahead(); lexErr == nil {
+		span = tok.Span
+	}
+	p.report(domain.SeverityError, "unexpected-token", err.Error(), span)
+}
+
+// recoverFrom reports an error and skips the rest of the bar, or of the line, so that parsing can go
+// on from there.
+func (p *Parser) recoverFrom(err error) {
+	p.reportError(err)
+	tok, lexErr := p.Lexer.Lookahead()
+	if lexErr == nil {
+		switch tok.Type {
+		case domain.TokenReturn, domain.TokenEof, domain.TokenHeader, domain.TokenHeaderBreak:
+			return
+		}
+	}
+	p.Lexer.skipToBarBoundary()
+}
+
+// lookahead returns the next token, reporting and skipping any text the lexer can't read.
+func (p *Parser) lookahead() *domain.Token {
+	tok, err := p.Lexer.Lookahead()
+	for err != nil {
+		p.recoverFrom(err)
+		tok, err = p.Lexer.Lookahead()
+	}
+	return tok
+}
+
+func linesSpan(start domain.Position, lines []domain.Line) domain.Span {
+	if len(lines) == 0 {
+		return domain.Span{Start: start, End: start}
+	}
+	return domain.Span{Start: start, End: lines[len(lines)-1].Span.End}
+}
+
 func NewParser(lex *Lexer) *Parser {
 	return &Parser{
 		Lexer:      lex,
 		backtickId: 0,
+		meter:      domain.DefaultMeter,
 	}
 }
 
@@ -58,43 +136,53 @@ func ParseSongFromFile(file string) (*Parser, *domain.Song, error) {
 	return parser, res, err
 }
 
-var SURROUNDING_CONTEXT = 15
-
 // Song =
 //
 //	Frontmatter Body
 //	| Body
 //	;
+//
+// The parser recovers from the errors found in a bar or a line, so the song returned holds
+// everything that could be parsed, along with a domain.Diagnostics error listing all the problems.
 func (p *Parser) ParseSong() (*domain.Song, error) {
 	song := domain.Song{}
 	p.song = &song
+	p.diagnostics = nil
+	p.tokens = nil
+	p.sections = nil
 	p.Lexer.consumeWhitespacesAndNewLines()
 
-	tok, err := p.Lexer.Lookahead()
-	if err != nil {
-		return nil, err
-	}
-	switch tok.Type {
-	case domain.TokenFrontMatter:
+	tok := p.lookahead()
+	if tok.Type == domain.TokenFrontMatter {
 		fm, err := p.ParseFrontmatter()
 		if err != nil {
-			return nil, err
+			p.report(domain.SeverityError, "invalid-front-matter", "invalid frontmatter: "+err.Error(), tok.Span)
 		}
 		song.FrontMatter = fm
-		fallthrough
-	default:
-		body, err := p.ParseBody()
-		if err != nil {
-			return nil, err
-		}
-		song.Sections = body
-		return &song, nil
 	}
+	// An invalid time is reported by lint, the bars are in 4/4 meanwhile
+	p.meter, _ = song.Meter()
+	p.key = song.Key()
+	p.tempo, _ = song.Tempo()
+	body, err := p.ParseBody()
+	if err != nil {
+		p.reportError(err)
+	}
+	song.Sections = body
+	if len(p.tokens) == 0 || p.tokens[len(p.tokens)-1].Type != domain.TokenEof {
+		p.tokens = append(p.tokens, p.Lexer.EofToken())
+	}
+	song.Syntax = &domain.SyntaxTree{Tokens: p.tokens}
+	song.Comments = song.Syntax.Comments()
+	if len(p.diagnostics) > 0 {
+		return &song, p.diagnostics
+	}
+	return &song, nil
 }
 
 // FrontMatter: TokenFrontmatter
 func (p *Parser) ParseFrontmatter() (map[string]string, error) {
-	tok, err := p.Lexer.ConsumeNextToken()
+	tok, err := p.next()
 	if err != nil {
 		return nil, err
 	}
@@ -116,11 +204,8 @@ func (p *Parser) ParseFrontmatter() (map[string]string, error) {
 // |Sections
 // ;
 func (p *Parser) ParseBody() ([]domain.Section, error) {
-	tok, err := p.Lexer.Lookahead()
+	tok := p.lookahead()
 	sections := []domain.Section{}
-	if err != nil {
-		return sections, err
-	}
 	switch tok.Type {
 	case domain.TokenHeader, domain.TokenHeaderBreak:
 		sections, err := p.ParseSections()
@@ -139,6 +224,9 @@ func (p *Parser) ParseBody() ([]domain.Section, error) {
 			return nil, err
 		}
 		emptySection.Lines = lines
+		if len(lines) > 0 {
+			emptySection.Span = linesSpan(lines[0].Span.Start, lines)
+		}
 
 		rest, err := p.ParseSections()
 		if err != nil {
@@ -190,16 +278,26 @@ func (p *Parser) ParseSection() (*domain.Section, error) {
 			Lines: nil,
 			Break: tok.Type == domain.TokenHeaderBreak,
 		}
-		_, _ = p.Lexer.ConsumeNextToken()
+		_, _ = p.next()
+		p.parseHeadingChanges(&section, tok.Span)
+		meter, key, tempo := p.meter, p.key, p.tempo
 
 		lines, err := p.ParseLines()
 		if err != nil {
 			return nil, err
 		}
 		section.Lines = lines
+		section.Span = linesSpan(tok.Span.Start, lines)
+		if len(lines) == 0 {
+			section.Span.End = tok.Span.End
+		}
+		if section.Ref != "" {
+			p.resolveReference(&section, meter, key, tempo)
+		}
+		p.sections = append(p.sections, section)
 		return &section, nil
 	default:
-		return nil, errors.New("unexpected token while parsing section: " + string(tok.Type) + "at pos " + strconv.Itoa(p.Lexer.pos))
+		return nil, errors.New("unexpected token while parsing section: " + string(tok.Type))
 	}
 }
 
@@ -208,10 +306,7 @@ func (p *Parser) ParseSection() (*domain.Section, error) {
 // |Line Lines
 // ;
 func (p *Parser) ParseLines() ([]domain.Line, error) {
-	tok, err := p.Lexer.Lookahead()
-	if err != nil {
-		return nil, err
-	}
+	tok := p.lookahead()
 	lines := []domain.Line{}
 
 	for {
@@ -226,10 +321,7 @@ func (p *Parser) ParseLines() ([]domain.Line, error) {
 			if len(line.Bars) > 0 || line.MultilineBacktick.Value != "" {
 				lines = append(lines, *line)
 			}
-			tok, err = p.Lexer.Lookahead()
-			if err != nil {
-				return nil, err
-			}
+			tok = p.lookahead()
 		}
 	}
 }
@@ -237,16 +329,22 @@ func (p *Parser) ParseLines() ([]domain.Line, error) {
 // Line:
 // Bars TokenReturn
 // |Bar Bars
+//
+// A bar with errors is reported and left out of the line.
 func (p *Parser) ParseLine() (*domain.Line, error) {
 	bars := []domain.Bar{}
 
-	tok, err := p.Lexer.Lookahead()
-	if err != nil {
-		return nil, err
+	tok := p.lookahead()
+
+	if tok.Type == domain.TokenLyrics {
+		_, _ = p.next()
+		p.report(domain.SeverityError, "unexpected-token", "lyrics must be written under a line of bars", tok.Span)
+		p.consumeLineEnd()
+		return &domain.Line{}, nil
 	}
 
 	if tok.Type == domain.TokenBacktickMultiline {
-		_, _ = p.Lexer.ConsumeNextToken()
+		_, _ = p.next()
 		line := &domain.Line{
 			Bars: []domain.Bar{},
 			MultilineBacktick: domain.MultilineBacktick{
@@ -254,34 +352,106 @@ func (p *Parser) ParseLine() (*domain.Line, error) {
 				Value:         tok.Value,
 				DefaultLength: p.song.DefaultLength(),
 				SourceFile:    p.SourceFile(),
+				Span:          tok.Span,
 			},
+			Span: tok.Span,
 		}
 		p.mutilineBacktickId++
 		return line, nil
 	}
 
 	var prev *domain.Bar
-	for tok.Type != domain.TokenReturn && tok.Type != domain.TokenEof {
+	for !isLineEnd(tok) {
 		bar, err := p.ParseBar()
 		if err != nil {
-			return nil, err
+			p.recoverFrom(err)
+		} else {
+			bar.PreviousWasRepeatEnd = prev != nil && prev.RepeatEnd
+			bars = append(bars, *bar)
+			prev = bar
 		}
-		bar.PreviousWasRepeatEnd = prev != nil && prev.RepeatEnd
+		tok = p.lookahead()
+	}
+	p.consumeLineEnd()
+	continueEndings(bars)
+	line := &domain.Line{Bars: bars}
+	if len(bars) > 0 {
+		line.Span = domain.Span{Start: bars[0].Span.Start, End: bars[len(bars)-1].Span.End}
+		p.parseLyrics(line)
+	}
+	return line, nil
+}
 
-		bars = append(bars, *bar)
-		tok, err = p.Lexer.Lookahead()
-		if err != nil {
-			return nil, err
+// continueEndings puts the bars after the start of an ending in it, up to a repeat end, a double bar,
+// the start of another ending or the end of the line.
+func continueEndings(bars []domain.Bar) {
+	var ending *domain.Ending
+	for i := range bars {
+		bar := &bars[i]
+		if bar.EndingStart || bar.RepeatStart {
+			ending = bar.Ending
+		} else {
+			bar.Ending = ending
+		}
+		if bar.RepeatEnd || bar.DoubleBarEnd {
+			ending = nil
 		}
-		prev = bar
 	}
-	_, _ = p.Lexer.ConsumeNextToken()
-	return &domain.Line{Bars: bars}, nil
+}
+
+func (p *Parser) consumeLineEnd() {
+	tok := p.lookahead()
+	if tok.Type == domain.TokenReturn || tok.Type == domain.TokenEof {
+		_, _ = p.next()
+	}
+}
+
+// parseLyrics reads the lyric lines written under a line of bars. The fragments separated by "|" go
+// to the bars in order, the ones left over to the last bar. Every lyric line is a verse, the verses
+// of a bar are joined by new lines.
+func (p *Parser) parseLyrics(line *domain.Line) {
+	for p.lookahead().Type == domain.TokenLyrics {
+		tok, _ := p.next()
+		lyrics := domain.Lyrics{Fragments: []string{}, Span: tok.Span}
+		for _, fragment := range strings.Split(tok.Value, "|") {
+			lyrics.Fragments = append(lyrics.Fragments, strings.TrimSpace(fragment))
+		}
+		verses := len(line.Lyrics)
+		line.Lyrics = append(line.Lyrics, lyrics)
+		line.Span.End = tok.Span.End
+		p.consumeLineEnd()
+
+		for i := range line.Bars {
+			bar := &line.Bars[i]
+			fragment := ""
+			if i < len(lyrics.Fragments) {
+				fragment = lyrics.Fragments[i]
+			}
+			if i == len(line.Bars)-1 && len(lyrics.Fragments) > len(line.Bars) {
+				fragment = strings.Join(lyrics.Fragments[i:], " ")
+			}
+			if verses > 0 {
+				bar.Lyrics += "\n"
+			}
+			bar.Lyrics += fragment
+		}
+	}
+}
+
+// isLineEnd tells whether the token ends a line of bars. Headers can only be found there after a bar
+// note followed by a line break, which is an error.
+func isLineEnd(tok *domain.Token) bool {
+	switch tok.Type {
+	case domain.TokenReturn, domain.TokenEof, domain.TokenHeader, domain.TokenHeaderBreak:
+		return true
+	}
+	return false
 }
 
 // Bar
 // :TokenBarNote TokenBar BarBody
 // |TokenBar TokenBarNote BarBody
+// |TokenBar TokenEnding BarBody
 // |BarBody
 // ;
 //
@@ -293,22 +463,41 @@ func (p *Parser) ParseLine() (*domain.Line, error) {
 // :Chord
 // |Chord Chords
 func (p *Parser) ParseBar() (*domain.Bar, error) {
-	bar := domain.Bar{}
-	bar.Id = p.barsCount
-	p.barsCount++
+	// The id is taken once the bar is read, the bars dropped after an error leave no gap
+	bar := domain.Bar{Id: p.barsCount, Meter: p.meter, Key: p.key, Tempo: p.tempo}
+	first := len(p.tokens)
 
 	tok, err := p.Lexer.Lookahead()
 	if err != nil {
 		return nil, err
 	}
+	start := tok.Span.Start
 
-	for tok.Type == domain.TokenBar || tok.Type == domain.TokenBarNote {
+	for tok.Type == domain.TokenBar || tok.Type == domain.TokenBarNote || tok.Type == domain.TokenEnding || isBarMarker(tok) {
 		switch tok.Type {
+		case domain.TokenAnnotation, domain.TokenMeter:
+			tok, err = p.parseBarMarkers(&bar)
+			if err != nil {
+				return nil, err
+			}
+		case domain.TokenEnding:
+			ending, err := domain.ParseEnding(tok.Value)
+			if err != nil {
+				p.report(domain.SeverityError, "invalid-ending", err.Error(), tok.Span)
+			} else {
+				bar.Ending = ending
+				bar.EndingStart = true
+			}
+			_, _ = p.next()
+			tok, err = p.Lexer.Lookahead()
+			if err != nil {
+				return nil, err
+			}
 		case domain.TokenBar:
 			if tok.Value == "||:" {
 				bar.RepeatStart = true
 			}
-			_, _ = p.Lexer.ConsumeNextToken()
+			_, _ = p.next()
 			tok, err = p.Lexer.Lookahead()
 			if err != nil {
 				return nil, err
@@ -316,7 +505,7 @@ func (p *Parser) ParseBar() (*domain.Bar, error) {
 		case domain.TokenBarNote:
 			bar.BarNote = tok.Value
 			// consume it
-			_, _ = p.Lexer.ConsumeNextToken()
+			_, _ = p.next()
 			p.Lexer.consumeWhitespacesAndNewLines()
 			tok, err = p.Lexer.Lookahead()
 			if err != nil {
@@ -326,7 +515,7 @@ func (p *Parser) ParseBar() (*domain.Bar, error) {
 	}
 	// BarBody
 	if tok.Type != domain.TokenChord && tok.Type != domain.TokenAnnotation && tok.Type != domain.TokenBacktick {
-		return nil, errors.New("parsing bar: unexpected token. Want Chord, Annotation or Backtick, got " + string(tok.Type) + " " + p.Lexer.SurroundingString())
+		return nil, errors.New("parsing bar: unexpected token. Want Chord, Annotation or Backtick, got " + string(tok.Type))
 	}
 
 	switch tok.Type {
@@ -336,7 +525,7 @@ func (p *Parser) ParseBar() (*domain.Bar, error) {
 			return nil, err
 		}
 		bar.Backtick = *backtick
-		tok, err = p.Lexer.Lookahead()
+		tok, err = p.parseBarMarkers(&bar)
 		if err != nil {
 			return nil, err
 		}
@@ -347,15 +536,26 @@ func (p *Parser) ParseBar() (*domain.Bar, error) {
 			case "||":
 				bar.DoubleBarEnd = true
 			}
-			_, err = p.Lexer.ConsumeNextToken()
+			_, err = p.next()
 			if err != nil {
 				return nil, err
 			}
+			p.parseRepeatCount(&bar)
 		}
+		bar.Span = domain.Span{Start: start, End: p.lastEnd}
+		bar.Tokens = p.tokens[first:len(p.tokens):len(p.tokens)]
+		p.barsCount++
 		return &bar, nil
 	case domain.TokenAnnotation, domain.TokenChord:
 		chords := []domain.Chord{}
-		for tok.Type == domain.TokenChord || tok.Type == domain.TokenAnnotation {
+		for tok.Type == domain.TokenChord || tok.Type == domain.TokenAnnotation || tok.Type == domain.TokenMeter {
+			if isBarMarker(tok) {
+				tok, err = p.parseBarMarkers(&bar)
+				if err != nil {
+					return nil, err
+				}
+				continue
+			}
 			chord, err := p.ParseChord()
 			if err != nil {
 				return nil, err
@@ -367,9 +567,10 @@ func (p *Parser) ParseBar() (*domain.Bar, error) {
 			}
 		}
 		if len(chords) == 0 {
-			return nil, errors.New("found no chords in bar " + p.Lexer.SurroundingString())
+			return nil, errors.New("found no chords in bar")
 		}
 		bar.Chords = chords
+		bar.PlaceBeats()
 
 		if tok.Type == domain.TokenBar && tok.Value != "||:" {
 			switch tok.Value {
@@ -378,14 +579,167 @@ func (p *Parser) ParseBar() (*domain.Bar, error) {
 			case "||":
 				bar.DoubleBarEnd = true
 			}
-			_, err = p.Lexer.ConsumeNextToken()
+			_, err = p.next()
 			if err != nil {
 				return nil, err
 			}
+			p.parseRepeatCount(&bar)
 		}
+		bar.Span = domain.Span{Start: start, End: p.lastEnd}
+		bar.Tokens = p.tokens[first:len(p.tokens):len(p.tokens)]
+		p.barsCount++
 		return &bar, nil
 	default:
-		return nil, errors.New("expected chord or backtick expression but found " + string(tok.Type) + " " + p.Lexer.SurroundingString())
+		return nil, errors.New("expected chord or backtick expression but found " + string(tok.Type))
+	}
+}
+
+// parseRepeatCount reads the count written after a repeat end, like x3 or 3x.
+func (p *Parser) parseRepeatCount(bar *domain.Bar) {
+	tok := p.lookahead()
+	if tok.Type != domain.TokenRepeatCount {
+		return
+	}
+	_, _ = p.next()
+	// The count is made of digits, it can only fail to be read when it's too big
+	count, err := strconv.Atoi(tok.Value)
+	switch {
+	case err == nil && count < 2:
+		p.report(domain.SeverityError, "invalid-repeat-count", "invalid repeat count \""+tok.Text+"\": a repeat is played at least twice", tok.Span)
+	case err != nil || count > domain.MaxPass:
+		p.report(domain.SeverityError, "invalid-repeat-count", "invalid repeat count \""+tok.Text+"\": a repeat is played at most "+
+			strconv.Itoa(domain.MaxPass)+" times", tok.Span)
+	default:
+		bar.RepeatCount = count
+	}
+}
+
+// isBarMarker tells whether the token marks its bar instead of a chord: a navigation marker, a meter
+// change, (3/4) or !meter=3/4!, a key change, !key=D!, or a tempo change, !tempo=90!.
+func isBarMarker(tok *domain.Token) bool {
+	switch tok.Type {
+	case domain.TokenMeter:
+		return true
+	case domain.TokenAnnotation:
+		name, _, _ := strings.Cut(tok.Value, "=")
+		return domain.IsNavigation(tok.Value) || name == "meter" || name == "key" || name == "tempo"
+	}
+	return false
+}
+
+// parseBarMarkers adds the navigation markers and the changes found next to the bar, and returns
+// the token after them.
+func (p *Parser) parseBarMarkers(bar *domain.Bar) (*domain.Token, error) {
+	tok, err := p.Lexer.Lookahead()
+	for err == nil && isBarMarker(tok) {
+		name, value, _ := strings.Cut(tok.Value, "=")
+		switch {
+		case tok.Type == domain.TokenMeter || name == "meter":
+			if tok.Type == domain.TokenMeter {
+				value = tok.Value
+			}
+			m, err := domain.ParseMeter(value)
+			if err != nil {
+				p.report(domain.SeverityError, "invalid-meter", err.Error(), tok.Span)
+			} else {
+				p.meter = m
+				bar.Meter = m
+				bar.MeterChange = true
+			}
+		case name == "key":
+			if key, ok := p.keyChange(value, tok.Span); ok {
+				bar.Key = key
+				bar.KeyChange = true
+			}
+		case name == "tempo":
+			if tempo, ok := p.tempoChange(value, tok.Span); ok {
+				bar.Tempo = tempo
+				bar.TempoChange = true
+			}
+		default:
+			bar.Navigation = append(bar.Navigation, domain.Navigation(tok.Value))
+		}
+		_, _ = p.next()
+		tok, err = p.Lexer.Lookahead()
+	}
+	return tok, err
+}
+
+// keyChange checks the key of a !key=..! directive and makes it the key of the bars after it.
+func (p *Parser) keyChange(value string, span domain.Span) (string, bool) {
+	value = strings.TrimSpace(value)
+	if _, err := domain.ParseKey(value); err != nil {
+		p.report(domain.SeverityError, "invalid-key", err.Error(), span)
+		return "", false
+	}
+	p.key = value
+	return value, true
+}
+
+// tempoChange checks the tempo of a !tempo=..! directive and makes it the tempo of the bars after it.
+func (p *Parser) tempoChange(value string, span domain.Span) (int, bool) {
+	tempo, err := domain.ParseTempo(value)
+	if err != nil {
+		p.report(domain.SeverityError, "invalid-tempo", err.Error(), span)
+		return 0, false
+	}
+	p.tempo = tempo
+	return tempo, true
+}
+
+var headingChange = regexp.MustCompile(`!(key|tempo)=([^!]*)!`)
+
+// parseHeadingChanges takes the key and tempo changes out of the name of a section, "# Bridge !key=D!",
+// and the name of the section it reuses, "# Chorus 2 = Chorus". The part after the "=" is only a
+// reference when it names a section before this one, "# Intro (drums = 4 bars)" is kept as it is.
+func (p *Parser) parseHeadingChanges(section *domain.Section, span domain.Span) {
+	for _, m := range headingChange.FindAllStringSubmatch(section.Name, -1) {
+		if m[1] == "key" {
+			section.Key, _ = p.keyChange(m[2], span)
+		} else {
+			section.Tempo, _ = p.tempoChange(m[2], span)
+		}
+	}
+	section.Name = strings.TrimSpace(headingChange.ReplaceAllString(section.Name, ""))
+	if name, ref, ok := strings.Cut(section.Name, "="); ok && p.sectionIndex(strings.TrimSpace(ref)) >= 0 {
+		section.Name = strings.TrimSpace(name)
+		section.Ref = strings.TrimSpace(ref)
+		if section.Name == "" {
+			section.Name = section.Ref
+		}
+	}
+}
+
+// sectionIndex returns the index of the last section parsed with the given name, compared without
+// case, or -1 when there is none.
+func (p *Parser) sectionIndex(name string) int {
+	i := len(p.sections) - 1
+	for i >= 0 && !strings.EqualFold(p.sections[i].Name, name) {
+		i--
+	}
+	return i
+}
+
+// resolveReference fills a section reusing another one with a copy of the lines of the last section
+// of that name before it, see domain.ReuseLines and Section.ChainReused. The copy is moved to the key
+// of the section when it sets one, and it's marked as a change when it's not played in the meter, key
+// and tempo given, the ones in effect at the header.
+func (p *Parser) resolveReference(section *domain.Section, meter domain.Meter, key string, tempo int) {
+	i := p.sectionIndex(section.Ref)
+	firstId := p.barsCount
+	for _, line := range section.Lines {
+		for _, bar := range line.Bars {
+			firstId = min(firstId, bar.Id)
+		}
+	}
+	section.Lines = domain.ReuseLines(p.sections[i].Lines, section.Lines)
+	if section.Key != "" {
+		section.TransposeReused(section.Key)
+	}
+	var last *domain.Bar
+	p.barsCount, last = section.ChainReused(firstId, meter, key, tempo)
+	if last != nil {
+		p.meter, p.key, p.tempo = last.Meter, last.Key, last.Tempo
 	}
 }
 
@@ -403,10 +757,11 @@ func (p *Parser) ParseBacktick() (*domain.Backtick, error) {
 		Id:            p.backtickId,
 		Value:         "",
 		DefaultLength: p.song.DefaultLength(),
+		Span:          tok.Span,
 	}
 	p.backtickId++
 	bt.Value = tok.Value
-	_, _ = p.Lexer.ConsumeNextToken()
+	_, _ = p.next()
 
 	return &bt, nil
 }
@@ -422,10 +777,11 @@ func (p *Parser) ParseChord() (*domain.Chord, error) {
 	chord := domain.Chord{
 		Value:      "",
 		Annotation: &domain.Annotation{},
+		Span:       tok.Span,
 	}
 	if tok.Type == domain.TokenAnnotation {
 		chord.Annotation.Value = tok.Value
-		_, _ = p.Lexer.ConsumeNextToken()
+		_, _ = p.next()
 		tok, err = p.Lexer.Lookahead()
 		if err != nil {
 			return nil, err
@@ -433,14 +789,15 @@ func (p *Parser) ParseChord() (*domain.Chord, error) {
 	}
 
 	if tok.Type != domain.TokenChord {
-		return nil, errors.New("expected chord but found " + string(tok.Type) + ", " + p.Lexer.SurroundingString())
+		return nil, errors.New("expected chord but found " + string(tok.Type))
 	}
 	chord.Value = tok.Value
 
 	if chord.Value == "" {
-		return nil, errors.New("empty chord found at " + p.Lexer.SurroundingString())
+		return nil, errors.New("empty chord found")
 	}
 
-	_, _ = p.Lexer.ConsumeNextToken()
+	_, _ = p.next()
+	chord.Span.End = tok.Span.End
 	return &chord, nil
 }
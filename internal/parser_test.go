@@ -1,9 +1,11 @@
 package internal
 
 import (
+	"lesheets/internal/domain"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestFrontmatter(t *testing.T) {
@@ -127,7 +129,72 @@ D|E
 	assert.True(t, sections[2].Break)
 }
 
-func TestErrorPrintsContext(t *testing.T) {
+func TestSectionReference(t *testing.T) {
+	song, err := ParseSongFromString("---\nkey: C\n---\n# Chorus\nC | F\nG | C\n# Bridge !key=D!\nD\n# Chorus 2 = chorus\nG7\n# Last = Chorus !key=D!\n")
+	require.NoError(t, err)
+	chords := func(section domain.Section) []string {
+		res := []string{}
+		for _, line := range section.Lines {
+			for _, bar := range line.Bars {
+				res = append(res, bar.Chords[0].Value)
+			}
+		}
+		return res
+	}
+	chorus2 := song.Sections[3]
+	assert.Equal(t, "Chorus 2", chorus2.Name)
+	assert.Equal(t, "chorus", chorus2.Ref)
+	assert.Equal(t, []string{"C", "F", "G", "G7"}, chords(chorus2))
+	require.Len(t, chorus2.Lines, 2)
+	assert.True(t, chorus2.Lines[0].Reused)
+	assert.False(t, chorus2.Lines[1].Reused)
+	assert.Equal(t, []bool{true, false}, []bool{chorus2.Lines[1].Bars[0].Reused, chorus2.Lines[1].Bars[1].Reused})
+	assert.True(t, chorus2.Lines[0].Bars[0].KeyChange)
+	assert.Equal(t, "C", chorus2.Lines[1].Bars[1].Key)
+	assert.Equal(t, []int{5, 6, 7, 8}, []int{chorus2.Lines[0].Bars[0].Id, chorus2.Lines[0].Bars[1].Id, chorus2.Lines[1].Bars[0].Id, chorus2.Lines[1].Bars[1].Id})
+	assert.Equal(t, []string{"G7"}, chords(domain.Section{Lines: chorus2.WrittenLines()}))
+
+	last := song.Sections[4]
+	assert.Equal(t, []string{"D", "G", "A", "D"}, chords(last))
+	assert.False(t, last.Lines[0].Bars[0].KeyChange)
+	assert.Equal(t, []string{"C", "F", "G", "C"}, chords(song.Sections[1]))
+}
+
+func TestCompactSectionReference(t *testing.T) {
+	song, err := ParseSongFromString("---\nreferences: compact\n---\n# A\nC | F\n# B = A\nG7\n")
+	require.NoError(t, err)
+	assert.Len(t, song.Sections[2].Lines[0].Bars, 2)
+	view := song.JsonView()
+	require.Len(t, view.Sections[2].Lines, 1)
+	assert.Len(t, view.Sections[2].Lines[0].Bars, 1)
+	assert.Len(t, view.Sections[1].Lines[0].Bars, 2)
+	assert.Len(t, song.Sections[2].Lines[0].Bars, 2)
+}
+
+func TestHeadingWithEqualSign(t *testing.T) {
+	testCases := []struct {
+		source string
+		name   string
+	}{
+		{source: "# Verse = Chorus\nC\n", name: "Verse = Chorus"},
+		{source: "# Intro (drums = 4 bars)\nC\n", name: "Intro (drums = 4 bars)"},
+		{source: "# Intro\nD\n# Intro (drums = 4 bars) !key=D!\nC\n", name: "Intro (drums = 4 bars)"},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.source, func(t *testing.T) {
+			song, err := ParseSongFromString(tC.source)
+			require.NoError(t, err)
+			section := song.Sections[len(song.Sections)-1]
+			assert.Equal(t, tC.name, section.Name)
+			assert.Equal(t, "", section.Ref)
+			require.Len(t, section.Lines, 1)
+			assert.Equal(t, []string{"C"}, []string{section.Lines[0].Bars[0].Chords[0].Value})
+			assert.False(t, section.Lines[0].Reused)
+		})
+	}
+}
+
+func TestErrorMessageHoldsOnOneLine(t *testing.T) {
 	p := NewParser(NewLexer(`
 ---
 some: value
@@ -137,10 +204,10 @@ another: value
 
 !a!!The second exclamation should be an error`))
 	_, err := p.ParseSong()
-	assert.Equal(t, err.Error(), `unexpected string at pos 55 line 7 near:
-ction1\n\n!a!!The second exclama
-                 ^
-Want: <!> Got: < >`)
+	var diagnostics domain.Diagnostics
+	require.ErrorAs(t, err, &diagnostics)
+	assert.Equal(t, "unexpected string, want <!> got < >", diagnostics[0].Message)
+	assert.Equal(t, "8:4", diagnostics[0].Span.Start.String())
 }
 
 func TestParseBar(t *testing.T) {
@@ -343,6 +410,278 @@ func TestParseLines(t *testing.T) {
 	}
 }
 
+func TestParseLyrics(t *testing.T) {
+	song, err := ParseSongFromString("C | Am | F\n> Hello | my dear\n> Bye | | my | friend\nG\n")
+	require.NoError(t, err)
+	lines := song.Sections[0].Lines
+	require.Len(t, lines, 2)
+	assert.Equal(t, []string{"Hello\nBye", "my dear\n", "\nmy friend"}, []string{
+		lines[0].Bars[0].Lyrics, lines[0].Bars[1].Lyrics, lines[0].Bars[2].Lyrics,
+	})
+	require.Len(t, lines[0].Lyrics, 2)
+	assert.Equal(t, []string{"Bye", "", "my", "friend"}, lines[0].Lyrics[1].Fragments)
+	assert.Equal(t, 2, lines[0].Span.End.Line)
+	assert.Empty(t, lines[1].Lyrics)
+}
+
+func TestParseLyricsWithoutBars(t *testing.T) {
+	_, err := ParseSongFromString("# A\n> Hello\nC\n")
+	diagnostics, ok := err.(domain.Diagnostics)
+	require.True(t, ok)
+	require.Len(t, diagnostics, 1)
+	assert.Equal(t, "lyrics must be written under a line of bars", diagnostics[0].Message)
+}
+
+func TestParseEndings(t *testing.T) {
+	song, err := ParseSongFromString("||: A |[1 B | C :||[2,3 D | E ||\nF\n")
+	require.NoError(t, err)
+	bars := song.Bars()
+	endings := []string{}
+	for _, bar := range bars {
+		label := "-"
+		if bar.Ending != nil {
+			label = bar.Ending.Label
+		}
+		endings = append(endings, label)
+	}
+	assert.Equal(t, []string{"-", "1", "1", "2,3", "2,3", "-"}, endings)
+	assert.True(t, bars[1].EndingStart)
+	assert.False(t, bars[2].EndingStart)
+	assert.Equal(t, []domain.PassRange{{First: 2, Last: 2}, {First: 3, Last: 3}}, bars[3].Ending.Passes)
+}
+
+func TestParseEndingRanges(t *testing.T) {
+	song, err := ParseSongFromString("||: A |[1-3,5 B :||[4,6-99 C ||\n")
+	require.NoError(t, err)
+	bars := song.Sections[0].Lines[0].Bars
+	first, second := bars[1].Ending, bars[2].Ending
+	assert.Equal(t, []domain.PassRange{{First: 1, Last: 3}, {First: 5, Last: 5}}, first.Passes)
+	assert.True(t, first.Plays(2))
+	assert.False(t, first.Plays(4))
+	assert.True(t, first.Plays(5))
+	assert.Equal(t, 5, first.LastPass())
+	assert.True(t, second.Plays(50))
+	assert.Equal(t, 99, second.LastPass())
+}
+
+func TestParseInvalidEnding(t *testing.T) {
+	testCases := []struct {
+		source string
+		err    string
+	}{
+		{source: "A |[3-1 B\n", err: "expected pass numbers"},
+		{source: "A |[100 B\n", err: "at most 99 times"},
+		{source: "| A |[1-50000000 B |\n", err: "at most 99 times"},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.source, func(t *testing.T) {
+			_, err := ParseSongFromString(tC.source)
+			diagnostics, ok := err.(domain.Diagnostics)
+			require.True(t, ok)
+			require.Len(t, diagnostics, 1)
+			assert.Equal(t, "invalid-ending", diagnostics[0].Code)
+			assert.Contains(t, diagnostics[0].Message, tC.err)
+		})
+	}
+}
+
+func TestParseNavigation(t *testing.T) {
+	song, err := ParseSongFromString("!segno! C | !push!D !tocoda! | `CDEF` !D.S.alcoda! |\n")
+	require.NoError(t, err)
+	bars := song.Bars()
+	assert.Equal(t, []domain.Navigation{domain.Segno}, bars[0].Navigation)
+	assert.Equal(t, []domain.Navigation{domain.ToCoda}, bars[1].Navigation)
+	assert.Equal(t, "push", bars[1].Chords[0].Annotation.Value)
+	assert.Len(t, bars[1].Chords, 1)
+	assert.Equal(t, domain.DalSegnoAlCoda, bars[2].Jump())
+}
+
+func TestParseRepeatCount(t *testing.T) {
+	testCases := []struct {
+		input string
+		count int
+	}{
+		{input: "||: A :||\n", count: 0},
+		{input: "||: A :||x3\n", count: 3},
+		{input: "||: A :|| 3x | B\n", count: 3},
+		{input: "||: `CDEF` :||X12\n", count: 12},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.input, func(t *testing.T) {
+			song, err := ParseSongFromString(tC.input)
+			require.NoError(t, err)
+			bar := song.Bars()[0]
+			assert.True(t, bar.RepeatEnd)
+			assert.Equal(t, tC.count, bar.RepeatCount)
+		})
+	}
+}
+
+func TestParseInvalidRepeatCount(t *testing.T) {
+	testCases := []struct {
+		source   string
+		expected string
+	}{
+		{source: "||: A :||x1\n", expected: "invalid repeat count \"x1\": a repeat is played at least twice"},
+		{source: "||: A :||x100\n", expected: "invalid repeat count \"x100\": a repeat is played at most 99 times"},
+		{source: "||: A :||x5000000\n", expected: "invalid repeat count \"x5000000\": a repeat is played at most 99 times"},
+		{
+			source:   "||: A :||x99999999999999999999\n",
+			expected: "invalid repeat count \"x99999999999999999999\": a repeat is played at most 99 times",
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.source, func(t *testing.T) {
+			song, err := ParseSongFromString(tC.source)
+			diagnostics, ok := err.(domain.Diagnostics)
+			require.True(t, ok)
+			require.Len(t, diagnostics, 1)
+			assert.Equal(t, "invalid-repeat-count", diagnostics[0].Code)
+			assert.Equal(t, tC.expected, diagnostics[0].Message)
+			assert.Equal(t, 0, song.Bars()[0].RepeatCount)
+		})
+	}
+}
+
+func TestParseMeter(t *testing.T) {
+	song, err := ParseSongFromString("---\ntime: 6/8\n---\nA | (3/4) B | C\n!meter=7/8! D | E\n")
+	require.NoError(t, err)
+	meters, changes := []string{}, []bool{}
+	for _, bar := range song.Bars() {
+		meters = append(meters, bar.Meter.String())
+		changes = append(changes, bar.MeterChange)
+	}
+	assert.Equal(t, []string{"6/8", "3/4", "3/4", "7/8", "7/8"}, meters)
+	assert.Equal(t, []bool{false, true, false, true, false}, changes)
+	assert.Equal(t, "B", song.Bars()[1].Chords[0].Value)
+}
+
+func TestParseMeterDefault(t *testing.T) {
+	song, err := ParseSongFromString("A | B\n")
+	require.NoError(t, err)
+	assert.Equal(t, domain.DefaultMeter, song.Bars()[1].Meter)
+}
+
+func TestParseInvalidMeter(t *testing.T) {
+	testCases := []struct {
+		meter    string
+		expected string
+	}{
+		{meter: "3/5", expected: "invalid meter \"3/5\": expected beats/unit like 4/4, 3/4 or 7/8"},
+		{meter: "256/4", expected: "invalid meter \"256/4\": a bar has at most 255 beats and the unit is at most 64"},
+		{meter: "900000000/4", expected: "invalid meter \"900000000/4\": a bar has at most 255 beats and the unit is at most 64"},
+		{meter: "4/128", expected: "invalid meter \"4/128\": a bar has at most 255 beats and the unit is at most 64"},
+		{meter: "4/4096", expected: "invalid meter \"4/4096\": a bar has at most 255 beats and the unit is at most 64"},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.meter, func(t *testing.T) {
+			song, err := ParseSongFromString("A | !meter=" + tC.meter + "! B\n")
+			diagnostics, ok := err.(domain.Diagnostics)
+			require.True(t, ok)
+			require.Len(t, diagnostics, 1)
+			assert.Equal(t, "invalid-meter", diagnostics[0].Code)
+			assert.Equal(t, tC.expected, diagnostics[0].Message)
+			assert.Equal(t, domain.DefaultMeter, song.Bars()[1].Meter)
+		})
+	}
+}
+
+func TestParseMeterBounds(t *testing.T) {
+	song, err := ParseSongFromString("---\ntime: 255/64\n---\nA\n")
+	require.NoError(t, err)
+	assert.Equal(t, domain.Meter{Beats: 255, Unit: 64}, song.Bars()[0].Meter)
+
+	song, err = ParseSongFromString("---\ntime: 900000000/4\n---\nA\n")
+	require.NoError(t, err)
+	assert.Equal(t, domain.DefaultMeter, song.Bars()[0].Meter)
+	_, err = song.Meter()
+	assert.Error(t, err)
+}
+
+func TestParseKeyAndTempoChanges(t *testing.T) {
+	song, err := ParseSongFromString("---\nkey: C\ntempo: 120\n---\n# A\nC | !key=D! D\n# B !key=Eb! !tempo=90!\nEb | !tempo=100bpm! Ab\n")
+	require.NoError(t, err)
+	keys, tempos, changes := []string{}, []int{}, []bool{}
+	for _, bar := range song.Bars() {
+		keys = append(keys, bar.Key)
+		tempos = append(tempos, bar.Tempo)
+		changes = append(changes, bar.KeyChange || bar.TempoChange)
+	}
+	assert.Equal(t, []string{"C", "D", "Eb", "Eb"}, keys)
+	assert.Equal(t, []int{120, 120, 90, 100}, tempos)
+	assert.Equal(t, []bool{false, true, false, true}, changes)
+	assert.Equal(t, "B", song.Sections[2].Name)
+	assert.Equal(t, "Eb", song.Sections[2].Key)
+	assert.Equal(t, 90, song.Sections[2].Tempo)
+	assert.Equal(t, "D", song.Bars()[1].Chords[0].Value)
+}
+
+func TestParseInvalidKeyAndTempoChanges(t *testing.T) {
+	_, err := ParseSongFromString("# A !tempo=fast!\nC | !key=H! D\n")
+	diagnostics, ok := err.(domain.Diagnostics)
+	require.True(t, ok)
+	require.Len(t, diagnostics, 2)
+	assert.Equal(t, "invalid-tempo", diagnostics[0].Code)
+	assert.Equal(t, "invalid-key", diagnostics[1].Code)
+}
+
+func TestParseTempoBounds(t *testing.T) {
+	testCases := []struct {
+		tempo    string
+		expected string
+	}{
+		{tempo: "0", expected: "invalid tempo \"0\": a tempo is between 4 and 999 beats per minute"},
+		{tempo: "3", expected: "invalid tempo \"3\": a tempo is between 4 and 999 beats per minute"},
+		{tempo: "1000bpm", expected: "invalid tempo \"1000bpm\": a tempo is between 4 and 999 beats per minute"},
+		{tempo: "100000000", expected: "invalid tempo \"100000000\": a tempo is between 4 and 999 beats per minute"},
+		{tempo: "99999999999999999999", expected: "invalid tempo \"99999999999999999999\": a tempo is between 4 and 999 beats per minute"},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.tempo, func(t *testing.T) {
+			song, err := ParseSongFromString("---\ntempo: 90\n---\nA | !tempo=" + tC.tempo + "! B\n")
+			diagnostics, ok := err.(domain.Diagnostics)
+			require.True(t, ok)
+			require.Len(t, diagnostics, 1)
+			assert.Equal(t, "invalid-tempo", diagnostics[0].Code)
+			assert.Equal(t, tC.expected, diagnostics[0].Message)
+			assert.Equal(t, 90, song.Bars()[1].Tempo)
+		})
+	}
+
+	song, err := ParseSongFromString("---\ntempo: 4\n---\nA | !tempo=999! B\n")
+	require.NoError(t, err)
+	assert.Equal(t, []int{4, 999}, []int{song.Bars()[0].Tempo, song.Bars()[1].Tempo})
+}
+
+func TestParseBeats(t *testing.T) {
+	testCases := []struct {
+		input     string
+		beats     []float64
+		durations []float64
+	}{
+		{input: "C\n", beats: []float64{0}, durations: []float64{4}},
+		{input: "C F\n", beats: []float64{0, 2}, durations: []float64{2, 2}},
+		{input: "C . . F\n", beats: []float64{0, 1, 2, 3}, durations: []float64{3, 0, 0, 1}},
+		{input: ". !pull!Cm . .\n", beats: []float64{0, 1, 2, 3}, durations: []float64{0, 3, 0, 0}},
+		{input: "C / / .\n", beats: []float64{0, 1, 2, 3}, durations: []float64{1, 1, 2, 0}},
+		{input: "(3/4) C . F\n", beats: []float64{0, 1, 2}, durations: []float64{2, 0, 1}},
+		{input: "(6/8) C F\n", beats: []float64{0, 3}, durations: []float64{3, 3}},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.input, func(t *testing.T) {
+			song, err := ParseSongFromString(tC.input)
+			require.NoError(t, err)
+			beats, durations := []float64{}, []float64{}
+			for _, chord := range song.Bars()[0].Chords {
+				beats = append(beats, chord.Beat)
+				durations = append(durations, chord.Duration)
+			}
+			assert.Equal(t, tC.beats, beats)
+			assert.Equal(t, tC.durations, durations)
+		})
+	}
+}
+
 func TestParseBarWithNote(t *testing.T) {
 	p := NewParser(NewLexer("\"any bar note\"Cmaj7 | \"another note\"D\nC"))
 	barsP, err := p.ParseLine()
@@ -388,3 +727,97 @@ func TestParseRepeatEnd(t *testing.T) {
 	_, err := lex.ParseSong()
 	assert.NoError(t, err)
 }
+
+func TestSpans(t *testing.T) {
+	song, err := ParseSongFromString("# Verse\n\"note\" A | !push!Bm7 C `z4` :||\n# Chorus\n")
+	assert.NoError(t, err)
+	pos := func(line, column int) domain.Position {
+		offset := column
+		if line == 1 {
+			offset += 8
+		} else if line > 1 {
+			offset += 40 + 9*(line-2)
+		}
+		return domain.Position{Offset: offset, Line: line, Column: column}
+	}
+
+	verse := song.Sections[0]
+	assert.Equal(t, domain.Span{Start: pos(0, 0), End: pos(1, 31)}, verse.Span)
+	assert.Equal(t, domain.Span{Start: pos(1, 0), End: pos(1, 31)}, verse.Lines[0].Span)
+
+	bars := verse.Lines[0].Bars
+	assert.Equal(t, domain.Span{Start: pos(1, 0), End: pos(1, 10)}, bars[0].Span)
+	assert.Equal(t, domain.Span{Start: pos(1, 7), End: pos(1, 8)}, bars[0].Chords[0].Span)
+	assert.Equal(t, domain.Span{Start: pos(1, 11), End: pos(1, 22)}, bars[1].Span)
+	assert.Equal(t, domain.Span{Start: pos(1, 11), End: pos(1, 20)}, bars[1].Chords[0].Span)
+	assert.Equal(t, domain.Span{Start: pos(1, 21), End: pos(1, 22)}, bars[1].Chords[1].Span)
+	assert.Equal(t, domain.Span{Start: pos(1, 23), End: pos(1, 31)}, bars[2].Span)
+	assert.Equal(t, domain.Span{Start: pos(1, 23), End: pos(1, 27)}, bars[2].Backtick.Span)
+
+	chorus := song.Sections[1]
+	assert.Equal(t, domain.Span{Start: pos(2, 0), End: pos(3, 0)}, chorus.Span)
+}
+
+func TestParserRecoversFromErrors(t *testing.T) {
+	song, err := ParseSongFromString(`# Verse
+A | !push B | C :
+D | "unclosed note
+# Chorus
+E | F
+`)
+	var diagnostics domain.Diagnostics
+	assert.ErrorAs(t, err, &diagnostics)
+	assert.Equal(t, 3, len(diagnostics))
+	for _, d := range diagnostics {
+		assert.Equal(t, domain.SeverityError, d.Severity)
+		assert.Equal(t, "syntax-error", d.Code)
+		assert.NotContains(t, d.Message, "\n")
+	}
+	assert.Equal(t, domain.Position{Offset: 12, Line: 1, Column: 4}, diagnostics[0].Span.Start)
+	assert.Equal(t, domain.Position{Offset: 24, Line: 1, Column: 16}, diagnostics[1].Span.Start)
+	assert.Equal(t, domain.Position{Offset: 30, Line: 2, Column: 4}, diagnostics[2].Span.Start)
+
+	// The bars without errors are still there
+	assert.Equal(t, 2, len(song.Sections))
+	verse := song.Sections[0]
+	assert.Equal(t, 2, len(verse.Lines))
+	assert.Equal(t, 1, len(verse.Lines[0].Bars))
+	assert.Equal(t, "A", verse.Lines[0].Bars[0].Chords[0].Value)
+	assert.Equal(t, 1, len(verse.Lines[1].Bars))
+	assert.Equal(t, "D", verse.Lines[1].Bars[0].Chords[0].Value)
+	assert.Equal(t, "Chorus", song.Sections[1].Name)
+	assert.Equal(t, "F", song.Sections[1].Lines[0].Bars[1].Chords[0].Value)
+
+	// Only the bars kept are numbered
+	ids := []int{}
+	for _, bar := range song.Bars() {
+		ids = append(ids, bar.Id)
+	}
+	assert.Equal(t, []int{0, 1, 2, 3}, ids)
+}
+
+func TestParserReportsUnexpectedTokens(t *testing.T) {
+	song, err := ParseSongFromString("A | \"note\"\n# Chorus\nB")
+	var diagnostics domain.Diagnostics
+	assert.ErrorAs(t, err, &diagnostics)
+	assert.Equal(t, 1, len(diagnostics))
+	assert.Equal(t, "unexpected-token", diagnostics[0].Code)
+	assert.Equal(t, domain.Position{Offset: 11, Line: 1, Column: 0}, diagnostics[0].Span.Start)
+	assert.Equal(t, "Chorus", song.Sections[1].Name)
+	assert.Equal(t, "B", song.Sections[1].Lines[0].Bars[0].Chords[0].Value)
+}
+
+func TestParserReportsInvalidFrontmatter(t *testing.T) {
+	song, err := ParseSongFromString("---\ntitle: [unclosed\n---\nA | B\n")
+	var diagnostics domain.Diagnostics
+	assert.ErrorAs(t, err, &diagnostics)
+	assert.Equal(t, "invalid-front-matter", diagnostics[0].Code)
+	assert.Equal(t, "B", song.Sections[0].Lines[0].Bars[1].Chords[0].Value)
+}
+
+func TestRenderErrorShowsAllDiagnostics(t *testing.T) {
+	_, err := ParseSongFromString("A | !x\nB | :")
+	assert.Equal(t, "<pre>1:5: unexpected string, want &lt;!&gt; got &lt;\\n&gt;\n"+
+		"2:5: unexpected string, want &lt;:||&gt; got &lt;EndOfFile&gt;\n</pre>",
+		string(RenderError(err)))
+}
@@ -0,0 +1,87 @@
+package internal
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func playbackOrder(t *testing.T, input string) string {
+	song, err := ParseSongFromString(input)
+	require.NoError(t, err)
+	chords := []string{}
+	for _, bar := range song.PlaybackOrder() {
+		chords = append(chords, bar.Chords[0].Value)
+	}
+	return strings.Join(chords, " ")
+}
+
+func TestPlaybackOrder(t *testing.T) {
+	testCases := []struct {
+		desc     string
+		input    string
+		expected string
+	}{
+		{desc: "no repeats", input: "A | B\nC\n", expected: "A B C"},
+		{desc: "repeat", input: "A ||: B | C :|| D\n", expected: "A B C B C D"},
+		{desc: "repeat from the start", input: "A | B :|| C\n", expected: "A B A B C"},
+		{desc: "repeat across sections", input: "# A\n||: A | B\n# B\nC :||\n", expected: "A B C A B C"},
+		{desc: "two endings", input: "||: A |[1 B :||[2 C ||\nD\n", expected: "A B A C D"},
+		{desc: "endings of several bars", input: "||: A |[1 B | C :||[2 D | E ||\nF\n", expected: "A B C A D E F"},
+		{desc: "three endings", input: "||: A |[1 B :||[2 C :||[3 D ||\n", expected: "A B A C A D"},
+		{desc: "ending played on two passes", input: "||: A |[1,2 B :||[3 C ||\n", expected: "A B A B A C"},
+		{desc: "ending range", input: "||: A |[1-3 B :||[4 C ||\n", expected: "A B A B A B A C"},
+		{desc: "last ending ends with the line", input: "||: A |[1 B :||[2 C\nD\n", expected: "A B A C D"},
+		{desc: "repeat count", input: "||: A | B :||x3 C\n", expected: "A B A B A B C"},
+		{desc: "repeat count before the number", input: "||: A :|| 4x\nB\n", expected: "A A A A B"},
+		{desc: "repeat count with endings", input: "||: A |[1-3 B :||x4 [4 C ||\n", expected: "A B A B A B A C"},
+		{desc: "da capo", input: "A | B | C !D.C.!\n", expected: "A B C A B C"},
+		{desc: "da capo al fine", input: "A | B !fine! | C !D.C.alfine!\n", expected: "A B C A B"},
+		{desc: "dal segno", input: "A | !segno! B | C !D.S.!\n", expected: "A B C B C"},
+		{desc: "dal segno without a segno", input: "A | B !D.S.!\n", expected: "A B A B"},
+		{desc: "dal segno al coda", input: "A | !segno! B !tocoda! | C !D.S.alcoda!\n# Coda\n!coda! D | E\n", expected: "A B C B D E"},
+		{desc: "no repeats after the jump", input: "||: A |[1 B :||[2 C || D !D.C.!\n", expected: "A B A C D A C D"},
+		{desc: "jump after the repeat", input: "||: A | B !D.C.alfine! :||\n", expected: "A B A B A B"},
+		{desc: "fine before the jump is played through", input: "A !fine! | B !D.C.alfine!\n", expected: "A B A"},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			assert.Equal(t, tC.expected, playbackOrder(t, tC.input))
+		})
+	}
+}
+
+func TestUnroll(t *testing.T) {
+	song, err := ParseSongFromString("# Intro\n||: C | G :||\n# Verse\nAm | `CDEF` | F\n")
+	require.NoError(t, err)
+	unrolled := song.Unroll()
+	assert.Equal(t, 7, unrolled.BarCount)
+	assert.Equal(t, 5, unrolled.WrittenBarCount)
+	numbers, sections := []int{}, []string{}
+	for _, bar := range unrolled.Bars {
+		numbers = append(numbers, bar.Number)
+		sections = append(sections, bar.Section)
+	}
+	assert.Equal(t, []int{1, 2, 1, 2, 3, 4, 5}, numbers)
+	assert.Equal(t, []string{"Intro", "Intro", "Intro", "Intro", "Verse", "Verse", "Verse"}, sections)
+	assert.Equal(t, []string{}, unrolled.Bars[5].Chords)
+	assert.Equal(t, 28.0, unrolled.QuarterNotes)
+}
+
+func TestUnrollMeters(t *testing.T) {
+	song, err := ParseSongFromString("||: A | (7/8) B :||\n")
+	require.NoError(t, err)
+	assert.Equal(t, 15.0, song.Unroll().QuarterNotes)
+}
+
+func TestUnrollResolvesSimiles(t *testing.T) {
+	song, err := ParseSongFromString("C | G | %% | %% | % | N.C.\n||: F | % :||\n")
+	require.NoError(t, err)
+	chords := []string{}
+	for _, bar := range song.Unroll().Bars {
+		chords = append(chords, strings.Join(bar.Chords, " "))
+	}
+	assert.Equal(t, []string{"C", "G", "C", "G", "G", "N.C.", "F", "F", "F", "F"}, chords)
+}
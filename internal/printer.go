@@ -2,6 +2,7 @@ package internal
 
 import (
 	"lesheets/internal/domain"
+	"strconv"
 	"strings"
 
 	"gopkg.in/yaml.v3"
@@ -25,17 +26,17 @@ func PrintFrontmatter(s *domain.Song, sb *strings.Builder) error {
 
 func PrintSections(song *domain.Song, sb *strings.Builder) error {
 	for _, s := range song.Sections {
-		if s.Name != "" {
+		if s.Heading() != "" {
 			sb.WriteString("\n")
 			if s.Break {
 				sb.WriteString("#- ")
 			} else {
 				sb.WriteString("# ")
 			}
-			sb.WriteString(s.Name)
+			sb.WriteString(s.Heading())
 			sb.WriteString("\n\n")
 		}
-		for _, l := range s.Lines {
+		for _, l := range s.WrittenLines() {
 			PrintBarsLine(&l, sb)
 			sb.WriteString("\n")
 		}
@@ -58,24 +59,48 @@ func PrintBarsLine(line *domain.Line, sb *strings.Builder) {
 		}
 		PrintBar(&b, sb, next)
 	}
+	for _, lyrics := range line.Lyrics {
+		sb.WriteString("\n> ")
+		sb.WriteString(strings.Join(lyrics.Fragments, " | "))
+	}
 }
 
 func PrintBar(bar *domain.Bar, sb *strings.Builder, next *domain.Bar) {
 	if bar.RepeatStart {
 		sb.WriteString("||: ")
 	}
+	if bar.EndingStart {
+		sb.WriteString("[")
+		sb.WriteString(bar.Ending.Label)
+		sb.WriteString(" ")
+	}
 	if bar.BarNote != "" {
 		sb.WriteString(`"`)
 		sb.WriteString(bar.BarNote)
 		sb.WriteString(`" `)
 	}
+	for _, n := range bar.NavigationAt(true) {
+		sb.WriteString("!" + string(n) + "! ")
+	}
+	if bar.MeterChange {
+		sb.WriteString("(" + bar.Meter.String() + ") ")
+	}
+	if bar.KeyChange {
+		sb.WriteString("!key=" + bar.Key + "! ")
+	}
+	if bar.TempoChange {
+		sb.WriteString("!tempo=" + strconv.Itoa(bar.Tempo) + "! ")
+	}
 
 	if bar.Backtick.Value != "" {
 		sb.WriteString("`")
 		sb.WriteString(bar.Backtick.Value)
 		sb.WriteString("`")
 	} else {
-		for _, c := range bar.Chords {
+		for i, c := range bar.Chords {
+			if i > 0 {
+				sb.WriteString(" ")
+			}
 			if c.Annotation.Value != "" {
 				sb.WriteString("!")
 				sb.WriteString(c.Annotation.Value)
@@ -84,9 +109,15 @@ func PrintBar(bar *domain.Bar, sb *strings.Builder, next *domain.Bar) {
 			sb.WriteString(c.Value)
 		}
 	}
+	for _, n := range bar.NavigationAt(false) {
+		sb.WriteString(" !" + string(n) + "!")
+	}
 
 	if bar.RepeatEnd {
 		sb.WriteString(" :||")
+		if bar.RepeatCount > 0 {
+			sb.WriteString("x" + strconv.Itoa(bar.RepeatCount))
+		}
 	} else if bar.DoubleBarEnd {
 		sb.WriteString(" ||")
 	} else if next != nil {
@@ -44,6 +44,59 @@ func TestPrintTwoLines(t *testing.T) {
 	assert.Equal(t, input, output)
 }
 
+func TestPrintLyrics(t *testing.T) {
+	input := "A | Bmaj7\n> Hello | world\n> Bye | \n"
+	s, err := ParseSongFromString(input)
+	assert.NoError(t, err)
+	output := PrintLesheet(s)
+	assert.Equal(t, "A | Bmaj7\n> Hello | world\n> Bye | \n", output)
+}
+
+func TestPrintEndings(t *testing.T) {
+	input := "||: A | [1 B :||[2 C ||\n"
+	s, err := ParseSongFromString(input)
+	assert.NoError(t, err)
+	output := PrintLesheet(s)
+	assert.Equal(t, input, output)
+}
+
+func TestPrintNavigation(t *testing.T) {
+	s, err := ParseSongFromString("A | !D.S.alcoda! B | !segno! C\n")
+	assert.NoError(t, err)
+	output := PrintLesheet(s)
+	assert.Equal(t, "A | B !D.S.alcoda! | !segno! C\n", output)
+}
+
+func TestPrintRepeatCount(t *testing.T) {
+	s, err := ParseSongFromString("||: A | B :|| 3x\n")
+	assert.NoError(t, err)
+	output := PrintLesheet(s)
+	assert.Equal(t, "||: A | B :||x3\n", output)
+}
+
+func TestPrintMeter(t *testing.T) {
+	s, err := ParseSongFromString("A | !meter=3/4! B | (4/4) C\n")
+	assert.NoError(t, err)
+	output := PrintLesheet(s)
+	assert.Equal(t, "A | (3/4) B | (4/4) C\n", output)
+}
+
+func TestPrintKeyAndTempoChanges(t *testing.T) {
+	input := "# A !key=Eb! !tempo=90!\n\nA | !key=D! !tempo=100! B\n"
+	s, err := ParseSongFromString(input)
+	assert.NoError(t, err)
+	output := PrintLesheet(s)
+	assert.Equal(t, "\n"+input, output)
+}
+
+func TestPrintSectionReference(t *testing.T) {
+	input := "\n# A\n\nC | F\nG | C\n\n# A2 = A !key=D!\n\nG7\n"
+	s, err := ParseSongFromString(input)
+	assert.NoError(t, err)
+	output := PrintLesheet(s)
+	assert.Equal(t, input, output)
+}
+
 func TestPrintBacktick(t *testing.T) {
 	input := "A | `backtick`\n"
 	s, err := ParseSongFromString(input)
@@ -82,3 +135,11 @@ func TestReflexive(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, s, s2)
 }
+
+func TestPrintSeveralChordsInABar(t *testing.T) {
+	input := ". !pull!Cm . . | !push!Ab G\n"
+	s, err := ParseSongFromString(input)
+	assert.NoError(t, err)
+	output := PrintLesheet(s)
+	assert.Equal(t, input, output)
+}
@@ -0,0 +1,157 @@
+package internal
+
+import (
+	"lesheets/internal/domain"
+	"regexp"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// PrintSource writes the song back from the source it was parsed from, with the current values of
+// its chords, backticks and front matter. Tools that rewrite those values, like transpose, keep the
+// layout and the comments of the author this way. Songs without a syntax tree are printed with
+// PrintLesheet.
+func PrintSource(song *domain.Song) (string, error) {
+	if song.Syntax == nil {
+		return PrintLesheet(song), nil
+	}
+	values, chords := nodeValues(song)
+	sb := strings.Builder{}
+	hasFrontMatter := false
+	for _, tok := range song.Syntax.Tokens {
+		for _, trivia := range tok.Leading {
+			sb.WriteString(trivia.Text)
+		}
+		text := tok.Text
+		if tok.Type == domain.TokenFrontMatter {
+			hasFrontMatter = true
+			fm, err := rewriteFrontMatter(tok.Text, tok.Value, song.FrontMatter)
+			if err != nil {
+				return "", err
+			}
+			text = fm
+		} else if value, ok := chords[tok.Span.End.Offset]; ok && tok.Type == domain.TokenChord {
+			text = value
+		} else if value, ok := values[tok.Span.Start.Offset]; ok && value != tok.Value {
+			text = rewriteToken(&tok, value)
+		}
+		sb.WriteString(text)
+	}
+	if !hasFrontMatter && len(song.FrontMatter) > 0 {
+		fm, err := formatFrontMatter(song.FrontMatter)
+		if err != nil {
+			return "", err
+		}
+		return "---\n" + fm + "---\n" + sb.String(), nil
+	}
+	return sb.String(), nil
+}
+
+// nodeValues returns the current value of the backticks and key changes, by the offset of their
+// token, and the value of the chords by the end of their token: the start of a rewritten chord can't
+// be told from its value. The value of a header is the key of its section.
+func nodeValues(song *domain.Song) (map[int]string, map[int]string) {
+	values, chords := map[int]string{}, map[int]string{}
+	for _, section := range song.Sections {
+		if section.Key != "" {
+			values[section.Span.Start.Offset] = section.Key
+		}
+		for _, line := range section.WrittenLines() {
+			if line.MultilineBacktick.Value != "" {
+				values[line.MultilineBacktick.Span.Start.Offset] = line.MultilineBacktick.Value
+			}
+			for _, bar := range line.Bars {
+				if bar.Backtick.Value != "" {
+					values[bar.Backtick.Span.Start.Offset] = bar.Backtick.Value
+				}
+				for _, chord := range bar.Chords {
+					chords[chord.Span.End.Offset] = chord.Value
+				}
+				for _, tok := range bar.Tokens {
+					if bar.KeyChange && tok.Type == domain.TokenAnnotation && strings.HasPrefix(tok.Value, "key=") {
+						values[tok.Span.Start.Offset] = "key=" + bar.Key
+					}
+				}
+			}
+		}
+	}
+	return values, chords
+}
+
+var headingKey = regexp.MustCompile(`!key=[^!]*!`)
+
+func rewriteToken(tok *domain.Token, value string) string {
+	switch tok.Type {
+	case domain.TokenBacktick:
+		return "`" + value + "`"
+	case domain.TokenBacktickMultiline:
+		// keep the opening ``` with the line break after it
+		opening := tok.Text[:len(tok.Text)-len(tok.Value)-3]
+		return opening + value + "```"
+	case domain.TokenAnnotation:
+		return "!" + value + "!"
+	case domain.TokenHeader, domain.TokenHeaderBreak:
+		return headingKey.ReplaceAllLiteralString(tok.Text, "!key="+value+"!")
+	}
+	return tok.Text
+}
+
+// rewriteFrontMatter updates the fields of the front matter that changed, line by line, so that
+// the order of the fields and the yaml comments are kept.
+func rewriteFrontMatter(text string, body string, fm map[string]string) (string, error) {
+	original := map[string]string{}
+	if err := yaml.Unmarshal([]byte(body), &original); err != nil {
+		// It was reported when parsing, leave it as it is
+		return text, nil
+	}
+	newBody := body
+	for k, v := range original {
+		field := regexp.MustCompile(`(?m)^(\s*` + regexp.QuoteMeta(k) + `\s*:[ \t]*).*$\n?`)
+		value, ok := fm[k]
+		switch {
+		case !ok:
+			newBody = field.ReplaceAllString(newBody, "")
+		case value != v:
+			scalar, err := yamlScalar(value)
+			if err != nil {
+				return "", err
+			}
+			newBody = field.ReplaceAllStringFunc(newBody, func(line string) string {
+				prefix := field.FindStringSubmatch(line)[1]
+				end := ""
+				if strings.HasSuffix(line, "\n") {
+					end = "\n"
+				}
+				return prefix + scalar + end
+			})
+		}
+	}
+	added := []string{}
+	for k := range fm {
+		if _, ok := original[k]; !ok {
+			added = append(added, k)
+		}
+	}
+	slices.Sort(added)
+	for _, k := range added {
+		scalar, err := yamlScalar(fm[k])
+		if err != nil {
+			return "", err
+		}
+		if newBody != "" && !strings.HasSuffix(newBody, "\n") {
+			newBody += "\n"
+		}
+		newBody += k + ": " + scalar + "\n"
+	}
+	return strings.Replace(text, body, newBody, 1), nil
+}
+
+func yamlScalar(value string) (string, error) {
+	yml, err := yaml.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(string(yml), "\n"), nil
+}
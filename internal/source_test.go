@@ -0,0 +1,173 @@
+package internal
+
+import (
+	"lesheets/internal/domain"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSyntaxTreeRoundTrip(t *testing.T) {
+	inputs := map[string]string{
+		"comments":          "// intro\n---\ntitle: x\n---\n\n# A // not a comment\n  C | D // trailing\n\n\n// end",
+		"errors":            "| C : G | !push E |\n| F\n# B\n| `abc\n",
+		"windows new lines": "# A\r\nC | D\r\n// comment\r\n",
+		"bar notes":         "\"note\"\n\n   ||: C |\n",
+		"empty":             "",
+		"only whitespace":   " \n\t\n",
+	}
+	files, err := filepath.Glob("../docs/lesheets/*.lesheet")
+	require.NoError(t, err)
+	for _, file := range append(files, "testdata/all-features.nns") {
+		bytes, err := os.ReadFile(file)
+		require.NoError(t, err)
+		inputs[filepath.Base(file)] = string(bytes)
+	}
+	for name, input := range inputs {
+		t.Run(name, func(t *testing.T) {
+			song, _ := ParseSongFromString(input)
+			assert.Equal(t, input, song.Syntax.String())
+			source, err := PrintSource(song)
+			assert.NoError(t, err)
+			assert.Equal(t, input, source)
+		})
+	}
+}
+
+func TestTokenTrivia(t *testing.T) {
+	song, err := ParseSongFromString("C // one\n// two\n  D")
+	require.NoError(t, err)
+	tokens := song.Syntax.Tokens
+	require.Len(t, tokens, 4)
+	assert.Equal(t, domain.TokenReturn, tokens[1].Type)
+	assert.Equal(t, []domain.Trivia{
+		{Kind: domain.TriviaWhitespace, Text: " ", Span: domain.Span{
+			Start: domain.Position{Offset: 1, Column: 1}, End: domain.Position{Offset: 2, Column: 2}}},
+		{Kind: domain.TriviaComment, Text: "// one", Span: domain.Span{
+			Start: domain.Position{Offset: 2, Column: 2}, End: domain.Position{Offset: 8, Column: 8}}},
+	}, tokens[1].Leading)
+	assert.Equal(t, "\n", tokens[1].Text)
+	assert.Equal(t, []domain.TriviaKind{domain.TriviaComment, domain.TriviaWhitespace}, []domain.TriviaKind{
+		tokens[2].Leading[0].Kind, tokens[2].Leading[1].Kind,
+	})
+	assert.Equal(t, "D", tokens[2].Text)
+	assert.Equal(t, []domain.Token{tokens[0]}, song.Sections[0].Lines[0].Bars[0].Tokens)
+}
+
+func TestPrintSourceKeepsTheLayout(t *testing.T) {
+	input := `---
+title: Song # the title
+key: C
+---
+// Intro, piano only
+# A
+||:  Cmaj7 |  !push!Am7   // push it
+ "band" Dm7 G7 :||
+` + "`\"C\"CDEF`" + ` | F
+` + "```\nK:C\n\"C\"CDEF|\n```" + `
+`
+	song, err := ParseSongFromString(input)
+	require.NoError(t, err)
+	require.NoError(t, song.Transpose(2))
+	source, err := PrintSource(song)
+	require.NoError(t, err)
+	assert.Equal(t, `---
+title: Song # the title
+key: D
+---
+// Intro, piano only
+# A
+||:  Dmaj7 |  !push!Bm7   // push it
+ "band" Em7 A7 :||
+`+"`\"D\"DE^FG`"+` | G
+`+"```\nK:D\n\"D\"DEFG|\n```"+`
+`, source)
+}
+
+func TestPrintSourceChordLengthChanges(t *testing.T) {
+	testCases := []struct {
+		semitones int
+		expected  string
+	}{
+		{semitones: 1, expected: "---\nkey: Db\n---\nDb | Gb | !fermata!Cb7 | Ab\n"},
+		{semitones: -1, expected: "---\nkey: B\n---\nB | E | !fermata!A7 | F#\n"},
+	}
+	for _, tC := range testCases {
+		t.Run(strconv.Itoa(tC.semitones), func(t *testing.T) {
+			song, err := ParseSongFromString("---\nkey: C\n---\nC | F | !fermata!Bb7 | G\n")
+			require.NoError(t, err)
+			require.NoError(t, song.Transpose(tC.semitones))
+			source, err := PrintSource(song)
+			require.NoError(t, err)
+			assert.Equal(t, tC.expected, source)
+		})
+	}
+}
+
+func TestPrintSourceTransposesAllFeatures(t *testing.T) {
+	bytes, err := os.ReadFile("../docs/lesheets/all-features.lesheet")
+	require.NoError(t, err)
+	song, _ := ParseSongFromString(string(bytes))
+	require.NoError(t, song.Transpose(2))
+	source, err := PrintSource(song)
+	require.NoError(t, err)
+	original, _ := ParseSongFromString(string(bytes))
+	transposed, _ := ParseSongFromString(source)
+	bars := transposed.Bars()
+	require.Len(t, bars, len(original.Bars()))
+	for i, bar := range original.Bars() {
+		require.Len(t, bars[i].Chords, len(bar.Chords))
+		for c, chord := range bar.Chords {
+			if !chord.IsChordSymbol() {
+				continue
+			}
+			from, err := chord.Symbol()
+			require.NoError(t, err)
+			to, err := bars[i].Chords[c].Symbol()
+			require.NoError(t, err)
+			if from.IsNashville() {
+				assert.Equal(t, from.String(), to.String())
+				continue
+			}
+			assert.Equal(t, (from.Root.PitchClass()+2)%12, to.Root.PitchClass(), chord.Value)
+			if from.Bass != nil {
+				assert.Equal(t, (from.Bass.PitchClass()+2)%12, to.Bass.PitchClass(), chord.Value)
+			}
+			assert.Equal(t, from.Suffix, to.Suffix, chord.Value)
+		}
+	}
+}
+
+func TestPrintSourceTransposesKeyChanges(t *testing.T) {
+	song, err := ParseSongFromString("---\nkey: C\n---\n# A\nC |  !key=D!  D\n# B !key=E! !tempo=90!\nE\n")
+	require.NoError(t, err)
+	require.NoError(t, song.Transpose(-2))
+	source, err := PrintSource(song)
+	require.NoError(t, err)
+	assert.Equal(t, "---\nkey: Bb\n---\n# A\nBb |  !key=C!  C\n# B !key=D! !tempo=90!\nD\n", source)
+}
+
+func TestPrintSourceSectionReference(t *testing.T) {
+	song, err := ParseSongFromString("---\nkey: C\n---\n# A\nC | F\n# B = A !key=D!\nG7\n")
+	require.NoError(t, err)
+	require.NoError(t, song.Transpose(2))
+	assert.Equal(t, "E", song.Sections[2].Lines[0].Bars[0].Chords[0].Value)
+	source, err := PrintSource(song)
+	require.NoError(t, err)
+	assert.Equal(t, "---\nkey: D\n---\n# A\nD | G\n# B = A !key=E!\nA7\n", source)
+}
+
+func TestPrintSourceFrontMatterChanges(t *testing.T) {
+	song, err := ParseSongFromString("---\ntitle: Song\ntempo: 120\n---\nC\n")
+	require.NoError(t, err)
+	delete(song.FrontMatter, "tempo")
+	song.FrontMatter["key"] = "C"
+	song.FrontMatter["title"] = "Other: song"
+	source, err := PrintSource(song)
+	require.NoError(t, err)
+	assert.Equal(t, "---\ntitle: 'Other: song'\nkey: C\n---\nC\n", source)
+}
@@ -24,10 +24,19 @@ var Abc2svg embed.FS
 func usage() {
 	fmt.Fprintf(os.Stderr, "Usage: %s [options] <command> <file1> ... <fileN>\n", filepath.Base(os.Args[0]))
 	fmt.Fprintf(os.Stderr, "\nCommands:\n")
-	fmt.Fprintf(os.Stderr, "  watch   Watch the input files for changes, rendering the html files for them in outdir dir\n")
-	fmt.Fprintf(os.Stderr, "  serve   Run a server for the previously generated html files\n")
-	fmt.Fprintf(os.Stderr, "  html    Render html files for all the files provided as arguments\n")
-	fmt.Fprintf(os.Stderr, "  json    Print a json representation of the song\n")
+	fmt.Fprintf(os.Stderr, "  watch     Watch the input files for changes, rendering the html files for them in outdir dir\n")
+	fmt.Fprintf(os.Stderr, "  serve     Run a server for the previously generated html files\n")
+	fmt.Fprintf(os.Stderr, "  html      Render html files for all the files provided as arguments\n")
+	fmt.Fprintf(os.Stderr, "  json      Print a json representation of the song\n")
+	fmt.Fprintf(os.Stderr, "  transpose Print the song transposed by -semitones or to the key given with -to\n")
+	fmt.Fprintf(os.Stderr, "  convert   Print the song converted to the notation or format given with -to: nashville, letters, lesheet, chordpro or ireal\n")
+	fmt.Fprintf(os.Stderr, "  fmt       Print the songs formatted, or write them back with -w, or list the unformatted ones with -check\n")
+	fmt.Fprintf(os.Stderr, "  lsp       Run a Language Server Protocol server on stdin and stdout for editors\n")
+	fmt.Fprintf(os.Stderr, "  lint      Check the songs and report their problems, exiting with status 1 if any is found\n")
+	fmt.Fprintf(os.Stderr, "  unroll    Print the bars of the songs in the order they are played, following repeats, endings and D.S./D.C.\n")
+	fmt.Fprintf(os.Stderr, "  midi      Write a MIDI file for each song in outdir dir, with the chords played in the -style given and a click\n")
+	fmt.Fprintf(os.Stderr, "  musicxml  Write a MusicXML score for each song in outdir dir, to open in notation software\n")
+	fmt.Fprintf(os.Stderr, "  abc       Write an ABC tune for each song in outdir dir, to go through any ABC tool\n")
 	fmt.Fprintf(os.Stderr, "\nOptions:\n")
 	flag.PrintDefaults()
 }
@@ -38,6 +47,13 @@ func main() {
 	printSong := flag.Bool("print", false, "Print song in text format (only available for the html command)")
 	printTokens := flag.Bool("print-tokens", false, "Print tokens (only available for the html command)")
 	port := flag.Int("p", 8008, "The port for listening to HTTP requests for commands that start an HTTP server")
+	semitones := flag.Int("semitones", 0, "Semitones to transpose, negative to go down (only available for the transpose command)")
+	to := flag.String("to", "", "Target key for the transpose command, or target notation or format for the convert command")
+	write := flag.Bool("w", false, "Write the formatted songs back to their files (only available for the fmt command)")
+	check := flag.Bool("check", false, "List the songs that are not formatted and exit with status 1 if any (only available for the fmt command)")
+	format := flag.String("format", "text", "Output format of the lint and unroll commands: text or json")
+	style := flag.String("style", "comp", "Style of the chords of the midi command: block or comp")
+	rests := flag.Bool("rests", false, "Write the chords over invisible rests instead of slashes (only available for the abc command)")
 
 	// Parse CLI args
 	flag.Parse()
@@ -76,6 +92,28 @@ func main() {
 		cmds.WatchCommand(staticsFS, dev, *outputDir, files, *port)
 	case "json":
 		cmds.JsonCommand(files, *outputDir)
+	case "transpose":
+		cmds.TransposeCommand(files, *semitones, *to)
+	case "convert":
+		cmds.ConvertCommand(files, *to)
+	case "fmt":
+		if cmds.FmtCommand(files, *write, *check) && *check {
+			os.Exit(1)
+		}
+	case "lsp":
+		cmds.LspCommand()
+	case "lint":
+		if cmds.LintCommand(files, *format) {
+			os.Exit(1)
+		}
+	case "unroll":
+		cmds.UnrollCommand(files, *format)
+	case "midi":
+		cmds.MidiCommand(files, *outputDir, *style)
+	case "musicxml":
+		cmds.MusicXMLCommand(files, *outputDir)
+	case "abc":
+		cmds.AbcCommand(files, *outputDir, *rests)
 	case "html":
 		cleanup := svg.LoadJsRuntime(Abc2svg)
 		defer cleanup()